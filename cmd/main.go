@@ -4,27 +4,56 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/vindennt/akasha-showdown-engine/internal/api"
+	"github.com/vindennt/akasha-showdown-engine/internal/clock"
 	"github.com/vindennt/akasha-showdown-engine/internal/config"
 	"github.com/vindennt/akasha-showdown-engine/internal/db"
+	"github.com/vindennt/akasha-showdown-engine/internal/health"
+	"github.com/vindennt/akasha-showdown-engine/internal/logging"
+	"github.com/vindennt/akasha-showdown-engine/internal/metrics"
+	"github.com/vindennt/akasha-showdown-engine/internal/middleware"
+	"github.com/vindennt/akasha-showdown-engine/internal/origin"
+	"github.com/vindennt/akasha-showdown-engine/internal/tracing"
 	"github.com/vindennt/akasha-showdown-engine/internal/ws"
 )
 
 func main() {
-	log.Printf("Starting akasha-showdown-engine server...")
-
 	cfg, cfgErr := config.LoadConfig()
 	if cfgErr != nil {
 		log.Fatalf("Could not load config: %v", cfgErr)
 	}
 
+	// Also routes anything still using the log package through the same handler
+	logger, logErr := logging.New(os.Stderr, cfg.Logs.Style, cfg.Logs.Level)
+	if logErr != nil {
+		log.Fatalf("Could not set up logging: %v", logErr)
+	}
+	slog.SetDefault(logger)
+
+	shutdownTracing, traceErr := tracing.Setup(context.Background(), cfg.TraceExporter, cfg.TraceSampleRatio)
+	if traceErr != nil {
+		log.Fatalf("Could not set up tracing: %v", traceErr)
+	}
+
+	slog.Info("Starting akasha-showdown-engine server...")
+
 	err := run(cfg)
+
+	// Flush spans still buffered before exiting
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if traceErr := shutdownTracing(ctx); traceErr != nil {
+		slog.Error("Failed to flush traces", "error", traceErr)
+	}
+
 	if err != nil {
 		log.Fatalf("Could not start server: %v", err)
 	}
@@ -39,10 +68,17 @@ func run(cfg *config.Config) error {
 
 	dbClient := db.NewClient(cfg)
 
+	// One origin policy for CORS and WebSocket upgrades. Already checked by LoadConfig
+	origins, err := origin.New(cfg.AllowedOrigins, cfg.AllowCredentials)
+	if err != nil {
+		return err
+	}
+
 	// Main HTTP request router
 	mux := http.NewServeMux()
-	ws.NewGameServer(mux, dbClient)
-	api.RegisterRoutes(mux, cfg, dbClient)
+	gs := ws.NewGameServer(mux, cfg, dbClient, origins, clock.New())
+	checker := health.NewChecker(cfg.HealthCheckTimeout, cfg.HealthCacheTTL)
+	api.RegisterRoutes(mux, cfg, dbClient, gs.AuthClient(), checker)
 	
 	// Create TCP address listener "l"
 	addr := fmt.Sprintf(":%s", cfg.Port)
@@ -50,13 +86,13 @@ func run(cfg *config.Config) error {
 	if err != nil {
 		return err
 	}
-	log.Printf("Server listening on http://localhost%s", addr)
+	slog.Info("Server listening", "url", "http://localhost"+addr)
 	s := &http.Server{
-		Handler: mux,
-		ReadTimeout: time.Second * 10,
-		WriteTimeout: time.Second * 10,
+		Handler: tracing.Middleware(metrics.Middleware(middleware.CORS(origins)(mux))),
+		ReadTimeout: cfg.HTTPReadTimeout,
+		WriteTimeout: cfg.HTTPWriteTimeout,
 	}
-	log.Printf("Now listening on ws://%v", l.Addr())
+	slog.Info("Now listening", "url", fmt.Sprintf("ws://%v", l.Addr()))
 	
 	// Create error channel
 	errc := make(chan error, 1)
@@ -64,27 +100,83 @@ func run(cfg *config.Config) error {
 	// Async goroutine to run the HTTP server
 	// Serves HTTP requests onto the listener
 	go func() {
-		log.Printf("Starting HTTP server...")
+		slog.Info("Starting HTTP server...")
 		errc <- s.Serve(l)
 	}()
 
+	// Runtime settings are reloaded from the config file and env on SIGHUP,
+	// and whenever the config file changes
+	reloadCtx, stopReload := context.WithCancel(context.Background())
+	defer stopReload()
+	hups := make(chan os.Signal, 1)
+	signal.Notify(hups, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-hups:
+				reloadSettings(gs, "SIGHUP")
+			case <-reloadCtx.Done():
+				return
+			}
+		}
+	}()
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := config.Watch(reloadCtx, path, func() { reloadSettings(gs, "config file") }); err != nil {
+			slog.Warn("Could not watch config file, send SIGHUP to reload instead", "path", path, "error", err)
+		}
+	}
+
 	// Create OS signal channel
+	// Docker stops containers with SIGTERM
 	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, os.Interrupt)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
 
 	// Wait and listen on the err and sig channels; Logs any received errors/signals
 	select {
 	case err := <-errc:
-		log.Printf("Server error. Failed to serve: %v", err)
+		slog.Error("Server error. Failed to serve", "error", err)
 	case sig := <-sigs:
-		log.Printf("Received signal %v. Shutting down server...", sig)
+		slog.Info("Received signal. Shutting down server...", "signal", sig.String())
 	}
 
-	// Provide context for cleanup time, forcing close after 10 seconds
-	// Stop accepting new connections and wait for in-progress requests to finish
-	// Free context resources and shutdown the HTTP server cleanly
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	// Readiness fails from here on so load balancers stop routing to this server
+	checker.SetDraining(true)
+
+	// Keep serving while matches finish, so players can still send commands
+	// A second signal gives up on waiting
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), cfg.ShutdownDrainTimeout)
+	defer cancelDrain()
+	go func() {
+		select {
+		case sig := <-sigs:
+			slog.Warn("Received second signal. Skipping drain...", "signal", sig.String())
+			cancelDrain()
+		case <-drainCtx.Done():
+		}
+	}()
+	gs.Drain(drainCtx)
+
+	// Provide context for cleanup time, forcing close after the flush timeout
+	// Snapshot unfinished matches, flush database writes and close WebSockets,
+	// which http.Server.Shutdown doesn't track once they're hijacked
+	// Then stop accepting new connections and wait for in-progress requests to finish
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownFlushTimeout)
 	defer cancel()
 
+	gs.Close(ctx)
 	return s.Shutdown(ctx)
-}
\ No newline at end of file
+}
+
+// reloadSettings reads the config again and applies its runtime settings to gs
+// Other settings only change on restart. A config that fails to load or validate
+// leaves the current settings in force
+func reloadSettings(gs *ws.GameServer, source string) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		slog.Error("Could not reload config, keeping current settings", "source", source, "error", err)
+		return
+	}
+	if err := gs.ApplySettings(ws.SettingsFrom(cfg), source); err != nil {
+		slog.Error("Could not apply reloaded settings, keeping current settings", "source", source, "error", err)
+	}
+}
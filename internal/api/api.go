@@ -1,35 +1,63 @@
 package api
 
 import (
+	"log/slog"
 	"net/http"
+	"time"
 
+	"github.com/vindennt/akasha-showdown-engine/internal/apikey"
 	"github.com/vindennt/akasha-showdown-engine/internal/auth"
 	"github.com/vindennt/akasha-showdown-engine/internal/config"
 	"github.com/vindennt/akasha-showdown-engine/internal/db"
+	"github.com/vindennt/akasha-showdown-engine/internal/health"
+	"github.com/vindennt/akasha-showdown-engine/internal/metrics"
 	"github.com/vindennt/akasha-showdown-engine/internal/middleware"
 )
 
 
-func RegisterRoutes(mux *http.ServeMux, cfg *config.Config, dbClient *db.Client) {
-	authClient := auth.NewClient(cfg)
+// The auth client is shared with the game server so both enforce the same bans and roles
+// Probes for the clients created here are added to checker
+func RegisterRoutes(mux *http.ServeMux, cfg *config.Config, dbClient *db.Client, authClient *auth.Client, checker *health.Checker) {
 	itemHandler := NewItemHandler(dbClient)
-	
+	enkaClient := NewEnkaClient(cfg)
+
+	checker.Add("postgrest", true, dbClient.Ping)
+	checker.Add("gotrue", true, authClient.Ping)
+	checker.Add("enka", cfg.HealthRequireEnka, enkaClient.client.Ping)
+
+	// Every route is registered behind the same middleware stack
+	routes := middleware.Stack{
+		Logger:    slog.Default(),
+		BodyLimit: cfg.HTTPBodyLimit,
+		Timeout:   cfg.HTTPHandlerTimeout,
+	}
+	handle := func(pattern string, handler http.Handler) {
+		mux.Handle(pattern, routes.Wrap(handler))
+	}
+
 	// Health Check
-	mux.HandleFunc("/health/ping", func(w http.ResponseWriter, r *http.Request) {
+	// ping is kept for existing monitors. live never checks dependencies, ready does
+	handle("/health/ping", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		w.Write([]byte(`{"message": "pong"}`))
-	})
+	}))
+	handle("GET /health/live", http.HandlerFunc(checker.LiveHandler))
+	handle("GET /health/ready", http.HandlerFunc(checker.ReadyHandler))
+	handle("GET /health/details", authClient.RequireRole(auth.RoleAdmin)(http.HandlerFunc(checker.DetailsHandler)))
+
+	// Scrapers authenticate with an API key granted the metrics scope
+	handle("GET /metrics", authClient.RequireAccess(apikey.ScopeMetrics, auth.RoleAdmin)(metrics.Handler()))
 
-	mux.Handle("/auth/signup", middleware.CORSHandler(http.HandlerFunc(authClient.Signup)))
-	mux.Handle("/auth/signin", middleware.CORSHandler(http.HandlerFunc(authClient.Signin)))
+	handle("/auth/signup", http.HandlerFunc(authClient.Signup))
+	handle("/auth/signin", http.HandlerFunc(authClient.Signin))
 
-	mux.Handle("/item/create-item", middleware.CORSHandler(authClient.AuthMiddleware(http.HandlerFunc(itemHandler.CreateItem))))
-	mux.Handle("/item/get-item/", middleware.CORSHandler(authClient.AuthMiddleware(http.HandlerFunc(itemHandler.GetItem))))
-	mux.Handle("/item/get-items", middleware.CORSHandler(authClient.AuthMiddleware(http.HandlerFunc(itemHandler.ListItems))))
-	mux.Handle("/item/update-item/", middleware.CORSHandler(authClient.AuthMiddleware(http.HandlerFunc(itemHandler.UpdateItem))))
-	mux.Handle("/item/delete/", middleware.CORSHandler(authClient.AuthMiddleware(http.HandlerFunc(itemHandler.DeleteItem))))
+	handle("/item/create-item", authClient.AuthMiddleware(http.HandlerFunc(itemHandler.CreateItem)))
+	handle("/item/get-item/", authClient.AuthMiddleware(http.HandlerFunc(itemHandler.GetItem)))
+	handle("/item/get-items", authClient.AuthMiddleware(http.HandlerFunc(itemHandler.ListItems)))
+	handle("/item/update-item/", authClient.AuthMiddleware(http.HandlerFunc(itemHandler.UpdateItem)))
+	handle("/item/delete/", authClient.AuthMiddleware(http.HandlerFunc(itemHandler.DeleteItem)))
 
 	// Enka API
-	enkaClient := NewEnkaClient()
-	mux.Handle("GET /api/enka/player/{uid}", middleware.CORSHandler(http.HandlerFunc(enkaClient.GetPlayerData)))
+	// Given a second past the Enka.Network timeout, so its own timeout error reaches the client
+	mux.Handle("GET /api/enka/player/{uid}", routes.WithTimeout(cfg.EnkaTimeout+time.Second).WrapFunc(enkaClient.GetPlayerData))
 }
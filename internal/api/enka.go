@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/vindennt/akasha-showdown-engine/internal/config"
 	"github.com/vindennt/akasha-showdown-engine/internal/enka"
 )
 
@@ -11,16 +12,13 @@ type EnkaClient struct {
 	client *enka.Client
 }
 
-func NewEnkaClient() *EnkaClient
- {
-	return &EnkaClient
-	{
-		client: enka.NewClient("akasha-showdown/1.0"),
+func NewEnkaClient(cfg *config.Config) *EnkaClient {
+	return &EnkaClient{
+		client: enka.NewClient(cfg.EnkaUserAgent, cfg.EnkaTimeout),
 	}
 }
 
-func (h *EnkaClient
-	) GetPlayerData(w http.ResponseWriter, r *http.Request) {
+func (h *EnkaClient) GetPlayerData(w http.ResponseWriter, r *http.Request) {
 	// /api/enka/player/{uid}
 	uid := r.PathValue("uid")
 
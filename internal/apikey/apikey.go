@@ -0,0 +1,179 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vindennt/akasha-showdown-engine/internal/clock"
+)
+
+// API keys let trusted backends, e.g. the Discord bot, call the server as a service principal
+// A key looks like ask_<id>_<secret>. Only a hash of the secret is stored, so a key
+// can't be recovered after it is created, only rotated
+const prefix = "ask"
+
+// Scope is a permission an API key can be granted
+type Scope string
+
+const (
+	ScopePublish  Scope = "publish"  // Broadcast to the global lobby
+	ScopeModerate Scope = "moderate" // Bans, kicks, mutes and chat deletion
+	ScopeAudit    Scope = "audit"    // Read the moderation audit log
+	ScopeMetrics  Scope = "metrics"  // Scrape Prometheus metrics
+)
+
+func ValidScope(s Scope) bool {
+	return s == ScopePublish || s == ScopeModerate || s == ScopeAudit || s == ScopeMetrics
+}
+
+var (
+	ErrMalformed  = errors.New("malformed API key")
+	ErrUnknownKey = errors.New("unknown API key")
+	ErrRevoked    = errors.New("API key has been revoked")
+	ErrExpired    = errors.New("API key has expired")
+)
+
+// Key is a stored API key. Hash is never sent to clients
+type Key struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"` // Service principal the key acts as
+	Scopes      []Scope   `json:"scopes"`
+	Hash        string    `json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"`             // Zero if the key doesn't expire
+	RevokedAt   time.Time `json:"revoked_at"`             // Zero unless revoked
+	RotatedFrom string    `json:"rotated_from,omitempty"` // ID of the key this replaced
+}
+
+// Active reports whether the key can be used at now
+func (k Key) Active(now time.Time) bool {
+	return k.RevokedAt.IsZero() && (k.ExpiresAt.IsZero() || now.Before(k.ExpiresAt))
+}
+
+func (k Key) Allows(s Scope) bool {
+	return slices.Contains(k.Scopes, s)
+}
+
+// Generate creates a new key, returning the plaintext to hand out once,
+// and the ID and hash to store
+func Generate() (plaintext, id, hash string, err error) {
+	idBytes := make([]byte, 6)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", "", "", err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", "", err
+	}
+
+	id = hex.EncodeToString(idBytes)
+	encoded := base64.RawURLEncoding.EncodeToString(secret)
+	return prefix + "_" + id + "_" + encoded, id, Hash(encoded), nil
+}
+
+// Parse splits a plaintext key into its ID and secret
+func Parse(plaintext string) (id, secret string, err error) {
+	parts := strings.SplitN(plaintext, "_", 3)
+	if len(parts) != 3 || parts[0] != prefix || parts[1] == "" || parts[2] == "" {
+		return "", "", ErrMalformed
+	}
+	return parts[1], parts[2], nil
+}
+
+// Hash is the form a secret is stored in
+// Secrets are 256 random bits, so a fast hash is enough; there is nothing to brute force
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Keys holds every known API key, safe for concurrent use
+type Keys struct {
+	clock clock.Clock
+
+	mutex sync.Mutex
+	keys  map[string]Key
+}
+
+func NewKeys(clk clock.Clock) *Keys {
+	return &Keys{
+		clock: clk,
+		keys:  make(map[string]Key),
+	}
+}
+
+// Put adds or replaces a key
+func (s *Keys) Put(k Key) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.keys[k.ID] = k
+}
+
+func (s *Keys) Get(id string) (Key, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	k, ok := s.keys[id]
+	return k, ok
+}
+
+// Update applies fn to a stored key, returning the updated key
+func (s *Keys) Update(id string, fn func(k *Key)) (Key, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	k, ok := s.keys[id]
+	if !ok {
+		return Key{}, false
+	}
+	fn(&k)
+	s.keys[id] = k
+	return k, true
+}
+
+// List returns every key, newest first
+func (s *Keys) List() []Key {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	list := make([]Key, 0, len(s.keys))
+	for _, k := range s.keys {
+		list = append(list, k)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+	return list
+}
+
+// Authenticate returns the active key matching a plaintext key
+// Safe to call on a nil Keys, which knows no keys
+func (s *Keys) Authenticate(plaintext string) (Key, error) {
+	id, secret, err := Parse(plaintext)
+	if err != nil {
+		return Key{}, err
+	}
+	if s == nil {
+		return Key{}, ErrUnknownKey
+	}
+
+	k, ok := s.Get(id)
+	if !ok || subtle.ConstantTimeCompare([]byte(Hash(secret)), []byte(k.Hash)) != 1 {
+		return Key{}, ErrUnknownKey
+	}
+	if !k.RevokedAt.IsZero() {
+		return Key{}, ErrRevoked
+	}
+	if !k.Active(s.clock.Now()) {
+		return Key{}, ErrExpired
+	}
+	return k, nil
+}
@@ -1,20 +1,51 @@
 package auth
 
 import (
+	"context"
+	"net/http"
+	"time"
+
 	"github.com/supabase-community/gotrue-go"
+	"github.com/vindennt/akasha-showdown-engine/internal/apikey"
 	"github.com/vindennt/akasha-showdown-engine/internal/config"
+	"github.com/vindennt/akasha-showdown-engine/internal/metrics"
+	"github.com/vindennt/akasha-showdown-engine/internal/moderation"
 )
 
 type Client struct {
 	AuthClient gotrue.Client
+	Bans       *moderation.Bans // Checked by AuthMiddleware when set
+	Roles      RoleSource       // Roles granted outside app metadata, optional
+	Keys       *apikey.Keys     // API keys for service principals, optional
 }
 
 func NewClient(cfg *config.Config) *Client {
 	client := gotrue.New(
 		cfg.SupabaseProjectRef,
 		cfg.SupabaseAnonKey,
-	)
+	).WithClient(http.Client{
+		Timeout: time.Second * 10,
+		// gotrue-go doesn't send requests with a context, so calls are traced where they're made
+		Transport: metrics.Transport("gotrue", nil),
+	})
 	return &Client{
 		AuthClient: client,
 	}
 }
+
+// Ping checks that GoTrue is up
+// gotrue-go can't be cancelled, so an abandoned check runs until the client timeout
+func (c *Client) Ping(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.AuthClient.HealthCheck()
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
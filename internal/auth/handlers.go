@@ -6,6 +6,7 @@ import (
 
 	"github.com/supabase-community/gotrue-go/types"
 	"github.com/vindennt/akasha-showdown-engine/internal/models"
+	"github.com/vindennt/akasha-showdown-engine/internal/tracing"
 )
 
 func (c *Client) Signup(w http.ResponseWriter, r *http.Request) {
@@ -16,10 +17,12 @@ func (c *Client) Signup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	_, span := tracing.Start(r.Context(), "gotrue Signup")
 	res, err := c.AuthClient.Signup(types.SignupRequest{
 		Email:    req.Email,
 		Password: req.Password,
 	})
+	tracing.End(span, err)
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
@@ -53,7 +56,9 @@ func (c *Client) Signin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	_, span := tracing.Start(r.Context(), "gotrue SignInWithEmailPassword")
 	res, err := c.AuthClient.SignInWithEmailPassword(req.Email, req.Password)
+	tracing.End(span, err)
 
 	if err != nil {
 		http.Error(w, "Signin failed: " + err.Error(), http.StatusUnauthorized)
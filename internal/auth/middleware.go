@@ -6,14 +6,87 @@ import (
 	"strings"
 
 	"github.com/vindennt/akasha-showdown-engine/internal/models"
+	"github.com/vindennt/akasha-showdown-engine/internal/moderation"
+	"github.com/vindennt/akasha-showdown-engine/internal/tracing"
 )
 
 type contextKey string
 
 const UserContextKey contextKey = "user"
 
+// Authenticate validates an access token with Supabase and returns its user and roles
+func (c *Client) Authenticate(ctx context.Context, token string) (models.User, error) {
+	_, span := tracing.Start(ctx, "gotrue GetUser")
+	user, err := c.AuthClient.WithToken(token).GetUser()
+	tracing.End(span, err)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	id := user.ID.String()
+	return models.User{
+		ID:    id,
+		Email: user.Email,
+		Roles: c.resolveRoles(id, user.AppMetadata),
+	}, nil
+}
+
+// AuthenticateKey validates an API key and returns the service principal it acts as
+// The principal holds the service role and only the key's scopes
+func (c *Client) AuthenticateKey(plaintext string) (models.User, error) {
+	key, err := c.Keys.Authenticate(plaintext)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	scopes := make([]string, len(key.Scopes))
+	for i, s := range key.Scopes {
+		scopes[i] = string(s)
+	}
+	return models.User{
+		ID:       ServicePrincipal(key.Name),
+		Roles:    []string{string(RoleService)},
+		Scopes:   scopes,
+		APIKeyID: key.ID,
+	}, nil
+}
+
+// ServicePrincipal is the user ID a named service acts as
+func ServicePrincipal(name string) string {
+	return "service:" + name
+}
+
+// apiKey returns the API key sent with a request, from either
+// an X-API-Key header or an "Authorization: ApiKey <key>" header
+func apiKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "ApiKey "); ok {
+		return key
+	}
+	return ""
+}
+
 func (c *Client) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ban, banned := c.Bans.Check(moderation.KindIP, moderation.ClientIP(r)); banned {
+			http.Error(w, ban.Message(), http.StatusForbidden)
+			return
+		}
+
+		// Trusted backends authenticate with an API key instead of a Supabase session
+		if key := apiKey(r); key != "" {
+			principal, err := c.AuthenticateKey(key)
+			if err != nil {
+				http.Error(w, "Unauthorized: " + err.Error(), http.StatusUnauthorized)
+				return
+			}
+			ctx := context.WithValue(r.Context(), UserContextKey, principal)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -28,16 +101,15 @@ func (c *Client) AuthMiddleware(next http.Handler) http.Handler {
 
 		token := parts[1]
 
-		// Validate token across Supabase
-		user, err := c.AuthClient.WithToken(token).GetUser()
+		clientUser, err := c.Authenticate(r.Context(), token)
 		if err != nil {
 			http.Error(w, "Unauthorized: " + err.Error(), http.StatusUnauthorized)
 			return
 		}
 
-		clientUser := models.User{
-			ID:    user.ID.String(),
-			Email: user.Email,
+		if ban, banned := c.Bans.Check(moderation.KindAccount, clientUser.ID); banned {
+			http.Error(w, ban.Message(), http.StatusForbidden)
+			return
 		}
 
 		// Inject into context
@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/vindennt/akasha-showdown-engine/internal/apikey"
+	"github.com/vindennt/akasha-showdown-engine/internal/db"
+	"github.com/vindennt/akasha-showdown-engine/internal/models"
+)
+
+type Role string
+
+const (
+	RolePlayer    Role = "player"    // Every authenticated user
+	RoleModerator Role = "moderator" // Chat moderation, bans and kicks
+	RoleAdmin     Role = "admin"     // Everything a moderator can do, plus server administration
+	RoleService   Role = "service"   // Other backends acting on behalf of the system
+)
+
+// Roles that holding a role also grants
+var impliedRoles = map[Role][]Role{
+	RoleAdmin:     {RoleModerator, RolePlayer},
+	RoleModerator: {RolePlayer},
+}
+
+func ValidRole(r Role) bool {
+	return r == RolePlayer || r == RoleModerator || r == RoleAdmin || r == RoleService
+}
+
+// HasRole reports whether roles include want, directly or through a role that implies it
+func HasRole(roles []string, want Role) bool {
+	for _, r := range roles {
+		if Role(r) == want || slices.Contains(impliedRoles[Role(r)], want) {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleSource looks up roles granted outside of Supabase app metadata
+type RoleSource func(userID string) ([]Role, error)
+
+// rolesFromMetadata reads roles set in a user's Supabase app metadata,
+// either as a "roles" array or a single "role" string
+// Unknown roles are ignored
+func rolesFromMetadata(meta map[string]interface{}) []Role {
+	var names []string
+	switch v := meta["roles"].(type) {
+	case []interface{}:
+		for _, name := range v {
+			if s, ok := name.(string); ok {
+				names = append(names, s)
+			}
+		}
+	case string:
+		names = append(names, v)
+	}
+	if s, ok := meta["role"].(string); ok {
+		names = append(names, s)
+	}
+
+	roles := make([]Role, 0, len(names))
+	for _, name := range names {
+		if r := Role(name); ValidRole(r) {
+			roles = append(roles, r)
+		}
+	}
+	return roles
+}
+
+// resolveRoles combines every role a user holds. All users are players
+func (c *Client) resolveRoles(userID string, meta map[string]interface{}) []string {
+	roles := []string{string(RolePlayer)}
+	add := func(r Role) {
+		if !slices.Contains(roles, string(r)) {
+			roles = append(roles, string(r))
+		}
+	}
+
+	for _, r := range rolesFromMetadata(meta) {
+		add(r)
+	}
+	if c.Roles != nil {
+		extra, err := c.Roles(userID)
+		if err != nil {
+			// Fall back to metadata roles rather than locking the user out
+			slog.Error("Failed to look up roles", "account_id", userID, "error", err)
+		}
+		for _, r := range extra {
+			add(r)
+		}
+	}
+	return roles
+}
+
+// RequireRole only lets through authenticated users holding at least one of roles
+func (c *Client) RequireRole(roles ...Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		check := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, _ := r.Context().Value(UserContextKey).(models.User)
+			for _, role := range roles {
+				if HasRole(user.Roles, role) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		})
+		return c.AuthMiddleware(check)
+	}
+}
+
+// RequireAccess lets through users holding one of roles, and service principals
+// whose API key was granted scope. Keys never pass on their service role alone
+func (c *Client) RequireAccess(scope apikey.Scope, roles ...Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		check := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, _ := r.Context().Value(UserContextKey).(models.User)
+			if user.APIKeyID != "" {
+				if slices.Contains(user.Scopes, string(scope)) {
+					next.ServeHTTP(w, r)
+					return
+				}
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			for _, role := range roles {
+				if HasRole(user.Roles, role) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		})
+		return c.AuthMiddleware(check)
+	}
+}
+
+// RolesTable looks roles up in the Supabase user_roles table,
+// caching each user's roles for ttl so every request doesn't hit the database
+func RolesTable(dbClient *db.Client, ttl time.Duration) RoleSource {
+	type cached struct {
+		roles   []Role
+		fetched time.Time
+	}
+
+	var mutex sync.Mutex
+	cache := make(map[string]cached)
+
+	return func(userID string) ([]Role, error) {
+		mutex.Lock()
+		entry, ok := cache[userID]
+		mutex.Unlock()
+		if ok && time.Since(entry.fetched) < ttl {
+			return entry.roles, nil
+		}
+
+		var rows []struct {
+			Role string `json:"role"`
+		}
+		_, err := dbClient.GetSystemClient().From("user_roles").
+			Select("role", "", false).
+			Eq("user_id", userID).
+			ExecuteTo(&rows)
+		if err != nil {
+			return nil, err
+		}
+
+		roles := make([]Role, 0, len(rows))
+		for _, row := range rows {
+			if r := Role(row.Role); ValidRole(r) {
+				roles = append(roles, r)
+			}
+		}
+
+		now := time.Now()
+		mutex.Lock()
+		for id, entry := range cache {
+			if now.Sub(entry.fetched) >= ttl {
+				delete(cache, id)
+			}
+		}
+		cache[userID] = cached{roles: roles, fetched: now}
+		mutex.Unlock()
+
+		return roles, nil
+	}
+}
@@ -0,0 +1,203 @@
+package chatfilter
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Reasons a message is rejected. Each error's text is safe to show the sender
+var (
+	ErrEmpty       = errors.New("message is empty")
+	ErrTooLong     = errors.New("message is too long")
+	ErrBlockedWord = errors.New("message contains a blocked word")
+	ErrLink        = errors.New("links are not allowed")
+	ErrSpam        = errors.New("sending messages too quickly")
+	ErrRepeat      = errors.New("message repeated too many times")
+)
+
+// Message is a chat message going through the pipeline
+// Checks may rewrite Text, e.g. to censor words
+type Message struct {
+	SenderID int
+	LobbyID  string
+	Text     string
+	At       time.Time
+}
+
+// Check accepts, rewrites or rejects a message
+type Check func(m *Message) error
+
+// Pipeline runs checks in order, stopping at the first rejection
+type Pipeline struct {
+	checks []Check
+}
+
+func New(checks ...Check) *Pipeline {
+	return &Pipeline{checks: checks}
+}
+
+// Run passes the message through every check
+func (p *Pipeline) Run(m *Message) error {
+	for _, check := range p.checks {
+		if err := check(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MaxLength trims surrounding whitespace and rejects empty messages
+// or messages longer than max characters
+func MaxLength(max int) Check {
+	return func(m *Message) error {
+		m.Text = strings.TrimSpace(m.Text)
+		if m.Text == "" {
+			return ErrEmpty
+		}
+		if utf8.RuneCountInString(m.Text) > max {
+			return ErrTooLong
+		}
+		return nil
+	}
+}
+
+// WordFilter matches blocked words case-insensitively as whole words
+// With censor set, matches are replaced with asterisks, otherwise the message is rejected
+func WordFilter(words []string, censor bool) Check {
+	quoted := make([]string, 0, len(words))
+	for _, w := range words {
+		if w = strings.TrimSpace(w); w != "" {
+			quoted = append(quoted, regexp.QuoteMeta(w))
+		}
+	}
+	if len(quoted) == 0 {
+		return func(m *Message) error { return nil }
+	}
+	pattern := regexp.MustCompile(`(?i)\b(` + strings.Join(quoted, "|") + `)\b`)
+
+	return func(m *Message) error {
+		if !pattern.MatchString(m.Text) {
+			return nil
+		}
+		if !censor {
+			return ErrBlockedWord
+		}
+		m.Text = pattern.ReplaceAllStringFunc(m.Text, func(s string) string {
+			return strings.Repeat("*", utf8.RuneCountInString(s))
+		})
+		return nil
+	}
+}
+
+// Catches URLs with a scheme, www. prefixes and bare domains on common TLDs
+var linkPattern = regexp.MustCompile(`(?i)(\b[a-z][a-z0-9+.-]*://\S+|\bwww\.\S+|\b[a-z0-9-]+(\.[a-z0-9-]+)*\.(com|net|org|io|gg|co|me|xyz|ru|cn|tk|ly|be|app|dev|link)\b)`)
+
+// BlockLinks rejects messages that contain links
+func BlockLinks() Check {
+	return func(m *Message) error {
+		if linkPattern.MatchString(m.Text) {
+			return ErrLink
+		}
+		return nil
+	}
+}
+
+// SpamDetector limits how often each sender can post and how many times in a row
+// they can repeat the same message within the window
+type SpamDetector struct {
+	maxMessages int
+	maxRepeats  int
+	window      time.Duration
+
+	// Shared with detectors made by WithLimits
+	mutex   *sync.Mutex
+	senders map[int]*senderHistory
+}
+
+type senderHistory struct {
+	sent     []time.Time // Within the window, oldest first
+	last     string      // Normalized text of the last accepted message
+	lastAt   time.Time
+	repeated int // Times last was sent in a row
+}
+
+// NewSpamDetector allows maxMessages per window per sender, and maxRepeats
+// identical messages in a row. 0 disables either limit
+func NewSpamDetector(maxMessages, maxRepeats int, window time.Duration) *SpamDetector {
+	return &SpamDetector{
+		maxMessages: maxMessages,
+		maxRepeats:  maxRepeats,
+		window:      window,
+		mutex:       &sync.Mutex{},
+		senders:     make(map[int]*senderHistory),
+	}
+}
+
+// WithLimits returns a detector with new limits that shares this one's sender history
+// d itself is unchanged, so a pipeline using it keeps the old limits until replaced
+func (d *SpamDetector) WithLimits(maxMessages, maxRepeats int, window time.Duration) *SpamDetector {
+	return &SpamDetector{
+		maxMessages: maxMessages,
+		maxRepeats:  maxRepeats,
+		window:      window,
+		mutex:       d.mutex,
+		senders:     d.senders,
+	}
+}
+
+// Check is the pipeline check for this detector
+// Only accepted messages count towards the limits
+func (d *SpamDetector) Check(m *Message) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	h, ok := d.senders[m.SenderID]
+	if !ok {
+		h = &senderHistory{}
+		d.senders[m.SenderID] = h
+	}
+
+	cutoff := m.At.Add(-d.window)
+	kept := h.sent[:0]
+	for _, t := range h.sent {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	h.sent = kept
+
+	if d.maxMessages > 0 && len(h.sent) >= d.maxMessages {
+		return ErrSpam
+	}
+
+	text := strings.ToLower(strings.Join(strings.Fields(m.Text), " "))
+	repeated := 1
+	if text == h.last && h.lastAt.After(cutoff) {
+		repeated = h.repeated + 1
+	}
+	if d.maxRepeats > 0 && repeated > d.maxRepeats {
+		return ErrRepeat
+	}
+
+	h.sent = append(h.sent, m.At)
+	h.last = text
+	h.lastAt = m.At
+	h.repeated = repeated
+	return nil
+}
+
+// Forget drops history for senders idle for a full window
+func (d *SpamDetector) Forget(now time.Time) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for id, h := range d.senders {
+		if !h.lastAt.After(now.Add(-d.window)) {
+			delete(d.senders, id)
+		}
+	}
+}
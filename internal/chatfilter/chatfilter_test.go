@@ -0,0 +1,174 @@
+package chatfilter
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPipeline(t *testing.T) {
+	pipeline := New(
+		MaxLength(20),
+		WordFilter([]string{"darn", "heck"}, true),
+		BlockLinks(),
+	)
+
+	tests := []struct {
+		name    string
+		text    string
+		want    string
+		wantErr error
+	}{
+		{"plain", "good game", "good game", nil},
+		{"trims whitespace", "  good game \n", "good game", nil},
+		{"empty", "   ", "", ErrEmpty},
+		{"at the limit", strings.Repeat("a", 20), strings.Repeat("a", 20), nil},
+		{"too long", strings.Repeat("a", 21), "", ErrTooLong},
+		{"counts characters not bytes", strings.Repeat("é", 20), strings.Repeat("é", 20), nil},
+		{"censors blocked word", "oh darn it", "oh **** it", nil},
+		{"censors any case", "HECK no", "**** no", nil},
+		{"whole words only", "darning socks", "darning socks", nil},
+		{"link with scheme", "see https://x.io", "", ErrLink},
+		{"www link", "go to www.site", "", ErrLink},
+		{"bare domain", "join evil.gg", "", ErrLink},
+		{"sentence end is not a link", "gg.wp", "gg.wp", nil},
+		{"length checked first", strings.Repeat("darn ", 5), "", ErrTooLong},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Message{Text: tt.text}
+			err := pipeline.Run(m)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Run(%q) = %v, want %v", tt.text, err, tt.wantErr)
+			}
+			if err == nil && m.Text != tt.want {
+				t.Errorf("Run(%q) text = %q, want %q", tt.text, m.Text, tt.want)
+			}
+		})
+	}
+}
+
+func TestWordFilterRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		words   []string
+		text    string
+		wantErr error
+	}{
+		{"blocked word", []string{"darn"}, "oh darn", ErrBlockedWord},
+		{"clean", []string{"darn"}, "oh dear", nil},
+		{"no words", nil, "oh darn", nil},
+		{"blank words ignored", []string{" ", ""}, "oh darn", nil},
+		{"regexp characters are literal", []string{"a.b"}, "axb", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Message{Text: tt.text}
+			if err := WordFilter(tt.words, false)(m); !errors.Is(err, tt.wantErr) {
+				t.Errorf("WordFilter(%q) on %q = %v, want %v", tt.words, tt.text, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSpamDetector(t *testing.T) {
+	start := time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	type send struct {
+		sender  int
+		text    string
+		after   time.Duration // Since start
+		wantErr error
+	}
+	tests := []struct {
+		name        string
+		maxMessages int
+		maxRepeats  int
+		sends       []send
+	}{
+		{"rate limit", 3, 0, []send{
+			{1, "a", 0, nil},
+			{1, "b", time.Second, nil},
+			{1, "c", 2 * time.Second, nil},
+			{1, "d", 3 * time.Second, ErrSpam},
+		}},
+		{"rate limit per sender", 1, 0, []send{
+			{1, "a", 0, nil},
+			{2, "a", 0, nil},
+			{1, "b", time.Second, ErrSpam},
+		}},
+		{"window slides", 2, 0, []send{
+			{1, "a", 0, nil},
+			{1, "b", time.Second, nil},
+			{1, "c", 10 * time.Second, nil},
+			{1, "d", 10500 * time.Millisecond, ErrSpam},
+		}},
+		{"rejected messages don't count", 1, 0, []send{
+			{1, "a", 0, nil},
+			{1, "b", time.Second, ErrSpam},
+			{1, "c", 10 * time.Second, nil},
+		}},
+		{"repeats", 0, 2, []send{
+			{1, "gg", 0, nil},
+			{1, "GG", time.Second, nil},
+			{1, " gg ", 2 * time.Second, ErrRepeat},
+			{1, "wp", 3 * time.Second, nil},
+			{1, "gg", 4 * time.Second, nil},
+		}},
+		{"repeats reset after window", 0, 1, []send{
+			{1, "gg", 0, nil},
+			{1, "gg", 11 * time.Second, nil},
+		}},
+		{"limits off", 0, 0, []send{
+			{1, "gg", 0, nil},
+			{1, "gg", 0, nil},
+			{1, "gg", 0, nil},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewSpamDetector(tt.maxMessages, tt.maxRepeats, 10*time.Second)
+			for i, s := range tt.sends {
+				m := &Message{SenderID: s.sender, Text: s.text, At: start.Add(s.after)}
+				if err := d.Check(m); !errors.Is(err, s.wantErr) {
+					t.Fatalf("send %d (%q from %d) = %v, want %v", i, s.text, s.sender, err, s.wantErr)
+				}
+			}
+		})
+	}
+}
+
+func TestSpamDetectorForget(t *testing.T) {
+	start := time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+	d := NewSpamDetector(1, 0, 10*time.Second)
+
+	d.Check(&Message{SenderID: 1, Text: "a", At: start})
+	d.Check(&Message{SenderID: 2, Text: "a", At: start.Add(5 * time.Second)})
+	d.Forget(start.Add(12 * time.Second))
+
+	if _, ok := d.senders[1]; ok {
+		t.Error("sender 1 was idle for the window but wasn't forgotten")
+	}
+	if _, ok := d.senders[2]; !ok {
+		t.Error("sender 2 was forgotten within the window")
+	}
+}
+
+func TestSpamDetectorWithLimits(t *testing.T) {
+	start := time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+	d := NewSpamDetector(2, 0, 10*time.Second)
+	d.Check(&Message{SenderID: 1, Text: "a", At: start})
+
+	// The message sent under the old limits still counts
+	tighter := d.WithLimits(1, 0, 10*time.Second)
+	if err := tighter.Check(&Message{SenderID: 1, Text: "b", At: start.Add(time.Second)}); !errors.Is(err, ErrSpam) {
+		t.Errorf("Check() after tightening = %v, want %v", err, ErrSpam)
+	}
+	if d.maxMessages != 2 {
+		t.Errorf("old detector limit = %d, want it unchanged at 2", d.maxMessages)
+	}
+}
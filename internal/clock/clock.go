@@ -0,0 +1,46 @@
+package clock
+
+import "time"
+
+// Clock tells time and creates timers
+// The game server takes a Clock instead of calling the time package directly
+// so tests can swap in a Fake and fast-forward timers
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks at intervals, like time.Ticker
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Real is the Clock backed by the time package
+type Real struct{}
+
+// New returns the real wall clock
+func New() Clock {
+	return Real{}
+}
+
+func (Real) Now() time.Time { return time.Now() }
+
+func (Real) Since(t time.Time) time.Duration { return time.Since(t) }
+
+func (Real) Sleep(d time.Duration) { time.Sleep(d) }
+
+func (Real) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+func (Real) NewTicker(d time.Duration) Ticker { return realTicker{time.NewTicker(d)} }
+
+type realTicker struct {
+	t *time.Ticker
+}
+
+func (r realTicker) C() <-chan time.Time { return r.t.C }
+
+func (r realTicker) Stop() { r.t.Stop() }
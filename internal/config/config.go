@@ -1,28 +1,154 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	_ "github.com/joho/godotenv/autoload"
 )
 
-// TODO: Add more configuration options as needed
+// Config holds every server setting
+// Settings come from Default, then the YAML or TOML file named by CONFIG_FILE,
+// then env vars (including .env), each overriding the one before
+// File keys are the env var names in lower case, e.g. ws_ping_interval for WS_PING_INTERVAL
 type Config struct {
-	// Logs  LogConfig
+	Logs LogConfig `yaml:"logs" toml:"logs"`
 	// DB    PostgresConfig
-	Port               string
-	SupabaseURL        string
-	SupabaseProjectRef string
-	SupabaseAnonKey    string
-	SupabaseSecretKey  string // Secret key for server-side operations (replaces legacy service_role)
-	// AllowedOrigin string
+	Port               string `yaml:"port" toml:"port"`
+	SupabaseURL        string `yaml:"supabase_url" toml:"supabase_url"`
+	SupabaseProjectRef string `yaml:"-" toml:"-"` // Taken from SupabaseURL
+	SupabaseAnonKey    string `yaml:"supabase_key" toml:"supabase_key"`
+	SupabaseSecretKey  string `yaml:"supabase_secret_key" toml:"supabase_secret_key"` // Secret key for server-side operations (replaces legacy service_role)
+
+	// Database backend. Only "supabase" (PostgREST) is supported so far
+	DBMode string `yaml:"db" toml:"db"`
+
+	// Origins browsers may call the server and open WebSockets from: exact origins like
+	// https://app.example.com, wildcard subdomains like https://*.example.com,
+	// "localhost" for any local port, or "*" for any origin
+	// With AllowCredentials, browsers also send cookies and auth headers cross-origin
+	AllowedOrigins   []string `yaml:"allowed_origin" toml:"allowed_origin"`
+	AllowCredentials bool     `yaml:"allow_credentials" toml:"allow_credentials"`
+
+	// HTTP server timeouts for reading a request and writing its response
+	// Hijacked WebSocket connections aren't affected
+	HTTPReadTimeout  time.Duration `yaml:"http_read_timeout" toml:"http_read_timeout"`
+	HTTPWriteTimeout time.Duration `yaml:"http_write_timeout" toml:"http_write_timeout"`
+
+	// Every route refuses bodies over HTTPBodyLimit bytes and gives up with a 503
+	// after HTTPHandlerTimeout, unless the route sets its own
+	HTTPBodyLimit      int64         `yaml:"http_body_limit" toml:"http_body_limit"`
+	HTTPHandlerTimeout time.Duration `yaml:"http_handler_timeout" toml:"http_handler_timeout"`
+
+	// WebSocket keepalive. A ping interval of 0 disables server pings
+	WSPingInterval time.Duration `yaml:"ws_ping_interval" toml:"ws_ping_interval"`
+	WSPingTimeout  time.Duration `yaml:"ws_ping_timeout" toml:"ws_ping_timeout"`
+
+	// Messages queued per subscriber before it's disconnected as too slow
+	WSMessageBuffer int `yaml:"ws_message_buffer" toml:"ws_message_buffer"`
+
+	// Publishing is limited to one message every PublishInterval, with bursts of PublishBurst
+	PublishInterval time.Duration `yaml:"publish_interval" toml:"publish_interval"`
+	PublishBurst    int           `yaml:"publish_burst" toml:"publish_burst"`
+
+	// Matchmaking pairs the lowest latency players in the queue window instead of first come first serve
+	MatchPreferLowLatency bool `yaml:"match_prefer_low_latency" toml:"match_prefer_low_latency"`
+	MatchmakingWindow     int  `yaml:"matchmaking_window" toml:"matchmaking_window"`
+
+	// Subscribers without a heartbeat or action for PresenceIdleTimeout are marked idle,
+	// checked every PresenceSweepInterval
+	PresenceIdleTimeout   time.Duration `yaml:"presence_idle_timeout" toml:"presence_idle_timeout"`
+	PresenceSweepInterval time.Duration `yaml:"presence_sweep_interval" toml:"presence_sweep_interval"`
+
+	// How far spectators lag behind live match state, to limit ghosting
+	SpectatorDelay time.Duration `yaml:"spectator_delay" toml:"spectator_delay"`
+
+	// Seeds the server RNG that match seeds are drawn from. 0 picks a random seed
+	GameSeed int64 `yaml:"game_seed" toml:"game_seed"`
+
+	// Match time control: main clock per player plus increment per move,
+	// and a per-turn limit after which an automatic action is played. 0 disables each
+	MatchClockBase      time.Duration `yaml:"match_clock_base" toml:"match_clock_base"`
+	MatchClockIncrement time.Duration `yaml:"match_clock_increment" toml:"match_clock_increment"`
+	MatchTurnTimeout    time.Duration `yaml:"match_turn_timeout" toml:"match_turn_timeout"`
+
+	// How long a disconnected player has to reconnect before forfeiting
+	MatchReconnectWindow time.Duration `yaml:"match_reconnect_window" toml:"match_reconnect_window"`
+
+	// How long the result is shown before players return to the lobby
+	MatchResultDelay time.Duration `yaml:"match_result_delay" toml:"match_result_delay"`
+
+	// How long both players have to accept a rematch. 0 disables rematch offers
+	MatchRematchTimeout time.Duration `yaml:"match_rematch_timeout" toml:"match_rematch_timeout"`
+
+	// How long a player has to answer a direct challenge
+	ChallengeTimeout time.Duration `yaml:"challenge_timeout" toml:"challenge_timeout"`
+
+	// Ranked seasons run back to back from SeasonStart, each SeasonLength long
+	SeasonStart  time.Time     `yaml:"season_start" toml:"season_start"`
+	SeasonLength time.Duration `yaml:"season_length" toml:"season_length"`
+
+	// Chat moderation. Blocked words are censored, or the message rejected if ChatCensorWords is off
+	ChatMaxLength    int      `yaml:"chat_max_length" toml:"chat_max_length"`
+	ChatBlockedWords []string `yaml:"chat_blocked_words" toml:"chat_blocked_words"`
+	ChatCensorWords  bool     `yaml:"chat_censor_words" toml:"chat_censor_words"`
+	ChatBlockLinks   bool     `yaml:"chat_block_links" toml:"chat_block_links"`
+
+	// Each sender may post ChatSpamMessages per ChatSpamWindow, and send the same
+	// message ChatSpamRepeats times in a row. 0 disables either limit
+	ChatSpamMessages int           `yaml:"chat_spam_messages" toml:"chat_spam_messages"`
+	ChatSpamRepeats  int           `yaml:"chat_spam_repeats" toml:"chat_spam_repeats"`
+	ChatSpamWindow   time.Duration `yaml:"chat_spam_window" toml:"chat_spam_window"`
+
+	// Chat history kept per lobby, by count and by age
+	ChatHistoryLimit int           `yaml:"chat_history_limit" toml:"chat_history_limit"`
+	ChatRetention    time.Duration `yaml:"chat_retention" toml:"chat_retention"`
+
+	// How long roles from the user_roles table are cached per user
+	RoleCacheTTL time.Duration `yaml:"role_cache_ttl" toml:"role_cache_ttl"`
+
+	// Supabase user that owns rows the server writes on its own behalf, like match results
+	ServicePrincipalID string `yaml:"service_principal_id" toml:"service_principal_id"`
+
+	// Enka.Network requests identify as EnkaUserAgent and give up after EnkaTimeout
+	EnkaUserAgent string        `yaml:"enka_user_agent" toml:"enka_user_agent"`
+	EnkaTimeout   time.Duration `yaml:"enka_timeout" toml:"enka_timeout"`
+
+	// Where trace spans are exported: "none", "otlp" or "stdout", and the fraction of traces kept
+	TraceExporter    string  `yaml:"trace_exporter" toml:"trace_exporter"`
+	TraceSampleRatio float64 `yaml:"trace_sample_ratio" toml:"trace_sample_ratio"`
+
+	// Readiness probes: how long each dependency has to respond, how long results
+	// are reused, and whether Enka.Network being down makes the server unready
+	HealthCheckTimeout time.Duration `yaml:"health_check_timeout" toml:"health_check_timeout"`
+	HealthCacheTTL     time.Duration `yaml:"health_cache_ttl" toml:"health_cache_ttl"`
+	HealthRequireEnka  bool          `yaml:"health_require_enka" toml:"health_require_enka"`
+
+	// Shutdown waits ShutdownDrainTimeout for matches to finish before snapshotting
+	// them, then ShutdownFlushTimeout for database writes. Clients are told to wait
+	// ShutdownReconnectDelay before reconnecting
+	ShutdownDrainTimeout   time.Duration `yaml:"shutdown_drain_timeout" toml:"shutdown_drain_timeout"`
+	ShutdownFlushTimeout   time.Duration `yaml:"shutdown_flush_timeout" toml:"shutdown_flush_timeout"`
+	ShutdownReconnectDelay time.Duration `yaml:"shutdown_reconnect_delay" toml:"shutdown_reconnect_delay"`
+
+	// Lobbies, the queue, matches in progress and tournaments are snapshotted every
+	// SnapshotInterval and on shutdown to SnapshotStore: "none", "file" (SnapshotPath,
+	// the default) or "db" (the server_snapshots row SnapshotKey). Snapshots older
+	// than SnapshotMaxAge are ignored on startup
+	SnapshotStore    string        `yaml:"snapshot_store" toml:"snapshot_store"`
+	SnapshotPath     string        `yaml:"snapshot_path" toml:"snapshot_path"`
+	SnapshotKey      string        `yaml:"snapshot_key" toml:"snapshot_key"`
+	SnapshotInterval time.Duration `yaml:"snapshot_interval" toml:"snapshot_interval"`
+	SnapshotMaxAge   time.Duration `yaml:"snapshot_max_age" toml:"snapshot_max_age"`
 }
 
-// type LogConfig struct {
-// 	Style string
-// 	Level string
-// }
+type LogConfig struct {
+	Style string `yaml:"style" toml:"style"` // "text" or "json"
+	Level string `yaml:"level" toml:"level"` // "debug", "info", "warn" or "error"
+}
 
 // type PostgresConfig struct {
 // 	Username string
@@ -31,40 +157,102 @@ type Config struct {
 // 	Port     string
 // }
 
-func LoadConfig() (*Config, error) {
-	port := os.Getenv("PORT")
-	anon_key := os.Getenv("SUPABASE_KEY")
-
-	supabaseURL := os.Getenv("SUPABASE_URL")
-	SupabaseSecretKey := os.Getenv("SUPABASE_SECRET_KEY")``
-
-	// Extract project ref key (strip protocol first)
-	projectRef := supabaseURL
-	// Remove https:// or http:// prefix
-	projectRef = strings.TrimPrefix(projectRef, "https://")
-	projectRef = strings.TrimPrefix(projectRef, "http://")
-	if idx := strings.Index(projectRef, ".supabase.co"); idx != -1 {
-		projectRef = projectRef[:idx]
+// Default returns the settings used when neither a config file nor env vars set them
+func Default() *Config {
+	return &Config{
+		Port:           "8282",
+		DBMode:         "supabase",
+		AllowedOrigins: []string{"localhost"},
+
+		HTTPReadTimeout:  time.Second * 10,
+		HTTPWriteTimeout: time.Second * 10,
+
+		HTTPBodyLimit:      1 << 16,
+		HTTPHandlerTimeout: time.Second * 8,
+
+		WSPingInterval:  time.Second * 20,
+		WSPingTimeout:   time.Second * 10,
+		WSMessageBuffer: 12,
+		PublishInterval: time.Millisecond * 100,
+		PublishBurst:    8,
+
+		MatchmakingWindow:     8,
+		PresenceIdleTimeout:   time.Minute * 2,
+		PresenceSweepInterval: time.Second * 15,
+
+		MatchClockBase:       time.Minute * 5,
+		MatchClockIncrement:  time.Second * 5,
+		MatchTurnTimeout:     time.Second * 30,
+		MatchReconnectWindow: time.Second * 30,
+		MatchResultDelay:     time.Second * 6,
+		MatchRematchTimeout:  time.Second * 15,
+		ChallengeTimeout:     time.Second * 30,
+
+		SeasonStart:  time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC),
+		SeasonLength: time.Hour * 24 * 91,
+
+		ChatMaxLength:    500,
+		ChatBlockedWords: []string{},
+		ChatCensorWords:  true,
+		ChatBlockLinks:   true,
+		ChatSpamMessages: 5,
+		ChatSpamRepeats:  2,
+		ChatSpamWindow:   time.Second * 10,
+		ChatHistoryLimit: 200,
+		ChatRetention:    time.Hour * 72,
+		RoleCacheTTL:     time.Minute,
+
+		EnkaUserAgent: "akasha-showdown/1.0",
+		EnkaTimeout:   time.Second * 10,
+
+		TraceExporter:      "none",
+		TraceSampleRatio:   1,
+		HealthCheckTimeout: time.Second * 2,
+		HealthCacheTTL:     time.Second * 5,
+
+		ShutdownDrainTimeout:   time.Second * 45,
+		ShutdownFlushTimeout:   time.Second * 10,
+		ShutdownReconnectDelay: time.Second * 5,
+
+		SnapshotStore:    "file",
+		SnapshotPath:     "snapshot.json",
+		SnapshotKey:      "default",
+		SnapshotInterval: time.Second * 15,
+		SnapshotMaxAge:   time.Minute * 10,
+
+		Logs: LogConfig{
+			Style: "text",
+			Level: "info",
+		},
 	}
+}
+
+// LoadConfig reads the config file and env vars over the defaults and validates the result
+// Every problem found is reported together, so one failed start shows them all
+func LoadConfig() (*Config, error) {
+	cfg := Default()
 
-	cfg := &Config{
-		Port:               port,
-		SupabaseURL:        supabaseURL,
-		SupabaseProjectRef: projectRef,
-		SupabaseAnonKey:    anon_key,
-		SupabaseSecretKey:  SupabaseSecretKey,
-		// Logs: LogConfig{
-		// 	Style: os.Getenv("LOG_STYLE"),
-		// 	Level: os.Getenv("LOG_LEVEL"),
-		// },
-		// DB: PostgresConfig{
-		// 	Username: os.Getenv("POSTGRES_USER"),
-		// 	Password: os.Getenv("POSTGRES_PWD"),
-		// 	URL:      os.Getenv("POSTGRES_URL"),
-		// 	Port:     os.Getenv("POSTGRES_PORT"),
-		// },
-		// AllowedOrigin: os.Getenv("ALLOWED_ORIGIN"),
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := loadFile(path, cfg); err != nil {
+			return nil, fmt.Errorf("config file %s: %w", path, err)
+		}
 	}
 
+	envErr := loadEnv(cfg)
+	cfg.SupabaseProjectRef = projectRef(cfg.SupabaseURL)
+
+	if err := errors.Join(envErr, cfg.Validate()); err != nil {
+		return nil, fmt.Errorf("invalid config:\n%w", err)
+	}
 	return cfg, nil
-}
\ No newline at end of file
+}
+
+// projectRef extracts the project ref from a Supabase URL like https://<ref>.supabase.co
+func projectRef(supabaseURL string) string {
+	ref := strings.TrimPrefix(supabaseURL, "https://")
+	ref = strings.TrimPrefix(ref, "http://")
+	if idx := strings.Index(ref, ".supabase.co"); idx != -1 {
+		ref = ref[:idx]
+	}
+	return ref
+}
@@ -0,0 +1,205 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// loadEnv overrides cfg with every env var that is set
+// Empty env vars count as unset, so a blank line in .env keeps the default
+func loadEnv(cfg *Config) error {
+	e := &envReader{}
+
+	e.string(&cfg.Port, "PORT")
+	e.string(&cfg.SupabaseURL, "SUPABASE_URL")
+	e.string(&cfg.SupabaseAnonKey, "SUPABASE_KEY")
+	e.string(&cfg.SupabaseSecretKey, "SUPABASE_SECRET_KEY")
+	e.string(&cfg.DBMode, "DB")
+	e.list(&cfg.AllowedOrigins, "ALLOWED_ORIGIN")
+	e.bool(&cfg.AllowCredentials, "ALLOW_CREDENTIALS")
+
+	e.duration(&cfg.HTTPReadTimeout, "HTTP_READ_TIMEOUT")
+	e.duration(&cfg.HTTPWriteTimeout, "HTTP_WRITE_TIMEOUT")
+	e.int64(&cfg.HTTPBodyLimit, "HTTP_BODY_LIMIT")
+	e.duration(&cfg.HTTPHandlerTimeout, "HTTP_HANDLER_TIMEOUT")
+
+	e.duration(&cfg.WSPingInterval, "WS_PING_INTERVAL")
+	e.duration(&cfg.WSPingTimeout, "WS_PING_TIMEOUT")
+	e.int(&cfg.WSMessageBuffer, "WS_MESSAGE_BUFFER")
+	e.duration(&cfg.PublishInterval, "PUBLISH_INTERVAL")
+	e.int(&cfg.PublishBurst, "PUBLISH_BURST")
+
+	e.bool(&cfg.MatchPreferLowLatency, "MATCH_PREFER_LOW_LATENCY")
+	e.int(&cfg.MatchmakingWindow, "MATCHMAKING_WINDOW")
+	e.duration(&cfg.PresenceIdleTimeout, "PRESENCE_IDLE_TIMEOUT")
+	e.duration(&cfg.PresenceSweepInterval, "PRESENCE_SWEEP_INTERVAL")
+	e.duration(&cfg.SpectatorDelay, "SPECTATOR_DELAY")
+	e.int64(&cfg.GameSeed, "GAME_SEED")
+
+	e.duration(&cfg.MatchClockBase, "MATCH_CLOCK_BASE")
+	e.duration(&cfg.MatchClockIncrement, "MATCH_CLOCK_INCREMENT")
+	e.duration(&cfg.MatchTurnTimeout, "MATCH_TURN_TIMEOUT")
+	e.duration(&cfg.MatchReconnectWindow, "MATCH_RECONNECT_WINDOW")
+	e.duration(&cfg.MatchResultDelay, "MATCH_RESULT_DELAY")
+	e.duration(&cfg.MatchRematchTimeout, "MATCH_REMATCH_TIMEOUT")
+	e.duration(&cfg.ChallengeTimeout, "CHALLENGE_TIMEOUT")
+
+	e.time(&cfg.SeasonStart, "SEASON_START")
+	e.duration(&cfg.SeasonLength, "SEASON_LENGTH")
+
+	e.int(&cfg.ChatMaxLength, "CHAT_MAX_LENGTH")
+	e.list(&cfg.ChatBlockedWords, "CHAT_BLOCKED_WORDS")
+	e.bool(&cfg.ChatCensorWords, "CHAT_CENSOR_WORDS")
+	e.bool(&cfg.ChatBlockLinks, "CHAT_BLOCK_LINKS")
+	e.int(&cfg.ChatSpamMessages, "CHAT_SPAM_MESSAGES")
+	e.int(&cfg.ChatSpamRepeats, "CHAT_SPAM_REPEATS")
+	e.duration(&cfg.ChatSpamWindow, "CHAT_SPAM_WINDOW")
+	e.int(&cfg.ChatHistoryLimit, "CHAT_HISTORY_LIMIT")
+	e.duration(&cfg.ChatRetention, "CHAT_RETENTION")
+	e.duration(&cfg.RoleCacheTTL, "ROLE_CACHE_TTL")
+
+	e.string(&cfg.ServicePrincipalID, "SERVICE_PRINCIPAL_ID")
+	e.string(&cfg.EnkaUserAgent, "ENKA_USER_AGENT")
+	e.duration(&cfg.EnkaTimeout, "ENKA_TIMEOUT")
+
+	e.string(&cfg.TraceExporter, "TRACE_EXPORTER")
+	e.float(&cfg.TraceSampleRatio, "TRACE_SAMPLE_RATIO")
+	e.duration(&cfg.HealthCheckTimeout, "HEALTH_CHECK_TIMEOUT")
+	e.duration(&cfg.HealthCacheTTL, "HEALTH_CACHE_TTL")
+	e.bool(&cfg.HealthRequireEnka, "HEALTH_REQUIRE_ENKA")
+
+	e.duration(&cfg.ShutdownDrainTimeout, "SHUTDOWN_DRAIN_TIMEOUT")
+	e.duration(&cfg.ShutdownFlushTimeout, "SHUTDOWN_FLUSH_TIMEOUT")
+	e.duration(&cfg.ShutdownReconnectDelay, "SHUTDOWN_RECONNECT_DELAY")
+
+	e.string(&cfg.SnapshotStore, "SNAPSHOT_STORE")
+	e.string(&cfg.SnapshotPath, "SNAPSHOT_PATH")
+	e.string(&cfg.SnapshotKey, "SNAPSHOT_KEY")
+	e.duration(&cfg.SnapshotInterval, "SNAPSHOT_INTERVAL")
+	e.duration(&cfg.SnapshotMaxAge, "SNAPSHOT_MAX_AGE")
+
+	e.string(&cfg.Logs.Style, "LOG_STYLE")
+	e.string(&cfg.Logs.Level, "LOG_LEVEL")
+
+	return errors.Join(e.errs...)
+}
+
+// envReader sets config fields from env vars, collecting every value it can't parse
+type envReader struct {
+	errs []error
+}
+
+// lookup returns an env var, reporting false if it's unset or empty
+func (e *envReader) lookup(key string) (string, bool) {
+	v := strings.TrimSpace(os.Getenv(key))
+	return v, v != ""
+}
+
+func (e *envReader) fail(key, v, want string) {
+	e.errs = append(e.errs, fmt.Errorf("%s=%q is not %s", key, v, want))
+}
+
+func (e *envReader) string(dst *string, key string) {
+	if v, ok := e.lookup(key); ok {
+		*dst = v
+	}
+}
+
+// duration parses durations like "20s" or "1h30m"
+func (e *envReader) duration(dst *time.Duration, key string) {
+	v, ok := e.lookup(key)
+	if !ok {
+		return
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		e.fail(key, v, `a duration like "20s"`)
+		return
+	}
+	*dst = d
+}
+
+// time parses RFC 3339 timestamps
+func (e *envReader) time(dst *time.Time, key string) {
+	v, ok := e.lookup(key)
+	if !ok {
+		return
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		e.fail(key, v, `an RFC 3339 time like "2025-01-01T00:00:00Z"`)
+		return
+	}
+	*dst = t
+}
+
+func (e *envReader) int(dst *int, key string) {
+	v, ok := e.lookup(key)
+	if !ok {
+		return
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		e.fail(key, v, "an integer")
+		return
+	}
+	*dst = n
+}
+
+func (e *envReader) int64(dst *int64, key string) {
+	v, ok := e.lookup(key)
+	if !ok {
+		return
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		e.fail(key, v, "an integer")
+		return
+	}
+	*dst = n
+}
+
+func (e *envReader) float(dst *float64, key string) {
+	v, ok := e.lookup(key)
+	if !ok {
+		return
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		e.fail(key, v, "a number")
+		return
+	}
+	*dst = f
+}
+
+func (e *envReader) bool(dst *bool, key string) {
+	v, ok := e.lookup(key)
+	if !ok {
+		return
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		e.fail(key, v, "true or false")
+		return
+	}
+	*dst = b
+}
+
+// list splits a comma separated env var, dropping empty entries
+func (e *envReader) list(dst *[]string, key string) {
+	v, ok := e.lookup(key)
+	if !ok {
+		return
+	}
+	list := make([]string, 0)
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	*dst = list
+}
@@ -0,0 +1,156 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vindennt/akasha-showdown-engine/internal/origin"
+)
+
+// Validate reports every setting that is missing or out of range, named by its env var
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	if n, err := strconv.Atoi(c.Port); err != nil || n < 1 || n > 65535 {
+		v.fail("PORT=%q must be a port number from 1 to 65535", c.Port)
+	}
+	if u, err := url.Parse(c.SupabaseURL); c.SupabaseURL == "" || err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.fail("SUPABASE_URL=%q must be an http or https URL", c.SupabaseURL)
+	}
+	v.required(c.SupabaseAnonKey, "SUPABASE_KEY")
+	v.required(c.SupabaseSecretKey, "SUPABASE_SECRET_KEY")
+	v.oneOf(c.DBMode, "DB", "supabase")
+
+	if len(c.AllowedOrigins) == 0 {
+		v.fail("ALLOWED_ORIGIN must be set")
+	}
+	if _, err := origin.New(c.AllowedOrigins, c.AllowCredentials); err != nil {
+		v.fail("ALLOWED_ORIGIN: %w", err)
+	}
+
+	v.positive(c.HTTPReadTimeout, "HTTP_READ_TIMEOUT")
+	v.positive(c.HTTPWriteTimeout, "HTTP_WRITE_TIMEOUT")
+	if c.HTTPBodyLimit < 1 {
+		v.fail("HTTP_BODY_LIMIT=%d must be at least 1", c.HTTPBodyLimit)
+	}
+	v.positive(c.HTTPHandlerTimeout, "HTTP_HANDLER_TIMEOUT")
+
+	v.notNegative(c.WSPingInterval, "WS_PING_INTERVAL")
+	if c.WSPingInterval > 0 {
+		v.positive(c.WSPingTimeout, "WS_PING_TIMEOUT")
+		// Pings don't overlap, so a longer timeout would delay the next one
+		if c.WSPingTimeout >= c.WSPingInterval {
+			v.fail("WS_PING_TIMEOUT=%v must be less than WS_PING_INTERVAL=%v", c.WSPingTimeout, c.WSPingInterval)
+		}
+	}
+	v.atLeast(c.WSMessageBuffer, 1, "WS_MESSAGE_BUFFER")
+	v.positive(c.PublishInterval, "PUBLISH_INTERVAL")
+	v.atLeast(c.PublishBurst, 1, "PUBLISH_BURST")
+
+	v.atLeast(c.MatchmakingWindow, 1, "MATCHMAKING_WINDOW")
+	v.positive(c.PresenceIdleTimeout, "PRESENCE_IDLE_TIMEOUT")
+	v.positive(c.PresenceSweepInterval, "PRESENCE_SWEEP_INTERVAL")
+	v.notNegative(c.SpectatorDelay, "SPECTATOR_DELAY")
+
+	v.notNegative(c.MatchClockBase, "MATCH_CLOCK_BASE")
+	v.notNegative(c.MatchClockIncrement, "MATCH_CLOCK_INCREMENT")
+	v.notNegative(c.MatchTurnTimeout, "MATCH_TURN_TIMEOUT")
+	v.positive(c.MatchReconnectWindow, "MATCH_RECONNECT_WINDOW")
+	v.notNegative(c.MatchResultDelay, "MATCH_RESULT_DELAY")
+	v.notNegative(c.MatchRematchTimeout, "MATCH_REMATCH_TIMEOUT")
+	v.positive(c.ChallengeTimeout, "CHALLENGE_TIMEOUT")
+
+	if c.SeasonStart.IsZero() {
+		v.fail("SEASON_START must be set")
+	}
+	v.positive(c.SeasonLength, "SEASON_LENGTH")
+
+	v.atLeast(c.ChatMaxLength, 1, "CHAT_MAX_LENGTH")
+	v.atLeast(c.ChatSpamMessages, 0, "CHAT_SPAM_MESSAGES")
+	v.atLeast(c.ChatSpamRepeats, 0, "CHAT_SPAM_REPEATS")
+	if c.ChatSpamMessages > 0 || c.ChatSpamRepeats > 0 {
+		v.positive(c.ChatSpamWindow, "CHAT_SPAM_WINDOW")
+	}
+	v.atLeast(c.ChatHistoryLimit, 0, "CHAT_HISTORY_LIMIT")
+	v.notNegative(c.ChatRetention, "CHAT_RETENTION")
+	v.notNegative(c.RoleCacheTTL, "ROLE_CACHE_TTL")
+	if err := uuid.Validate(c.ServicePrincipalID); err != nil {
+		v.fail("SERVICE_PRINCIPAL_ID=%q must be a Supabase user ID", c.ServicePrincipalID)
+	}
+
+	v.required(c.EnkaUserAgent, "ENKA_USER_AGENT")
+	v.positive(c.EnkaTimeout, "ENKA_TIMEOUT")
+
+	v.oneOf(c.TraceExporter, "TRACE_EXPORTER", "none", "otlp", "stdout")
+	if c.TraceSampleRatio < 0 || c.TraceSampleRatio > 1 {
+		v.fail("TRACE_SAMPLE_RATIO=%v must be from 0 to 1", c.TraceSampleRatio)
+	}
+	v.positive(c.HealthCheckTimeout, "HEALTH_CHECK_TIMEOUT")
+	v.notNegative(c.HealthCacheTTL, "HEALTH_CACHE_TTL")
+
+	v.notNegative(c.ShutdownDrainTimeout, "SHUTDOWN_DRAIN_TIMEOUT")
+	v.positive(c.ShutdownFlushTimeout, "SHUTDOWN_FLUSH_TIMEOUT")
+	v.notNegative(c.ShutdownReconnectDelay, "SHUTDOWN_RECONNECT_DELAY")
+
+	v.oneOf(c.SnapshotStore, "SNAPSHOT_STORE", "none", "file", "db")
+	switch c.SnapshotStore {
+	case "file":
+		v.required(c.SnapshotPath, "SNAPSHOT_PATH")
+	case "db":
+		v.required(c.SnapshotKey, "SNAPSHOT_KEY")
+	}
+	if c.SnapshotStore != "none" {
+		v.positive(c.SnapshotInterval, "SNAPSHOT_INTERVAL")
+		v.positive(c.SnapshotMaxAge, "SNAPSHOT_MAX_AGE")
+	}
+
+	v.oneOf(c.Logs.Style, "LOG_STYLE", "text", "json")
+	v.oneOf(c.Logs.Level, "LOG_LEVEL", "debug", "info", "warn", "error")
+
+	return errors.Join(v.errs...)
+}
+
+// validator collects every validation failure instead of stopping at the first
+type validator struct {
+	errs []error
+}
+
+func (v *validator) fail(format string, args ...any) {
+	v.errs = append(v.errs, fmt.Errorf(format, args...))
+}
+
+func (v *validator) required(value, key string) {
+	if value == "" {
+		v.fail("%s must be set", key)
+	}
+}
+
+func (v *validator) oneOf(value, key string, allowed ...string) {
+	if !slices.Contains(allowed, value) {
+		v.fail("%s=%q must be one of %s", key, value, strings.Join(allowed, ", "))
+	}
+}
+
+func (v *validator) positive(d time.Duration, key string) {
+	if d <= 0 {
+		v.fail("%s=%v must be more than 0", key, d)
+	}
+}
+
+func (v *validator) notNegative(d time.Duration, key string) {
+	if d < 0 {
+		v.fail("%s=%v must not be negative", key, d)
+	}
+}
+
+func (v *validator) atLeast(n, least int, key string) {
+	if n < least {
+		v.fail("%s=%d must be at least %d", key, n, least)
+	}
+}
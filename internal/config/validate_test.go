@@ -0,0 +1,80 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// validConfig returns the defaults plus the settings that have none
+func validConfig() *Config {
+	cfg := Default()
+	cfg.SupabaseURL = "https://project.supabase.co"
+	cfg.SupabaseAnonKey = "anon"
+	cfg.SupabaseSecretKey = "secret"
+	cfg.ServicePrincipalID = "6f1c1f5e-8d3a-4a53-9b8e-2b1f3f2a9c10"
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		want   []string // Substrings of the error, none if valid
+	}{
+		{"defaults", func(c *Config) {}, nil},
+		{"port out of range", func(c *Config) { c.Port = "70000" }, []string{"PORT="}},
+		{"port not a number", func(c *Config) { c.Port = "http" }, []string{"PORT="}},
+		{"supabase url without scheme", func(c *Config) { c.SupabaseURL = "project.supabase.co" }, []string{"SUPABASE_URL="}},
+		{"missing keys", func(c *Config) { c.SupabaseAnonKey, c.SupabaseSecretKey = "", "" }, []string{"SUPABASE_KEY must be set", "SUPABASE_SECRET_KEY must be set"}},
+		{"unknown db mode", func(c *Config) { c.DBMode = "postgres" }, []string{"DB="}},
+		{"no origins", func(c *Config) { c.AllowedOrigins = nil }, []string{"ALLOWED_ORIGIN must be set"}},
+		{"any origin with credentials", func(c *Config) {
+			c.AllowedOrigins = []string{"*"}
+			c.AllowCredentials = true
+		}, []string{"ALLOWED_ORIGIN:"}},
+		{"zero body limit", func(c *Config) { c.HTTPBodyLimit = 0 }, []string{"HTTP_BODY_LIMIT="}},
+		{"pings disabled", func(c *Config) { c.WSPingInterval, c.WSPingTimeout = 0, 0 }, nil},
+		{"negative ping interval", func(c *Config) { c.WSPingInterval = -time.Second }, []string{"WS_PING_INTERVAL="}},
+		{"ping timeout as long as interval", func(c *Config) { c.WSPingTimeout = c.WSPingInterval }, []string{"WS_PING_TIMEOUT="}},
+		{"no reconnect window", func(c *Config) { c.MatchReconnectWindow = 0 }, []string{"MATCH_RECONNECT_WINDOW="}},
+		{"spam window needed", func(c *Config) { c.ChatSpamWindow = 0 }, []string{"CHAT_SPAM_WINDOW="}},
+		{"spam limits off", func(c *Config) { c.ChatSpamMessages, c.ChatSpamRepeats, c.ChatSpamWindow = 0, 0, 0 }, nil},
+		{"service principal not a user ID", func(c *Config) { c.ServicePrincipalID = "server" }, []string{"SERVICE_PRINCIPAL_ID="}},
+		{"missing service principal", func(c *Config) { c.ServicePrincipalID = "" }, []string{"SERVICE_PRINCIPAL_ID="}},
+		{"sample ratio above 1", func(c *Config) { c.TraceSampleRatio = 1.5 }, []string{"TRACE_SAMPLE_RATIO="}},
+		{"file snapshots need a path", func(c *Config) {
+			c.SnapshotStore = "file"
+			c.SnapshotPath = ""
+		}, []string{"SNAPSHOT_PATH must be set"}},
+		{"unknown log level", func(c *Config) { c.Logs.Level = "trace" }, []string{"LOG_LEVEL="}},
+		{"every failure reported", func(c *Config) {
+			c.Port = ""
+			c.SupabaseAnonKey = ""
+			c.Logs.Style = "xml"
+		}, []string{"PORT=", "SUPABASE_KEY must be set", "LOG_STYLE="}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.modify(cfg)
+			err := cfg.Validate()
+
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() = nil, want errors containing %q", tt.want)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate() = %v, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
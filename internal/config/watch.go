@@ -0,0 +1,59 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Editors often save with several writes or a rename, so changes are
+// only reported once the file has been quiet this long
+const watchSettle = time.Millisecond * 500
+
+// Watch calls changed whenever the config file at path is written, replaced or
+// recreated, until ctx is done
+// The directory is watched rather than the file, so replacing the file by rename
+// as many editors do keeps being noticed
+func Watch(ctx context.Context, path string, changed func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	path = filepath.Clean(path)
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	go func() {
+		defer watcher.Close()
+
+		settle := time.NewTimer(0)
+		<-settle.C
+		for {
+			select {
+			case <-ctx.Done():
+				settle.Stop()
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) == path && event.Has(fsnotify.Write|fsnotify.Create|fsnotify.Rename) {
+					settle.Reset(watchSettle)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				slog.Warn("Config file watch error", "path", path, "error", err)
+			case <-settle.C:
+				changed()
+			}
+		}
+	}()
+	return nil
+}
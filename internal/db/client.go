@@ -1,14 +1,21 @@
 package db
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+
 	"github.com/supabase-community/postgrest-go"
 	"github.com/vindennt/akasha-showdown-engine/internal/config"
+	"github.com/vindennt/akasha-showdown-engine/internal/metrics"
+	"github.com/vindennt/akasha-showdown-engine/internal/tracing"
 )
 
 type Client struct {
 	baseURL   string
 	anonKey   string
 	secretKey string
+	transport http.RoundTripper // Shared by every PostgREST client, records latency, errors and spans
 }
 
 func NewClient(cfg *config.Config) *Client {
@@ -16,6 +23,7 @@ func NewClient(cfg *config.Config) *Client {
 		baseURL:   cfg.SupabaseURL,
 		anonKey:   cfg.SupabaseAnonKey,
 		secretKey: cfg.SupabaseSecretKey,
+		transport: tracing.Transport("postgrest", metrics.Transport("postgrest", nil)),
 	}
 }
 
@@ -29,6 +37,9 @@ func (c *Client) GetUserClient(token string) *postgrest.Client {
 	}
 	
 	client := postgrest.NewClient(restURL, "", headers)
+	if client.Transport != nil {
+		client.Transport.Parent = c.transport
+	}
 	
 	// Fallback
 	if token != "" {
@@ -51,7 +62,30 @@ func (c *Client) GetSystemClient() *postgrest.Client {
 	}
 	
 	client := postgrest.NewClient(restURL, "", headers)
+	if client.Transport != nil {
+		client.Transport.Parent = c.transport
+	}
 	client.SetAuthToken(authKey)
 	
 	return client
 }
+
+// Ping checks that PostgREST is reachable and accepts the secret key
+func (c *Client) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.baseURL+"/rest/v1/", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("apikey", c.secretKey)
+	req.Header.Set("Authorization", "Bearer "+c.secretKey)
+
+	resp, err := c.transport.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("postgrest responded %s", resp.Status)
+	}
+	return nil
+}
@@ -2,29 +2,65 @@ package enka
 
 import (
 	"context"
+	"fmt"
+	"net/http"
 	"time"
 
 	"github.com/kirinyoku/enkanetwork-go/client/genshin"
+	"github.com/vindennt/akasha-showdown-engine/internal/metrics"
+	"github.com/vindennt/akasha-showdown-engine/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// Checked by Ping
+const pingURL = "https://enka.network/"
+
 type Client struct {
-	api *genshin.Client
+	api     *genshin.Client
+	http    *http.Client
+	timeout time.Duration // For requests whose context has no deadline
 }
 
-func NewClient(userAgent string) *Client {
+func NewClient(userAgent string, timeout time.Duration) *Client {
 	// TODO: add caching for data
-	api := genshin.NewClient(nil, nil, userAgent)
+	httpClient := &http.Client{Transport: tracing.Transport("enka", metrics.Transport("enka", nil))}
+	api := genshin.NewClient(httpClient, nil, userAgent)
 	return &Client{
-		api: api,
+		api:     api,
+		http:    httpClient,
+		timeout: timeout,
 	}
 }
 
 func (c *Client) GetPlayerInfo(ctx context.Context, uid string) (*genshin.Profile, error) {
+	ctx, span := tracing.Start(ctx, "enka.GetPlayerInfo")
+	span.SetAttributes(attribute.String("enka.uid", uid))
+
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, 10*time.Second)
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
 		defer cancel()
 	}
 
-	return c.api.GetProfile(ctx, uid)
+	profile, err := c.api.GetProfile(ctx, uid)
+	tracing.End(span, err)
+	return profile, err
+}
+
+// Ping checks that Enka.Network is reachable
+func (c *Client) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, pingURL, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("enka responded %s", resp.Status)
+	}
+	return nil
 }
@@ -0,0 +1,174 @@
+package game
+
+import (
+	"math/rand"
+	"slices"
+	"strings"
+)
+
+// Draft is a duel preceded by a ban and pick phase over the element roster.
+// Each player bans one element, then the second player picks first to make up
+// for moving second. Bans carried in from earlier games in a series stay banned.
+// Actions during the draft are "ban:<element>" and "pick:<element>".
+const (
+	PhaseBan    = "ban"
+	PhasePick   = "pick"
+	PhaseBattle = "battle"
+
+	actionBan  = "ban"
+	actionPick = "pick"
+)
+
+// Only the most recent bans carry so there are always enough elements to pick
+var maxCarriedBans = len(Roster) - 4
+
+type DraftState struct {
+	Mode     string     `json:"mode"`
+	Phase    string     `json:"phase"`
+	Active   int        `json:"active"`
+	Players  [2]int     `json:"players"`
+	Carried  []string   `json:"carried_bans"` // From earlier games in the series
+	Bans     []string   `json:"bans"`         // This game, in ban order
+	Picks    [2]string  `json:"picks"`
+	Battle   *DuelState `json:"battle,omitempty"`
+	Finished bool       `json:"finished"`
+	WinnerID int        `json:"winner_id"` // Only valid once finished
+}
+
+type Draft struct {
+	state DraftState
+	duel  *Duel
+	rng   *rand.Rand
+}
+
+// NewDraft creates a draft where the first player bans first and moves first in battle
+func NewDraft(players [2]int, rng *rand.Rand, opts Options) Engine {
+	carried := opts.Bans
+	if len(carried) > maxCarriedBans {
+		carried = carried[len(carried)-maxCarriedBans:]
+	}
+
+	return &Draft{
+		rng: rng,
+		state: DraftState{
+			Mode:    "draft",
+			Phase:   PhaseBan,
+			Active:  players[0],
+			Players: players,
+			Carried: append([]string(nil), carried...),
+			Bans:    make([]string, 0, 2),
+		},
+	}
+}
+
+func (d *Draft) Mode() string { return d.state.Mode }
+
+func (d *Draft) State() any {
+	state := d.state
+	if d.duel != nil {
+		battle := d.duel.state
+		state.Battle = &battle
+	}
+	return state
+}
+
+func (d *Draft) Finished() bool { return d.state.Finished }
+
+func (d *Draft) Winner() int { return d.state.WinnerID }
+
+func (d *Draft) Active() int {
+	if d.duel != nil {
+		return d.duel.Active()
+	}
+	return d.state.Active
+}
+
+// Bans returns carried and new bans, oldest first
+func (d *Draft) Bans() []string {
+	return append(append([]string(nil), d.state.Carried...), d.state.Bans...)
+}
+
+// TimeoutAction bans or picks the first available element, or guards in battle
+func (d *Draft) TimeoutAction() string {
+	switch d.state.Phase {
+	case PhaseBan:
+		return actionBan + ":" + d.available()[0]
+	case PhasePick:
+		return actionPick + ":" + d.available()[0]
+	default:
+		return d.duel.TimeoutAction()
+	}
+}
+
+func (d *Draft) Apply(cmd Command) error {
+	if d.state.Finished {
+		return ErrMatchFinished
+	}
+
+	self := slices.Index(d.state.Players[:], cmd.PlayerID)
+	if self < 0 {
+		return ErrNotInMatch
+	}
+
+	if d.state.Phase == PhaseBattle {
+		if err := d.duel.Apply(cmd); err != nil {
+			return err
+		}
+		d.state.Active = d.duel.Active()
+		d.state.Finished = d.duel.Finished()
+		d.state.WinnerID = d.duel.Winner()
+		return nil
+	}
+
+	if cmd.Action == ActionForfeit {
+		d.state.Finished = true
+		d.state.WinnerID = d.state.Players[1-self]
+		return nil
+	}
+
+	if cmd.PlayerID != d.state.Active {
+		return ErrNotYourTurn
+	}
+
+	kind, element, ok := strings.Cut(cmd.Action, ":")
+	if !ok || !slices.Contains(d.available(), element) {
+		return ErrInvalidAction
+	}
+
+	first, second := d.state.Players[0], d.state.Players[1]
+
+	switch {
+	case d.state.Phase == PhaseBan && kind == actionBan:
+		// Second player bans next, then picks first
+		d.state.Bans = append(d.state.Bans, element)
+		d.state.Active = second
+		if len(d.state.Bans) == 2 {
+			d.state.Phase = PhasePick
+		}
+	case d.state.Phase == PhasePick && kind == actionPick:
+		d.state.Picks[self] = element
+		if d.state.Picks[0] != "" && d.state.Picks[1] != "" {
+			d.state.Phase = PhaseBattle
+			d.duel = newDuel(d.state.Mode, d.state.Players, d.state.Picks, d.rng)
+			d.state.Active = d.duel.Active()
+		} else {
+			d.state.Active = first
+		}
+	default:
+		return ErrInvalidAction
+	}
+
+	return nil
+}
+
+// available returns elements that are not banned or picked, in roster order
+func (d *Draft) available() []string {
+	out := make([]string, 0, len(Roster))
+	for _, e := range Roster {
+		if slices.Contains(d.state.Carried, e) || slices.Contains(d.state.Bans, e) || slices.Contains(d.state.Picks[:], e) {
+			continue
+		}
+		out = append(out, e)
+	}
+	return out
+}
@@ -0,0 +1,150 @@
+package game
+
+import "math/rand"
+
+// Duel is a turn-based 1v1. Players alternate turns, each either attacking,
+// guarding to halve the next hit, or spending energy on a burst.
+// The first player to drop to 0 HP loses.
+const (
+	duelBurstCost = 3
+
+	ActionAttack = "attack"
+	ActionGuard  = "guard"
+	ActionBurst  = "burst"
+)
+
+type DuelPlayer struct {
+	ID       int    `json:"id"`
+	Element  string `json:"element,omitempty"` // Set in draft mode
+	HP       int    `json:"hp"`
+	MaxHP    int    `json:"max_hp"`
+	Energy   int    `json:"energy"`
+	Guarding bool   `json:"guarding"`
+}
+
+type DuelState struct {
+	Mode       string        `json:"mode"`
+	Turn       int           `json:"turn"`   // Starts at 1
+	Active     int           `json:"active"` // Player id to move
+	Players    [2]DuelPlayer `json:"players"`
+	LastAction string        `json:"last_action,omitempty"`
+	LastDamage int           `json:"last_damage,omitempty"`
+	Finished   bool          `json:"finished"`
+	WinnerID   int           `json:"winner_id"` // Only valid once finished
+}
+
+type Duel struct {
+	state DuelState
+	rng   *rand.Rand
+}
+
+// NewDuel creates a duel where the first player moves first
+func NewDuel(players [2]int, rng *rand.Rand, opts Options) Engine {
+	return newDuel("duel", players, [2]string{}, rng)
+}
+
+// newDuel creates a duel with each player fighting as an element
+// An empty element uses the neutral stats
+func newDuel(mode string, players [2]int, elements [2]string, rng *rand.Rand) *Duel {
+	d := &Duel{rng: rng}
+	d.state = DuelState{
+		Mode:   mode,
+		Turn:   1,
+		Active: players[0],
+	}
+	for i, id := range players {
+		hp := statsFor(elements[i]).MaxHP
+		d.state.Players[i] = DuelPlayer{ID: id, Element: elements[i], HP: hp, MaxHP: hp}
+	}
+	return d
+}
+
+func (d *Duel) Mode() string { return d.state.Mode }
+
+func (d *Duel) State() any { return d.state }
+
+func (d *Duel) Finished() bool { return d.state.Finished }
+
+func (d *Duel) Winner() int { return d.state.WinnerID }
+
+func (d *Duel) Active() int { return d.state.Active }
+
+// Guarding is the safest move for a player who ran out of time
+func (d *Duel) TimeoutAction() string { return ActionGuard }
+
+func (d *Duel) Apply(cmd Command) error {
+	if d.state.Finished {
+		return ErrMatchFinished
+	}
+
+	self := d.playerIndex(cmd.PlayerID)
+	if self < 0 {
+		return ErrNotInMatch
+	}
+
+	// Either player can forfeit, even on the opponent's turn
+	if cmd.Action == ActionForfeit {
+		d.state.LastAction = cmd.Action
+		d.state.LastDamage = 0
+		d.state.Finished = true
+		d.state.WinnerID = d.state.Players[1-self].ID
+		return nil
+	}
+
+	if cmd.PlayerID != d.state.Active {
+		return ErrNotYourTurn
+	}
+
+	me := &d.state.Players[self]
+	opp := &d.state.Players[1-self]
+
+	stats := statsFor(me.Element)
+	damage := 0
+	switch cmd.Action {
+	case ActionAttack:
+		damage = stats.Attack.roll(d.rng)
+		me.Energy++
+	case ActionGuard:
+		me.Guarding = true
+		me.Energy++
+	case ActionBurst:
+		if me.Energy < duelBurstCost {
+			return ErrInvalidAction
+		}
+		damage = stats.Burst.roll(d.rng)
+		me.Energy -= duelBurstCost
+	default:
+		return ErrInvalidAction
+	}
+
+	if damage > 0 && opp.Guarding {
+		damage /= 2
+	}
+	opp.HP = max(opp.HP-damage, 0)
+
+	d.state.LastAction = cmd.Action
+	d.state.LastDamage = damage
+
+	if opp.HP == 0 {
+		d.state.Finished = true
+		d.state.WinnerID = me.ID
+		return nil
+	}
+
+	// Pass the turn. Guard lasts until the guarding player's next turn
+	d.state.Turn++
+	d.state.Active = opp.ID
+	opp.Guarding = false
+
+	return nil
+}
+
+// playerIndex returns 0 or 1 for a player in the duel, -1 otherwise
+func (d *Duel) playerIndex(id int) int {
+	for i, p := range d.state.Players {
+		if p.ID == id {
+			return i
+		}
+	}
+	return -1
+}
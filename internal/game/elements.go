@@ -0,0 +1,44 @@
+package game
+
+import "math/rand"
+
+// Elements players can draft, in roster order
+var Roster = []string{"pyro", "hydro", "electro", "cryo", "anemo", "geo", "dendro"}
+
+// damageRange is an inclusive min-max roll
+type damageRange struct {
+	Min int
+	Max int
+}
+
+func (r damageRange) roll(rng *rand.Rand) int {
+	return r.Min + rng.Intn(r.Max-r.Min+1)
+}
+
+type elementStats struct {
+	MaxHP  int
+	Attack damageRange
+	Burst  damageRange
+}
+
+// Neutral stats, used by the plain duel
+var neutralStats = elementStats{MaxHP: 100, Attack: damageRange{8, 14}, Burst: damageRange{20, 30}}
+
+// Each element trades HP against damage
+var elementTable = map[string]elementStats{
+	"pyro":    {MaxHP: 90, Attack: damageRange{10, 16}, Burst: damageRange{24, 32}},
+	"hydro":   {MaxHP: 110, Attack: damageRange{8, 12}, Burst: damageRange{18, 26}},
+	"electro": {MaxHP: 100, Attack: damageRange{7, 17}, Burst: damageRange{18, 32}},
+	"cryo":    {MaxHP: 100, Attack: damageRange{8, 13}, Burst: damageRange{24, 30}},
+	"anemo":   {MaxHP: 105, Attack: damageRange{9, 13}, Burst: damageRange{20, 28}},
+	"geo":     {MaxHP: 120, Attack: damageRange{7, 11}, Burst: damageRange{16, 24}},
+	"dendro":  {MaxHP: 105, Attack: damageRange{8, 14}, Burst: damageRange{20, 28}},
+}
+
+// statsFor returns an element's stats, or the neutral stats for no element
+func statsFor(element string) elementStats {
+	if stats, ok := elementTable[element]; ok {
+		return stats
+	}
+	return neutralStats
+}
@@ -0,0 +1,95 @@
+// Package game runs match rules behind the Engine interface
+// Matches used to be decided by a coin flip with nothing to watch, so
+// spectating needed real turn-by-turn state. The ws package only depends on
+// Engine; new modes are added here without touching match handling
+package game
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+)
+
+// DefaultMode is used when a match doesn't ask for a specific mode
+const DefaultMode = "duel"
+
+// ActionForfeit ends the match with the other player winning
+// Every engine must accept it from either player at any time
+const ActionForfeit = "forfeit"
+
+var (
+	ErrMatchFinished = errors.New("match is already finished")
+	ErrNotInMatch    = errors.New("player is not in this match")
+	ErrNotYourTurn   = errors.New("not your turn")
+	ErrInvalidAction = errors.New("invalid action")
+)
+
+// Options are per-match settings passed to the engine
+// They are recorded in the replay so the match can be rebuilt
+type Options struct {
+	// Bans carried in from earlier games of a series, for engines with a draft
+	Bans []string `json:"bans,omitempty"`
+}
+
+// Command is a player action submitted during a match
+type Command struct {
+	PlayerID int    `json:"player_id"`
+	Action   string `json:"action"`
+}
+
+// Engine runs the rules of a single match
+// Engines are not safe for concurrent use; callers serialize access
+type Engine interface {
+	// Mode returns the name the engine is registered under
+	Mode() string
+
+	// Apply validates a command and applies it to the state
+	// Returns an error and leaves the state untouched if the command is rejected
+	Apply(cmd Command) error
+
+	// Active returns the player id expected to move next
+	Active() int
+
+	// TimeoutAction returns the action played for the active player when their turn times out
+	TimeoutAction() string
+
+	// State returns a JSON serializable snapshot of the current state
+	State() any
+
+	// Finished reports whether the match is over
+	Finished() bool
+
+	// Winner returns the winning player id. Only valid once Finished
+	Winner() int
+}
+
+// Drafter is implemented by engines with a ban phase
+// Bans returns every ban in effect, so a series can carry them into the next game
+type Drafter interface {
+	Bans() []string
+}
+
+// Factory creates an engine for two players
+// All randomness must come from rng so matches can be reproduced
+type Factory func(players [2]int, rng *rand.Rand, opts Options) Engine
+
+// Registered engines by mode name
+var modes = map[string]Factory{
+	"duel":  NewDuel,
+	"draft": NewDraft,
+}
+
+// New creates an engine for the given mode
+func New(mode string, players [2]int, rng *rand.Rand, opts Options) (Engine, error) {
+	factory, ok := modes[mode]
+	if !ok {
+		return nil, fmt.Errorf("unknown game mode %q", mode)
+	}
+	return factory(players, rng, opts), nil
+}
+
+// ValidMode reports whether mode has a registered engine
+func ValidMode(mode string) bool {
+	_, ok := modes[mode]
+	return ok
+}
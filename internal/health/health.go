@@ -0,0 +1,193 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Probe checks that a dependency is reachable. It should give up when ctx is done
+type Probe func(ctx context.Context) error
+
+// Status is the result of one dependency's last probe
+type Status struct {
+	Name      string    `json:"name"`
+	Healthy   bool      `json:"healthy"`
+	Required  bool      `json:"required"` // Whether the server is unready while it's down
+	LatencyMS int64     `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+type dependency struct {
+	name     string
+	required bool
+	probe    Probe
+}
+
+// Checker probes the server's dependencies for readiness
+// Results are cached for a while so frequent readiness checks don't hammer them
+type Checker struct {
+	timeout  time.Duration // Per probe
+	cacheTTL time.Duration
+
+	deps     []dependency
+	draining atomic.Bool
+
+	mutex     sync.Mutex // Held while probing, so concurrent checks share one round
+	statuses  []Status
+	checkedAt time.Time
+}
+
+// NewChecker creates a checker that gives each probe timeout and reuses results for cacheTTL
+func NewChecker(timeout, cacheTTL time.Duration) *Checker {
+	return &Checker{
+		timeout:  timeout,
+		cacheTTL: cacheTTL,
+	}
+}
+
+// Add registers a dependency. The server is only ready while every required one is up
+// Dependencies must be added before the checker is used
+func (c *Checker) Add(name string, required bool, probe Probe) {
+	c.deps = append(c.deps, dependency{name: name, required: required, probe: probe})
+}
+
+// SetDraining marks the server as shutting down, which makes it unready
+// so load balancers stop sending new connections
+func (c *Checker) SetDraining(draining bool) {
+	c.draining.Store(draining)
+}
+
+// Draining reports whether the server is shutting down
+func (c *Checker) Draining() bool {
+	return c.draining.Load()
+}
+
+// Check returns every dependency's status, probing them all in parallel
+// unless the last results are younger than the cache TTL
+func (c *Checker) Check(ctx context.Context) []Status {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.statuses != nil && time.Since(c.checkedAt) < c.cacheTTL {
+		return c.statuses
+	}
+
+	statuses := make([]Status, len(c.deps))
+	var wg sync.WaitGroup
+	for i, dep := range c.deps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses[i] = c.probe(ctx, dep)
+		}()
+	}
+	wg.Wait()
+
+	c.statuses = statuses
+	c.checkedAt = time.Now()
+	return statuses
+}
+
+// probe runs one dependency's probe with the checker's timeout
+// A caller hanging up doesn't cancel it, as the result is cached for everyone
+func (c *Checker) probe(ctx context.Context, dep dependency) Status {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := dep.probe(ctx)
+	status := Status{
+		Name:      dep.name,
+		Healthy:   err == nil,
+		Required:  dep.required,
+		LatencyMS: time.Since(start).Milliseconds(),
+		CheckedAt: start,
+	}
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			status.Error = "timed out after " + c.timeout.String()
+		} else {
+			status.Error = err.Error()
+		}
+	}
+	return status
+}
+
+// Ready reports whether the server should receive traffic: it isn't draining
+// and every required dependency is up
+func (c *Checker) Ready(ctx context.Context) (bool, []Status) {
+	// Draining servers are unready whatever their dependencies say, so skip probing
+	if c.Draining() {
+		return false, nil
+	}
+
+	statuses := c.Check(ctx)
+	for _, s := range statuses {
+		if s.Required && !s.Healthy {
+			return false, statuses
+		}
+	}
+	return true, statuses
+}
+
+// LiveHandler reports that the process is up and serving. It never checks
+// dependencies, so an outage elsewhere doesn't get the server restarted
+func (c *Checker) LiveHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// ReadyHandler responds 200 when the server is ready for traffic and 503 when it isn't
+// Only the names of failing dependencies are included, details are for admins
+func (c *Checker) ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	ready, statuses := c.Ready(r.Context())
+
+	resp := struct {
+		Status  string   `json:"status"`
+		Failing []string `json:"failing,omitempty"`
+	}{Status: "ready"}
+
+	if !ready {
+		resp.Status = "unavailable"
+		if c.Draining() {
+			resp.Status = "draining"
+		}
+		for _, s := range statuses {
+			if s.Required && !s.Healthy {
+				resp.Failing = append(resp.Failing, s.Name)
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// DetailsHandler reports each dependency's status, latency and error
+// Dependencies are probed even while draining
+func (c *Checker) DetailsHandler(w http.ResponseWriter, r *http.Request) {
+	ready, _ := c.Ready(r.Context())
+	statuses := c.Check(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(struct {
+		Ready        bool     `json:"ready"`
+		Draining     bool     `json:"draining"`
+		Dependencies []Status `json:"dependencies"`
+	}{
+		Ready:        ready,
+		Draining:     c.Draining(),
+		Dependencies: statuses,
+	})
+}
@@ -0,0 +1,116 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Output styles
+const (
+	StyleText = "text"
+	StyleJSON = "json"
+)
+
+// New creates a logger writing to w in style ("text" or "json") at or above level
+// ("debug", "info", "warn" or "error"). Attributes added to a context with With
+// are included in every record logged with that context
+func New(w io.Writer, style, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	var handler slog.Handler
+	switch strings.ToLower(style) {
+	case StyleText, "":
+		handler = slog.NewTextHandler(w, opts)
+	case StyleJSON:
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("invalid log style %q, must be text or json", style)
+	}
+	return slog.New(contextHandler{handler}), nil
+}
+
+type attrsKey struct{}
+
+// With returns a context carrying attributes, e.g. "user_id", 12, that are added
+// to every record logged with it. Later attributes are added after earlier ones
+func With(ctx context.Context, args ...any) context.Context {
+	if len(args) == 0 {
+		return ctx
+	}
+	existing, _ := ctx.Value(attrsKey{}).([]any)
+	attrs := make([]any, 0, len(existing)+len(args))
+	attrs = append(attrs, existing...)
+	attrs = append(attrs, args...)
+	return context.WithValue(ctx, attrsKey{}, attrs)
+}
+
+// contextHandler adds the attributes carried by a record's context, and the IDs
+// of the span it's in so logs can be found from a trace
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if attrs, ok := ctx.Value(attrsKey{}).([]any); ok {
+		r.Add(attrs...)
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.Add("trace_id", sc.TraceID().String(), "span_id", sc.SpanID().String())
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// Printf logs a printf style message, taking the level from a leading tag like
+// "[ERROR]" or "[WARN]". Other tags, like "[MATCH]", are kept as a "tag" attribute
+// and logged at info
+func Printf(logger *slog.Logger, ctx context.Context, format string, v ...any) {
+	level, tag, format := parseTag(format)
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+	msg := fmt.Sprintf(format, v...)
+	if tag != "" {
+		logger.Log(ctx, level, msg, "tag", tag)
+		return
+	}
+	logger.Log(ctx, level, msg)
+}
+
+// parseTag splits a leading "[TAG] " off a format string
+func parseTag(format string) (slog.Level, string, string) {
+	if !strings.HasPrefix(format, "[") {
+		return slog.LevelInfo, "", format
+	}
+	end := strings.Index(format, "] ")
+	if end == -1 {
+		return slog.LevelInfo, "", format
+	}
+
+	tag, rest := format[1:end], format[end+2:]
+	switch tag {
+	case "ERROR":
+		return slog.LevelError, "", rest
+	case "WARN":
+		return slog.LevelWarn, "", rest
+	case "DEBUG":
+		return slog.LevelDebug, "", rest
+	}
+	return slog.LevelInfo, strings.ToLower(tag), rest
+}
@@ -0,0 +1,207 @@
+package metrics
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Every metric is prefixed with this, e.g. akasha_matches_completed_total
+const namespace = "akasha"
+
+// Game server metrics. Gauges read from game server state at scrape time are
+// registered by the game server itself
+var (
+	PublishDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "publish_duration_seconds",
+		Help:      "Time to fan a message out to a lobby, including rate limiting.",
+		Buckets:   []float64{.0005, .001, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"lobby"}) // "global" or "lobby", not the lobby ID, to bound cardinality
+
+	MessagesDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_dropped_total",
+		Help:      "Messages not delivered because a buffer was full.",
+	}, []string{"reason"})
+
+	SlowClosed = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "subscribers_closed_slow_total",
+		Help:      "Subscribers disconnected for not keeping up with messages.",
+	})
+
+	QueueWait = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "queue_wait_seconds",
+		Help:      "Time players spent in the matchmaking queue before being matched.",
+		Buckets:   []float64{1, 5, 10, 30, 60, 120, 300, 600},
+	}, []string{"mode"})
+
+	MatchesCompleted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "matches_completed_total",
+		Help:      "Matches played to a result.",
+	}, []string{"mode", "ranked", "reason"})
+)
+
+// Calls to other services, labelled by service: postgrest, gotrue or enka
+var (
+	ExternalDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "external_request_duration_seconds",
+		Help:      "Latency of requests to other services.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"service", "method", "code"})
+
+	ExternalErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "external_request_errors_total",
+		Help:      "Requests to other services that failed or returned a 5xx.",
+	}, []string{"service"})
+)
+
+// HTTP requests served, labelled by the route pattern they matched
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests served.",
+	}, []string{"route", "method", "code"})
+
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time to serve HTTP requests. WebSocket connections are excluded.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+)
+
+// Handler serves every registered metric in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Transport records the latency and errors of requests sent through next
+// A nil next uses http.DefaultTransport
+func Transport(service string, next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return roundTripper(func(req *http.Request) (*http.Response, error) {
+		start := time.Now()
+		resp, err := next.RoundTrip(req)
+
+		code := "error"
+		if err == nil {
+			code = strconv.Itoa(resp.StatusCode)
+		}
+		ExternalDuration.WithLabelValues(service, req.Method, code).Observe(time.Since(start).Seconds())
+		if err != nil || resp.StatusCode >= 500 {
+			ExternalErrors.WithLabelValues(service).Inc()
+		}
+		return resp, err
+	})
+}
+
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Middleware records every request next serves by its route pattern
+// It must wrap the ServeMux itself, which sets the pattern as it routes
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		HTTPRequests.WithLabelValues(route, r.Method, strconv.Itoa(rec.code)).Inc()
+		// WebSocket connections last as long as the client stays, which says nothing about latency
+		if !rec.hijacked {
+			HTTPDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+		}
+	})
+}
+
+// statusRecorder captures the status code written through it
+type statusRecorder struct {
+	http.ResponseWriter
+	code        int
+	wroteHeader bool
+	hijacked    bool
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	if !rec.wroteHeader {
+		rec.code = code
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	return rec.ResponseWriter.Write(b)
+}
+
+// Hijack lets WebSocket upgrades through. The connection is counted as a 101
+func (rec *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := rec.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("http.ResponseWriter does not implement http.Hijacker")
+	}
+	rec.code = http.StatusSwitchingProtocols
+	rec.hijacked = true
+	return hj.Hijack()
+}
+
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// RegisterGauge adds a gauge read from fn at scrape time
+func RegisterGauge(name, help string, fn func() float64) {
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      name,
+		Help:      help,
+	}, fn))
+}
+
+// RegisterGaugeVec adds a gauge per label value, all read from fn at scrape time
+// Label values missing from fn's result are no longer reported
+func RegisterGaugeVec(name, help, label string, fn func() map[string]float64) {
+	prometheus.MustRegister(&gaugeFuncVec{
+		desc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, []string{label}, nil),
+		fn:   fn,
+	})
+}
+
+type gaugeFuncVec struct {
+	desc *prometheus.Desc
+	fn   func() map[string]float64
+}
+
+func (g *gaugeFuncVec) Describe(ch chan<- *prometheus.Desc) {
+	ch <- g.desc
+}
+
+func (g *gaugeFuncVec) Collect(ch chan<- prometheus.Metric) {
+	for value, v := range g.fn() {
+		ch <- prometheus.MustNewConstMetric(g.desc, prometheus.GaugeValue, v, value)
+	}
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Middleware wraps a handler with behaviour of its own
+type Middleware func(http.Handler) http.Handler
+
+// Chain composes middleware into one, the first given being the outermost
+func Chain(middleware ...Middleware) Middleware {
+	return func(next http.Handler) http.Handler {
+		for i := len(middleware) - 1; i >= 0; i-- {
+			next = middleware[i](next)
+		}
+		return next
+	}
+}
+
+// Stack is the middleware every route is registered behind
+// Routes that need another body limit or timeout get a copy with WithBodyLimit or WithTimeout
+type Stack struct {
+	Logger    *slog.Logger  // Access and panic logs. Defaults to slog.Default
+	BodyLimit int64         // Largest request body in bytes. 0 for no limit
+	Timeout   time.Duration // How long a handler has to respond. 0 for no limit, e.g. for WebSockets
+}
+
+// Wrap serves next through the stack
+// Recovery sits inside the timeout, which runs the handler on its own goroutine,
+// so the stack logged for a panic is the handler's own. Access logs are outside
+// both, so they see the 500 or 503 written for a panic or timeout
+func (s Stack) Wrap(next http.Handler) http.Handler {
+	logger := s.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return Chain(
+		RequestID,
+		AccessLog(logger),
+		SecurityHeaders,
+		Timeout(s.Timeout),
+		Recover(logger),
+		BodyLimit(s.BodyLimit),
+	)(next)
+}
+
+// WrapFunc is Wrap for a handler function
+func (s Stack) WrapFunc(next http.HandlerFunc) http.Handler {
+	return s.Wrap(next)
+}
+
+// WithBodyLimit returns a copy of the stack with another body limit
+func (s Stack) WithBodyLimit(limit int64) Stack {
+	s.BodyLimit = limit
+	return s
+}
+
+// WithTimeout returns a copy of the stack with another timeout
+func (s Stack) WithTimeout(timeout time.Duration) Stack {
+	s.Timeout = timeout
+	return s
+}
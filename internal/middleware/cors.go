@@ -1,45 +1,50 @@
 package middleware
 
-import "net/http"
+import (
+	"net/http"
 
-// CORS adds CORS headers to HTTP responses (HandlerFunc version)
-// Allows cross-origin requests from any origin
-func CORS(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Set CORS headers
-		w.Header().Set("Access-Control-Allow-Origin", "*") // TODO: proper env frontend URL
-		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		w.Header().Set("Access-Control-Max-Age", "3600")
+	"github.com/vindennt/akasha-showdown-engine/internal/origin"
+)
 
-		// Handle preflight requests
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
+// CORS adds CORS headers to every response for origins the policy allows
+// Applied once around the whole router, so preflights reach it even for
+// routes registered for a single method
+func CORS(policy *origin.Policy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestOrigin := r.Header.Get("Origin")
+			allowed := requestOrigin != "" && policy.Allowed(requestOrigin)
 
-		// Call the next handler
-		next(w, r)
-	}
-}
+			// Set CORS headers
+			// Unless every origin gets the same "*", the response depends on Origin
+			// and caches must keep them apart
+			if policy.Any() && !policy.Credentials() {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Add("Vary", "Origin")
+				if allowed {
+					w.Header().Set("Access-Control-Allow-Origin", requestOrigin)
+					if policy.Credentials() {
+						w.Header().Set("Access-Control-Allow-Credentials", "true")
+					}
+				}
+			}
 
-// CORSHandler adds CORS headers to HTTP responses (Handler version)
-// Allows cross-origin requests from any origin
-func CORSHandler(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Set CORS headers
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		w.Header().Set("Access-Control-Max-Age", "3600")
+			// Handle preflight requests, refusing origins the policy doesn't allow
+			if r.Method == "OPTIONS" {
+				if requestOrigin != "" && !allowed {
+					http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+					return
+				}
+				w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, X-Session-Token")
+				w.Header().Set("Access-Control-Max-Age", "3600")
+				w.WriteHeader(http.StatusOK)
+				return
+			}
 
-		// Handle preflight requests
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		// Call the next handler
-		next.ServeHTTP(w, r)
-	})
+			// Call the next handler
+			next.ServeHTTP(w, r)
+		})
+	}
 }
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+)
+
+// BodyLimit refuses request bodies over limit bytes with a 413
+// Bodies without a declared length are cut off at the limit, failing the handler's read
+func BodyLimit(limit int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		if limit <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Timeout responds 503 if next hasn't finished within timeout, and cancels its context
+// The response is buffered until next returns, so it can't be used for WebSockets or streaming
+func Timeout(timeout time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		if timeout <= 0 {
+			return next
+		}
+		return http.TimeoutHandler(next, timeout, "Request timed out")
+	}
+}
@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/vindennt/akasha-showdown-engine/internal/logging"
+)
+
+// RequestID gives every request an ID, carried in its context for logging and
+// returned in the X-Request-ID header. A valid ID sent by a proxy is kept
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if id == "" || len(id) > 64 {
+			id = uuid.New().String()
+		}
+		w.Header().Set("X-Request-ID", id)
+
+		ctx := logging.With(r.Context(), "request_id", id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -39,6 +39,11 @@ type SessionResponse struct {
 }
 
 type User struct {
-	ID    string `json:"id"`
-	Email string `json:"email"`
+	ID    string   `json:"id"`
+	Email string   `json:"email"`
+	Roles []string `json:"roles,omitempty"`
+
+	// Set when the user is a service principal authenticated by API key
+	Scopes   []string `json:"scopes,omitempty"`
+	APIKeyID string   `json:"api_key_id,omitempty"`
 }
@@ -0,0 +1,210 @@
+package moderation
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vindennt/akasha-showdown-engine/internal/clock"
+)
+
+// What a ban applies to
+const (
+	KindUser    = "user"    // Subscriber ID
+	KindAccount = "account" // Supabase user ID
+	KindIP      = "ip"
+)
+
+// Moderation actions recorded in the audit log
+const (
+	ActionBan           = "ban"
+	ActionUnban         = "unban"
+	ActionMute          = "mute"
+	ActionUnmute        = "unmute"
+	ActionKick          = "kick"
+	ActionDeleteMessage = "delete_message"
+)
+
+// Administrative actions recorded in the audit log
+const (
+	ActionKeyCreate = "api_key_create"
+	ActionKeyRotate = "api_key_rotate"
+	ActionKeyRevoke = "api_key_revoke"
+)
+
+var (
+	ErrUnknownKind   = errors.New("kind must be user, account or ip")
+	ErrInvalidTarget = errors.New("invalid ban target")
+)
+
+// Ban stops a user, account or IP from connecting, chatting, queueing and authenticating
+type Ban struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	Target    string    `json:"target"`
+	Reason    string    `json:"reason"`
+	ActorID   string    `json:"actor_id"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"` // Zero for permanent bans
+}
+
+func (b Ban) Permanent() bool {
+	return b.ExpiresAt.IsZero()
+}
+
+// Active reports whether the ban still applies at now
+func (b Ban) Active(now time.Time) bool {
+	return b.Permanent() || now.Before(b.ExpiresAt)
+}
+
+// Message explains the ban to the banned user
+func (b Ban) Message() string {
+	msg := "Banned permanently"
+	if !b.Permanent() {
+		msg = "Banned until " + b.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	if b.Reason != "" {
+		msg += ": " + b.Reason
+	}
+	return msg
+}
+
+// Normalize validates a ban target and returns it in the form it is stored under
+// so that e.g. equivalent IPv6 spellings match
+func Normalize(kind, target string) (string, error) {
+	switch kind {
+	case KindUser:
+		id, err := strconv.Atoi(target)
+		if err != nil || id < 0 {
+			return "", ErrInvalidTarget
+		}
+		return strconv.Itoa(id), nil
+	case KindAccount:
+		id, err := uuid.Parse(target)
+		if err != nil {
+			return "", ErrInvalidTarget
+		}
+		return id.String(), nil
+	case KindIP:
+		ip := net.ParseIP(target)
+		if ip == nil {
+			return "", ErrInvalidTarget
+		}
+		return ip.String(), nil
+	}
+	return "", ErrUnknownKind
+}
+
+// ClientIP returns the IP a request came from
+// Only the socket address is used; forwarding headers are trivially spoofed to dodge bans
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String()
+	}
+	return host
+}
+
+type banKey struct {
+	kind   string
+	target string
+}
+
+// Bans is the set of bans currently in force, safe for concurrent use
+// Expired bans are dropped when they are next looked at
+type Bans struct {
+	clock clock.Clock
+
+	mutex sync.Mutex
+	bans  map[banKey]Ban
+}
+
+func NewBans(clk clock.Clock) *Bans {
+	return &Bans{
+		clock: clk,
+		bans:  make(map[banKey]Ban),
+	}
+}
+
+// Add puts a ban in force, replacing any earlier ban on the same target
+func (s *Bans) Add(b Ban) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.bans[banKey{b.Kind, b.Target}] = b
+}
+
+// Remove lifts the ban on a target, returning it if there was one in force
+func (s *Bans) Remove(kind, target string) (Ban, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key := banKey{kind, target}
+	b, ok := s.bans[key]
+	delete(s.bans, key)
+	if !ok || !b.Active(s.clock.Now()) {
+		return Ban{}, false
+	}
+	return b, true
+}
+
+// Check returns the ban in force on a target, if any
+// Safe to call on a nil Bans, which bans nothing
+func (s *Bans) Check(kind, target string) (Ban, bool) {
+	if s == nil || target == "" {
+		return Ban{}, false
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key := banKey{kind, target}
+	b, ok := s.bans[key]
+	if !ok {
+		return Ban{}, false
+	}
+	if !b.Active(s.clock.Now()) {
+		delete(s.bans, key)
+		return Ban{}, false
+	}
+	return b, true
+}
+
+// List returns every ban in force, newest first
+func (s *Bans) List() []Ban {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.clock.Now()
+	list := make([]Ban, 0, len(s.bans))
+	for key, b := range s.bans {
+		if !b.Active(now) {
+			delete(s.bans, key)
+			continue
+		}
+		list = append(list, b)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+	return list
+}
+
+// Entry is one record in the append-only moderation audit log
+type Entry struct {
+	ID         string                 `json:"id"`
+	Action     string                 `json:"action"`
+	ActorID    string                 `json:"actor_id"`
+	TargetKind string                 `json:"target_kind"`
+	Target     string                 `json:"target"`
+	Reason     string                 `json:"reason"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+	At         time.Time              `json:"at"`
+}
@@ -0,0 +1,121 @@
+package origin
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Patterns an origin can be allowed by
+const (
+	// Any allows every origin. Can't be combined with credentials
+	Any = "*"
+	// Localhost allows http and https on localhost, 127.0.0.1 and [::1] on any port, for development
+	Localhost = "localhost"
+)
+
+// Policy decides which browser origins may call the server, over HTTP and WebSocket
+// Patterns are exact origins like https://app.example.com, wildcard subdomains like
+// https://*.example.com (which doesn't match example.com itself), Localhost or Any
+type Policy struct {
+	any         bool
+	credentials bool
+	// Matched with path.Match against scheme://host, the same way
+	// websocket.AcceptOptions.OriginPatterns are
+	patterns []string
+}
+
+// New builds a policy from patterns, reporting every pattern that isn't valid
+// With credentials, responses let browsers send cookies and auth headers, so
+// each allowed origin is echoed back and Any is refused
+func New(patterns []string, credentials bool) (*Policy, error) {
+	p := &Policy{credentials: credentials}
+
+	var errs []error
+	for _, pattern := range patterns {
+		switch pattern = strings.ToLower(strings.TrimSpace(pattern)); pattern {
+		case Any:
+			if credentials {
+				errs = append(errs, errors.New(`"*" can't be allowed with credentials, list the origins instead`))
+			}
+			p.any = true
+		case Localhost:
+			for _, scheme := range []string{"http", "https"} {
+				for _, host := range []string{"localhost", `\[::1\]`, "127.0.0.1"} {
+					p.patterns = append(p.patterns, scheme+"://"+host, scheme+"://"+host+":*")
+				}
+			}
+		default:
+			compiled, err := compile(pattern)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			p.patterns = append(p.patterns, compiled)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// compile turns an exact or wildcard subdomain origin into a path.Match pattern
+func compile(pattern string) (string, error) {
+	u, err := url.Parse(strings.Replace(pattern, "://*.", "://wildcard.", 1))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+		(u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return "", fmt.Errorf("origin %q must look like https://app.example.com or https://*.example.com", pattern)
+	}
+
+	host := strings.TrimSuffix(strings.TrimPrefix(pattern, u.Scheme+"://"), "/")
+	wildcard := strings.HasPrefix(host, "*.")
+	host = strings.TrimPrefix(host, "*.")
+	if strings.ContainsAny(host, `*?\`) {
+		return "", fmt.Errorf("origin %q may only use * as its first subdomain", pattern)
+	}
+	// IPv6 hosts are bracketed, which path.Match would read as a character class
+	host = strings.NewReplacer("[", `\[`, "]", `\]`).Replace(host)
+	if wildcard {
+		host = "*." + host
+	}
+	return u.Scheme + "://" + host, nil
+}
+
+// Allowed reports whether a request from origin may be answered
+func (p *Policy) Allowed(origin string) bool {
+	if p.any {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	target := strings.ToLower(u.Scheme + "://" + u.Host)
+	for _, pattern := range p.patterns {
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Any reports whether every origin is allowed
+func (p *Policy) Any() bool {
+	return p.any
+}
+
+// Credentials reports whether browsers may send cookies and auth headers cross-origin
+func (p *Policy) Credentials() bool {
+	return p.credentials
+}
+
+// WebSocketPatterns returns the policy as websocket.AcceptOptions.OriginPatterns
+func (p *Policy) WebSocketPatterns() []string {
+	if p.any {
+		return []string{"*"}
+	}
+	return p.patterns
+}
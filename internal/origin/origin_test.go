@@ -0,0 +1,81 @@
+package origin
+
+import "testing"
+
+func TestAllowed(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		origin   string
+		want     bool
+	}{
+		{"exact match", []string{"https://app.example.com"}, "https://app.example.com", true},
+		{"exact match ignores case", []string{"https://App.Example.com"}, "https://app.EXAMPLE.com", true},
+		{"trailing slash in pattern", []string{"https://app.example.com/"}, "https://app.example.com", true},
+		{"other scheme", []string{"https://app.example.com"}, "http://app.example.com", false},
+		{"other port", []string{"https://app.example.com"}, "https://app.example.com:8443", false},
+		{"explicit port", []string{"https://app.example.com:8443"}, "https://app.example.com:8443", true},
+		{"other host", []string{"https://app.example.com"}, "https://evil.com", false},
+		{"suffix is not a subdomain", []string{"https://example.com"}, "https://evilexample.com", false},
+		{"wildcard subdomain", []string{"https://*.example.com"}, "https://app.example.com", true},
+		{"wildcard nested subdomain", []string{"https://*.example.com"}, "https://a.b.example.com", true},
+		{"wildcard skips apex", []string{"https://*.example.com"}, "https://example.com", false},
+		{"wildcard on other domain", []string{"https://*.example.com"}, "https://app.example.org", false},
+		{"localhost any port", []string{Localhost}, "http://localhost:5173", true},
+		{"localhost no port", []string{Localhost}, "https://localhost", true},
+		{"loopback address", []string{Localhost}, "http://127.0.0.1:3000", true},
+		{"ipv6 loopback", []string{Localhost}, "http://[::1]:3000", true},
+		{"localhost lookalike", []string{Localhost}, "http://localhost.evil.com", false},
+		{"any", []string{Any}, "https://anything.example", true},
+		{"no origin", []string{"https://app.example.com"}, "", false},
+		{"not a url", []string{"https://app.example.com"}, "app.example.com", false},
+		{"second pattern", []string{"https://a.example.com", "https://b.example.com"}, "https://b.example.com", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := New(tt.patterns, false)
+			if err != nil {
+				t.Fatalf("New(%q) error: %v", tt.patterns, err)
+			}
+			if got := p.Allowed(tt.origin); got != tt.want {
+				t.Errorf("Allowed(%q) with %q = %v, want %v", tt.origin, tt.patterns, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRejects(t *testing.T) {
+	tests := []struct {
+		name        string
+		pattern     string
+		credentials bool
+	}{
+		{"any with credentials", Any, true},
+		{"no scheme", "app.example.com", false},
+		{"unsupported scheme", "ftp://app.example.com", false},
+		{"path", "https://app.example.com/login", false},
+		{"query", "https://app.example.com?x=1", false},
+		{"user info", "https://user@app.example.com", false},
+		{"wildcard not first", "https://app.*.example.com", false},
+		{"two wildcards", "https://*.*.example.com", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New([]string{tt.pattern}, tt.credentials); err == nil {
+				t.Errorf("New(%q, %v) = nil error, want one", tt.pattern, tt.credentials)
+			}
+		})
+	}
+}
+
+func TestWebSocketPatterns(t *testing.T) {
+	p, err := New([]string{Any}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.WebSocketPatterns(); len(got) != 1 || got[0] != "*" {
+		t.Errorf("WebSocketPatterns() = %q, want [*]", got)
+	}
+}
@@ -0,0 +1,122 @@
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/vindennt/akasha-showdown-engine/internal/db"
+)
+
+// ErrNotFound is returned by Load when nothing has been saved yet
+var ErrNotFound = errors.New("no snapshot saved")
+
+// Store keeps the latest snapshot of server state, replacing the previous one on each save
+// Snapshots are opaque bytes, so the game server owns their format
+type Store interface {
+	Save(ctx context.Context, data []byte) error
+	Load(ctx context.Context) ([]byte, error)
+}
+
+// Open returns the store named by kind: "none", "file" or "db"
+// "none" returns a nil store, which disables snapshots
+func Open(kind, path, key string, dbClient *db.Client) (Store, error) {
+	switch kind {
+	case "", "none":
+		return nil, nil
+	case "file":
+		return NewFile(path), nil
+	case "db":
+		return NewTable(dbClient, key), nil
+	default:
+		return nil, fmt.Errorf("unknown snapshot store %q", kind)
+	}
+}
+
+// File keeps the snapshot in a local file
+// Saves write a temporary file and rename it over the old one, so a crash mid-save
+// never leaves a torn snapshot behind
+type File struct {
+	path string
+}
+
+func NewFile(path string) *File {
+	return &File{path: path}
+}
+
+func (f *File) Save(ctx context.Context, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	// Snapshots hold session tokens, so only the server may read them
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
+
+func (f *File) Load(ctx context.Context) ([]byte, error) {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+// Table keeps the snapshot in a row of the Supabase server_snapshots table
+// Servers sharing a database need different keys
+type Table struct {
+	dbClient *db.Client
+	key      string
+}
+
+func NewTable(dbClient *db.Client, key string) *Table {
+	return &Table{dbClient: dbClient, key: key}
+}
+
+func (t *Table) Save(ctx context.Context, data []byte) error {
+	record := map[string]interface{}{
+		"id":       t.key,
+		"snapshot": json.RawMessage(data),
+		"saved_at": time.Now().UTC().Format(time.RFC3339),
+	}
+
+	client := t.dbClient.GetSystemClient()
+	_, _, err := client.From("server_snapshots").Insert(record, true, "id", "", "").ExecuteWithContext(ctx)
+	return err
+}
+
+func (t *Table) Load(ctx context.Context) ([]byte, error) {
+	var rows []struct {
+		Snapshot json.RawMessage `json:"snapshot"`
+	}
+
+	client := t.dbClient.GetSystemClient()
+	_, err := client.From("server_snapshots").Select("snapshot", "", false).Eq("id", t.key).ExecuteToWithContext(ctx, &rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, ErrNotFound
+	}
+	return rows[0].Snapshot, nil
+}
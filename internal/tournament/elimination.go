@@ -0,0 +1,270 @@
+package tournament
+
+import (
+	"fmt"
+	"math/bits"
+	"sort"
+)
+
+// elimination is a single or double elimination bracket
+// The field is padded to a power of two with byes, which go to the top seeds.
+// In double elimination, winners bracket losers drop into the losers bracket and
+// the two bracket champions meet in a grand final. If the losers bracket
+// champion wins it, a reset match is played since both players then have one loss
+type elimination struct {
+	format   string
+	entrants []Entrant
+	matches  []*Match
+	byID     map[string]*Match
+	lives    int    // Losses before a player is out
+	final    *Match // Decides the champion
+	reset    *Match // Grand final reset, nil unless still possible
+	wins     map[int]int
+	losses   map[int]int
+}
+
+func newElimination(format string, entrants []Entrant) *elimination {
+	size := 2
+	for size < len(entrants) {
+		size *= 2
+	}
+	rounds := bits.Len(uint(size)) - 1
+
+	e := &elimination{
+		format:   format,
+		entrants: entrants,
+		byID:     make(map[string]*Match),
+		lives:    1,
+		wins:     make(map[int]int),
+		losses:   make(map[int]int),
+	}
+
+	// Winners bracket, each match feeding the next round
+	wb := make([][]*Match, rounds)
+	for r := range rounds {
+		wb[r] = make([]*Match, size>>(r+1))
+		for i := range wb[r] {
+			wb[r][i] = e.add(BracketWinners, r+1, fmt.Sprintf("W%d-%d", r+1, i+1))
+		}
+		if r > 0 {
+			for i, m := range wb[r-1] {
+				m.winnerTo = &target{wb[r][i/2], i % 2}
+			}
+		}
+	}
+	e.final = wb[rounds-1][0]
+
+	if format == DoubleElimination {
+		e.lives = 2
+		lbFinal := e.buildLosers(wb)
+
+		gf := e.add(BracketGrandFinal, 1, "GF-1")
+		e.reset = e.add(BracketGrandFinal, 2, "GF-2")
+
+		e.final.winnerTo = &target{gf, 0}
+		if lbFinal != nil {
+			lbFinal.winnerTo = &target{gf, 1}
+		} else {
+			// Two entrants, so the only loser goes straight to the grand final
+			e.final.loserTo = &target{gf, 1}
+		}
+		e.final = gf
+	}
+
+	// Fill the first round last so byes advance through the whole bracket
+	order := seedOrder(size)
+	for i, m := range wb[0] {
+		for slot := range 2 {
+			seed := order[2*i+slot]
+			if seed <= len(entrants) {
+				e.fill(&target{m, slot}, entrants[seed-1].UserID, false)
+			} else {
+				e.fill(&target{m, slot}, 0, true)
+			}
+		}
+	}
+
+	return e
+}
+
+// buildLosers creates the losers bracket and returns its final, or nil if there is none
+// Rounds alternate between losers bracket survivors meeting players dropping from
+// the winners bracket, and survivors playing each other
+func (e *elimination) buildLosers(wb [][]*Match) *Match {
+	if len(wb) < 2 {
+		return nil
+	}
+
+	round := 1
+	prev := make([]*Match, len(wb[0])/2)
+	for i := range prev {
+		prev[i] = e.add(BracketLosers, round, fmt.Sprintf("L%d-%d", round, i+1))
+	}
+	for i, m := range wb[0] {
+		m.loserTo = &target{prev[i/2], i % 2}
+	}
+
+	for r := 1; r < len(wb); r++ {
+		round++
+		drop := make([]*Match, len(prev))
+		for i := range drop {
+			drop[i] = e.add(BracketLosers, round, fmt.Sprintf("L%d-%d", round, i+1))
+			prev[i].winnerTo = &target{drop[i], 0}
+		}
+		// Reverse every other drop round so players don't meet the same opponent again right away
+		for i, m := range wb[r] {
+			j := i
+			if r%2 == 1 {
+				j = len(wb[r]) - 1 - i
+			}
+			m.loserTo = &target{drop[j], 1}
+		}
+		prev = drop
+
+		if len(prev) > 1 {
+			round++
+			next := make([]*Match, len(prev)/2)
+			for i := range next {
+				next[i] = e.add(BracketLosers, round, fmt.Sprintf("L%d-%d", round, i+1))
+			}
+			for i, m := range prev {
+				m.winnerTo = &target{next[i/2], i % 2}
+			}
+			prev = next
+		}
+	}
+
+	return prev[0]
+}
+
+// add creates a pending match
+func (e *elimination) add(bracket string, round int, id string) *Match {
+	m := &Match{
+		ID:      id,
+		Bracket: bracket,
+		Round:   round,
+		Status:  StatusPending,
+	}
+	e.matches = append(e.matches, m)
+	e.byID[id] = m
+	return m
+}
+
+// fill places a player, or a bye, into a match slot
+func (e *elimination) fill(t *target, playerID int, bye bool) {
+	if t == nil {
+		return
+	}
+	t.match.Slots[t.slot] = Slot{PlayerID: playerID, Filled: true, Bye: bye}
+	e.settle(t.match)
+}
+
+// settle marks a match ready once both players are known,
+// or decides it without play if either side is a bye
+func (e *elimination) settle(m *Match) {
+	if m.Status != StatusPending || !m.Slots[0].Filled || !m.Slots[1].Filled {
+		return
+	}
+	if !m.Slots[0].Bye && !m.Slots[1].Bye {
+		m.Status = StatusReady
+		return
+	}
+
+	m.Status = StatusDone
+	m.Bye = true
+	for _, s := range m.Slots {
+		if !s.Bye {
+			m.WinnerID = s.PlayerID
+			e.fill(m.winnerTo, s.PlayerID, false)
+			e.fill(m.loserTo, 0, true)
+			return
+		}
+	}
+
+	// Nobody to advance
+	e.fill(m.winnerTo, 0, true)
+	e.fill(m.loserTo, 0, true)
+}
+
+func (e *elimination) Format() string { return e.format }
+
+func (e *elimination) Matches() []Match { return snapshot(e.matches) }
+
+func (e *elimination) Start(id string) error { return start(e.byID, id) }
+
+func (e *elimination) Finished() bool { return e.final.Status == StatusDone }
+
+func (e *elimination) Winner() int { return e.final.WinnerID }
+
+func (e *elimination) Report(id string, winnerID int) error {
+	m, loserID, err := decide(e.byID, id, winnerID)
+	if err != nil {
+		return err
+	}
+	e.wins[winnerID]++
+	e.losses[loserID]++
+
+	if m == e.final && e.reset != nil {
+		reset := e.reset
+		e.reset = nil
+
+		// Winners bracket champion sits in slot 0 and only needed one win
+		if winnerID == m.Slots[0].PlayerID {
+			reset.Status = StatusDone
+			reset.Bye = true
+			reset.WinnerID = winnerID
+			return nil
+		}
+
+		e.final = reset
+		e.fill(&target{reset, 0}, m.Slots[0].PlayerID, false)
+		e.fill(&target{reset, 1}, m.Slots[1].PlayerID, false)
+		return nil
+	}
+
+	e.fill(m.winnerTo, winnerID, false)
+	e.fill(m.loserTo, loserID, false)
+	return nil
+}
+
+func (e *elimination) Standings() []Standing {
+	standings := make([]Standing, len(e.entrants))
+	for i, en := range e.entrants {
+		standings[i] = Standing{
+			UserID:     en.UserID,
+			Seed:       en.Seed,
+			Wins:       e.wins[en.UserID],
+			Losses:     e.losses[en.UserID],
+			Eliminated: e.losses[en.UserID] >= e.lives || (e.Finished() && en.UserID != e.Winner()),
+		}
+	}
+
+	// Players still in first, then whoever went furthest
+	sort.SliceStable(standings, func(i, j int) bool {
+		a, b := standings[i], standings[j]
+		if a.Eliminated != b.Eliminated {
+			return !a.Eliminated
+		}
+		if a.Wins != b.Wins {
+			return a.Wins > b.Wins
+		}
+		return a.Seed < b.Seed
+	})
+	return standings
+}
+
+// seedOrder returns the first round seed positions for a bracket of size players,
+// so that the top two seeds can only meet in the final
+// e.g. 8 gives 1 v 8, 4 v 5, 2 v 7, 3 v 6
+func seedOrder(size int) []int {
+	order := []int{1}
+	for len(order) < size {
+		n := len(order) * 2
+		next := make([]int, 0, n)
+		for _, s := range order {
+			next = append(next, s, n+1-s)
+		}
+		order = next
+	}
+	return order
+}
@@ -0,0 +1,233 @@
+package tournament
+
+import (
+	"fmt"
+	"math/bits"
+	"slices"
+	"sort"
+)
+
+// swiss plays a fixed number of rounds where players meet others on the same score
+// Each round is paired once the previous one is done. With an odd number of
+// players, the lowest ranked player who hasn't had a bye sits out and scores a win
+type swiss struct {
+	entrants  []Entrant
+	rounds    int
+	round     int
+	matches   []*Match
+	byID      map[string]*Match
+	wins      map[int]int
+	losses    map[int]int
+	opponents map[int][]int
+	hadBye    map[int]bool
+}
+
+func newSwiss(entrants []Entrant, rounds int) *swiss {
+	if rounds <= 0 {
+		rounds = bits.Len(uint(len(entrants) - 1))
+	}
+
+	s := &swiss{
+		entrants:  entrants,
+		rounds:    rounds,
+		byID:      make(map[string]*Match),
+		wins:      make(map[int]int),
+		losses:    make(map[int]int),
+		opponents: make(map[int][]int),
+		hadBye:    make(map[int]bool),
+	}
+	s.pairRound()
+	return s
+}
+
+// pairRound pairs the next round from the current standings
+// Each player is paired with the highest ranked player left that they haven't played,
+// backing up when that would leave two players below them who have already met.
+// Rematches are only played when every way of pairing the round has one
+func (s *swiss) pairRound() {
+	s.round++
+	order := s.Standings()
+
+	if len(order)%2 == 1 {
+		sitOut := len(order) - 1
+		for i := len(order) - 1; i >= 0; i-- {
+			if !s.hadBye[order[i].UserID] {
+				sitOut = i
+				break
+			}
+		}
+		id := order[sitOut].UserID
+		order = slices.Delete(order, sitOut, sitOut+1)
+
+		m := s.add(len(order)/2 + 1)
+		m.Slots = [2]Slot{{PlayerID: id, Filled: true}, {Filled: true, Bye: true}}
+		m.Status = StatusDone
+		m.Bye = true
+		m.WinnerID = id
+		s.wins[id]++
+		s.hadBye[id] = true
+	}
+
+	budget := maxPairingSteps
+	pairs, ok := s.pairWithoutRematches(order, make([]bool, len(order)), nil, &budget)
+	if !ok {
+		pairs = s.pairAllowingRematches(order)
+	}
+	for n, pair := range pairs {
+		m := s.add(n + 1)
+		m.Slots = [2]Slot{
+			{PlayerID: order[pair[0]].UserID, Filled: true},
+			{PlayerID: order[pair[1]].UserID, Filled: true},
+		}
+		m.Status = StatusReady
+	}
+
+	// Keep the bye at the end of the round
+	sort.SliceStable(s.matches, func(i, j int) bool {
+		a, b := s.matches[i], s.matches[j]
+		if a.Round != b.Round {
+			return a.Round < b.Round
+		}
+		return !a.Bye && b.Bye
+	})
+}
+
+// How many pairings pairWithoutRematches tries before settling for rematches
+// Large fields late in long events can have a huge number of them
+const maxPairingSteps = 100000
+
+// pairWithoutRematches pairs the unpaired players in order, best ranked first,
+// trying the next opponent down whenever a choice leaves the rest unpairable
+// Returns pairs of positions in order, or false if every pairing has a rematch
+// or budget runs out
+func (s *swiss) pairWithoutRematches(order []Standing, paired []bool, pairs [][2]int, budget *int) ([][2]int, bool) {
+	i := slices.Index(paired, false)
+	if i < 0 {
+		return pairs, true
+	}
+
+	paired[i] = true
+	for j := i + 1; j < len(order); j++ {
+		if paired[j] || slices.Contains(s.opponents[order[i].UserID], order[j].UserID) {
+			continue
+		}
+		if *budget--; *budget < 0 {
+			break
+		}
+		paired[j] = true
+		if found, ok := s.pairWithoutRematches(order, paired, append(pairs, [2]int{i, j}), budget); ok {
+			return found, true
+		}
+		paired[j] = false
+	}
+	paired[i] = false
+	return nil, false
+}
+
+// pairAllowingRematches pairs each player with the highest ranked player left
+// that they haven't played, or the highest ranked player left if they've played everyone
+func (s *swiss) pairAllowingRematches(order []Standing) [][2]int {
+	pairs := make([][2]int, 0, len(order)/2)
+	paired := make([]bool, len(order))
+	for i := range order {
+		if paired[i] {
+			continue
+		}
+
+		pick := -1
+		for j := i + 1; j < len(order); j++ {
+			if paired[j] {
+				continue
+			}
+			if pick < 0 {
+				pick = j
+			}
+			if !slices.Contains(s.opponents[order[i].UserID], order[j].UserID) {
+				pick = j
+				break
+			}
+		}
+		paired[i], paired[pick] = true, true
+		pairs = append(pairs, [2]int{i, pick})
+	}
+	return pairs
+}
+
+// add creates a match in the current round
+func (s *swiss) add(n int) *Match {
+	m := &Match{
+		ID:      fmt.Sprintf("S%d-%d", s.round, n),
+		Bracket: BracketSwiss,
+		Round:   s.round,
+		Status:  StatusPending,
+	}
+	s.matches = append(s.matches, m)
+	s.byID[m.ID] = m
+	return m
+}
+
+func (s *swiss) Format() string { return Swiss }
+
+func (s *swiss) Matches() []Match { return snapshot(s.matches) }
+
+func (s *swiss) Start(id string) error { return start(s.byID, id) }
+
+func (s *swiss) Finished() bool { return s.round == s.rounds && s.roundDone() }
+
+func (s *swiss) Winner() int { return s.Standings()[0].UserID }
+
+// roundDone reports whether every match in the current round is done
+func (s *swiss) roundDone() bool {
+	for _, m := range s.matches {
+		if m.Round == s.round && m.Status != StatusDone {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *swiss) Report(id string, winnerID int) error {
+	m, loserID, err := decide(s.byID, id, winnerID)
+	if err != nil {
+		return err
+	}
+	s.wins[winnerID]++
+	s.losses[loserID]++
+	s.opponents[winnerID] = append(s.opponents[winnerID], loserID)
+	s.opponents[loserID] = append(s.opponents[loserID], winnerID)
+
+	if m.Round == s.round && s.roundDone() && s.round < s.rounds {
+		s.pairRound()
+	}
+	return nil
+}
+
+// Standings ranks by wins, then Buchholz, then seed
+func (s *swiss) Standings() []Standing {
+	standings := make([]Standing, len(s.entrants))
+	for i, en := range s.entrants {
+		buchholz := 0
+		for _, opp := range s.opponents[en.UserID] {
+			buchholz += s.wins[opp]
+		}
+		standings[i] = Standing{
+			UserID:   en.UserID,
+			Seed:     en.Seed,
+			Wins:     s.wins[en.UserID],
+			Losses:   s.losses[en.UserID],
+			Buchholz: buchholz,
+		}
+	}
+
+	sort.SliceStable(standings, func(i, j int) bool {
+		a, b := standings[i], standings[j]
+		if a.Wins != b.Wins {
+			return a.Wins > b.Wins
+		}
+		if a.Buchholz != b.Buchholz {
+			return a.Buchholz > b.Buchholz
+		}
+		return a.Seed < b.Seed
+	})
+	return standings
+}
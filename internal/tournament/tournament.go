@@ -0,0 +1,187 @@
+package tournament
+
+import (
+	"errors"
+	"slices"
+	"sort"
+)
+
+// Tournament formats
+const (
+	SingleElimination = "single_elimination"
+	DoubleElimination = "double_elimination"
+	Swiss             = "swiss"
+)
+
+// Brackets a match can belong to
+const (
+	BracketWinners    = "winners"
+	BracketLosers     = "losers"
+	BracketGrandFinal = "grand_final"
+	BracketSwiss      = "swiss"
+)
+
+// Bracket match statuses
+const (
+	StatusPending = "pending" // Waiting on an earlier match
+	StatusReady   = "ready"   // Both players known
+	StatusLive    = "live"    // Being played
+	StatusDone    = "done"
+)
+
+var (
+	ErrUnknownFormat  = errors.New("unknown tournament format")
+	ErrTooFewEntrants = errors.New("need at least 2 entrants")
+	ErrUnknownMatch   = errors.New("unknown bracket match")
+	ErrMatchNotReady  = errors.New("bracket match is not ready")
+	ErrNotInMatch     = errors.New("player is not in this bracket match")
+)
+
+type Entrant struct {
+	UserID int `json:"user_id"`
+	Rating int `json:"rating"`
+	Seed   int `json:"seed"` // 1 is the top seed
+}
+
+// Slot is one side of a bracket match
+type Slot struct {
+	PlayerID int  `json:"player_id"`
+	Filled   bool `json:"filled"` // False until the feeding match is decided
+	Bye      bool `json:"bye"`    // Filled without a player
+}
+
+type Match struct {
+	ID       string  `json:"id"`
+	Bracket  string  `json:"bracket"`
+	Round    int     `json:"round"` // Starts at 1 within each bracket
+	Slots    [2]Slot `json:"slots"`
+	Status   string  `json:"status"`
+	WinnerID int     `json:"winner_id"` // Only valid once done
+	LoserID  int     `json:"loser_id"`  // Only valid once done and played
+	Bye      bool    `json:"bye"`       // Decided without being played
+
+	// Where the winner and loser go next, nil if nowhere
+	winnerTo *target
+	loserTo  *target
+}
+
+type target struct {
+	match *Match
+	slot  int
+}
+
+// Players returns both players, only valid once the match is ready
+func (m *Match) Players() [2]int {
+	return [2]int{m.Slots[0].PlayerID, m.Slots[1].PlayerID}
+}
+
+type Standing struct {
+	UserID     int  `json:"user_id"`
+	Seed       int  `json:"seed"`
+	Wins       int  `json:"wins"`
+	Losses     int  `json:"losses"`
+	Buchholz   int  `json:"buchholz,omitempty"` // Swiss tiebreak, the sum of opponents' wins
+	Eliminated bool `json:"eliminated"`
+}
+
+// Bracket tracks matches and advances players as results are reported
+// It doesn't run matches; the caller plays ready matches and reports the winners
+type Bracket interface {
+	Format() string
+	// Matches returns a snapshot of every match created so far, in bracket order
+	Matches() []Match
+	// Start marks a ready match as being played
+	Start(id string) error
+	// Report records the winner of a ready or live match and advances the bracket
+	Report(id string, winnerID int) error
+	Finished() bool
+	// Winner returns the champion, only valid once finished
+	Winner() int
+	// Standings returns every entrant, best first
+	Standings() []Standing
+}
+
+// ValidFormat reports whether a tournament format is supported
+func ValidFormat(format string) bool {
+	return format == SingleElimination || format == DoubleElimination || format == Swiss
+}
+
+// New builds a bracket for entrants already ordered by seed
+// rounds sets the number of Swiss rounds; 0 plays enough to leave one unbeaten player
+func New(format string, entrants []Entrant, rounds int) (Bracket, error) {
+	if !ValidFormat(format) {
+		return nil, ErrUnknownFormat
+	}
+	if len(entrants) < 2 {
+		return nil, ErrTooFewEntrants
+	}
+
+	if format == Swiss {
+		return newSwiss(entrants, rounds), nil
+	}
+	return newElimination(format, entrants), nil
+}
+
+// Seed orders entrants by rating, highest first, and numbers seeds from 1
+// Ties keep the given order, so earlier registrations seed higher
+func Seed(entrants []Entrant) []Entrant {
+	seeded := slices.Clone(entrants)
+	sort.SliceStable(seeded, func(i, j int) bool {
+		return seeded[i].Rating > seeded[j].Rating
+	})
+	for i := range seeded {
+		seeded[i].Seed = i + 1
+	}
+	return seeded
+}
+
+// snapshot copies matches for callers outside the bracket
+func snapshot(matches []*Match) []Match {
+	out := make([]Match, len(matches))
+	for i, m := range matches {
+		out[i] = *m
+		out[i].winnerTo = nil
+		out[i].loserTo = nil
+	}
+	return out
+}
+
+// start marks a ready match as live
+func start(byID map[string]*Match, id string) error {
+	m, ok := byID[id]
+	if !ok {
+		return ErrUnknownMatch
+	}
+	if m.Status != StatusReady {
+		return ErrMatchNotReady
+	}
+	m.Status = StatusLive
+	return nil
+}
+
+// decide records the result of a played match and returns the loser
+func decide(byID map[string]*Match, id string, winnerID int) (*Match, int, error) {
+	m, ok := byID[id]
+	if !ok {
+		return nil, 0, ErrUnknownMatch
+	}
+	if m.Status != StatusReady && m.Status != StatusLive {
+		return nil, 0, ErrMatchNotReady
+	}
+
+	players := m.Players()
+	var loserID int
+	switch winnerID {
+	case players[0]:
+		loserID = players[1]
+	case players[1]:
+		loserID = players[0]
+	default:
+		return nil, 0, ErrNotInMatch
+	}
+
+	m.Status = StatusDone
+	m.WinnerID = winnerID
+	m.LoserID = loserID
+	return m, loserID, nil
+}
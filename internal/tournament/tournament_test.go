@@ -0,0 +1,318 @@
+package tournament
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+// entrants returns n seeded entrants whose user IDs are their seeds
+func entrants(n int) []Entrant {
+	es := make([]Entrant, n)
+	for i := range es {
+		es[i] = Entrant{UserID: i + 1, Rating: 2000 - i}
+	}
+	return Seed(es)
+}
+
+// higherSeed picks the lower user ID, which is the higher seed
+func higherSeed(m Match) int {
+	p := m.Players()
+	return min(p[0], p[1])
+}
+
+// play reports winners for ready matches until the bracket is finished
+// Returns the IDs of the matches played, in order
+func play(t *testing.T, b Bracket, pick func(Match) int) []string {
+	t.Helper()
+	played := make([]string, 0)
+	for !b.Finished() {
+		progressed := false
+		for _, m := range b.Matches() {
+			if m.Status != StatusReady {
+				continue
+			}
+			if err := b.Report(m.ID, pick(m)); err != nil {
+				t.Fatalf("Report(%s): %v", m.ID, err)
+			}
+			played = append(played, m.ID)
+			progressed = true
+			break
+		}
+		if !progressed {
+			t.Fatalf("bracket stuck with no ready matches after %v", played)
+		}
+	}
+	return played
+}
+
+func TestSeedOrder(t *testing.T) {
+	tests := []struct {
+		size int
+		want []int
+	}{
+		{2, []int{1, 2}},
+		{4, []int{1, 4, 2, 3}},
+		{8, []int{1, 8, 4, 5, 2, 7, 3, 6}},
+	}
+
+	for _, tt := range tests {
+		if got := seedOrder(tt.size); !slices.Equal(got, tt.want) {
+			t.Errorf("seedOrder(%d) = %v, want %v", tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestSeed(t *testing.T) {
+	got := Seed([]Entrant{
+		{UserID: 1, Rating: 1500},
+		{UserID: 2, Rating: 1700},
+		{UserID: 3, Rating: 1500},
+	})
+
+	want := []Entrant{
+		{UserID: 2, Rating: 1700, Seed: 1},
+		{UserID: 1, Rating: 1500, Seed: 2},
+		{UserID: 3, Rating: 1500, Seed: 3},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Seed() = %v, want %v", got, want)
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		n       int
+		wantErr error
+	}{
+		{"single elimination", SingleElimination, 2, nil},
+		{"double elimination", DoubleElimination, 5, nil},
+		{"swiss", Swiss, 3, nil},
+		{"unknown format", "round_robin", 4, ErrUnknownFormat},
+		{"one entrant", SingleElimination, 1, ErrTooFewEntrants},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.format, entrants(tt.n), 0)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("New(%q, %d entrants) = %v, want %v", tt.format, tt.n, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestElimination(t *testing.T) {
+	// Slot 1 of the first grand final is the losers bracket champion
+	upset := func(m Match) int {
+		if m.ID == "GF-1" {
+			return m.Slots[1].PlayerID
+		}
+		return higherSeed(m)
+	}
+
+	tests := []struct {
+		name       string
+		format     string
+		n          int
+		pick       func(Match) int
+		wantPlayed []string
+		wantWinner int
+	}{
+		{"single, full field", SingleElimination, 4, higherSeed,
+			[]string{"W1-1", "W1-2", "W2-1"}, 1},
+		{"single, top seed gets the bye", SingleElimination, 3, higherSeed,
+			[]string{"W1-2", "W2-1"}, 1},
+		{"single, byes carry through rounds", SingleElimination, 5, higherSeed,
+			[]string{"W1-2", "W2-1", "W2-2", "W3-1"}, 1},
+		{"double, two entrants", DoubleElimination, 2, higherSeed,
+			[]string{"W1-1", "GF-1"}, 1},
+		{"double, no reset", DoubleElimination, 4, higherSeed,
+			[]string{"W1-1", "W1-2", "W2-1", "L1-1", "L2-1", "GF-1"}, 1},
+		{"double, reset played", DoubleElimination, 4, upset,
+			[]string{"W1-1", "W1-2", "W2-1", "L1-1", "L2-1", "GF-1", "GF-2"}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := New(tt.format, entrants(tt.n), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			played := play(t, b, tt.pick)
+			if !slices.Equal(played, tt.wantPlayed) {
+				t.Errorf("played %v, want %v", played, tt.wantPlayed)
+			}
+			if got := b.Winner(); got != tt.wantWinner {
+				t.Errorf("Winner() = %d, want %d", got, tt.wantWinner)
+			}
+
+			standings := b.Standings()
+			if standings[0].UserID != tt.wantWinner || standings[0].Eliminated {
+				t.Errorf("Standings()[0] = %+v, want the winner still in", standings[0])
+			}
+			for _, s := range standings[1:] {
+				if !s.Eliminated {
+					t.Errorf("Standings() has %+v still in after the final", s)
+				}
+			}
+		})
+	}
+}
+
+func TestEliminationLosersBracketDrop(t *testing.T) {
+	b, err := New(DoubleElimination, entrants(4), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"W1-1", "W1-2"} {
+		m := find(t, b, id)
+		if err := b.Report(id, higherSeed(m)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Seeds 4 and 3 lost the first round, so meet in the losers bracket
+	if got := find(t, b, "L1-1"); got.Status != StatusReady || got.Players() != [2]int{4, 3} {
+		t.Errorf("L1-1 = %+v, want seeds 4 and 3 ready", got)
+	}
+}
+
+func TestSwiss(t *testing.T) {
+	tests := []struct {
+		name       string
+		n          int
+		rounds     int
+		wantRounds int
+		wantByes   int
+	}{
+		{"default rounds", 8, 0, 3, 0},
+		{"set rounds", 6, 2, 2, 0},
+		{"odd field", 5, 3, 3, 3},
+		{"two players", 2, 0, 1, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := New(Swiss, entrants(tt.n), tt.rounds)
+			if err != nil {
+				t.Fatal(err)
+			}
+			play(t, b, higherSeed)
+
+			rounds := 0
+			met := make(map[[2]int]bool)
+			hadBye := make(map[int]bool)
+			byes := 0
+			for _, m := range b.Matches() {
+				rounds = max(rounds, m.Round)
+				if m.Bye {
+					if hadBye[m.WinnerID] {
+						t.Errorf("player %d had more than one bye", m.WinnerID)
+					}
+					hadBye[m.WinnerID] = true
+					byes++
+					continue
+				}
+				p := m.Players()
+				pair := [2]int{min(p[0], p[1]), max(p[0], p[1])}
+				if met[pair] {
+					t.Errorf("players %v met twice", pair)
+				}
+				met[pair] = true
+			}
+			if rounds != tt.wantRounds {
+				t.Errorf("played %d rounds, want %d", rounds, tt.wantRounds)
+			}
+			if byes != tt.wantByes {
+				t.Errorf("%d byes, want %d", byes, tt.wantByes)
+			}
+
+			// The top seed wins every match, so finishes first unbeaten
+			standings := b.Standings()
+			if b.Winner() != 1 || standings[0].Wins != tt.wantRounds || standings[0].Losses != 0 {
+				t.Errorf("Standings()[0] = %+v, Winner() = %d, want seed 1 unbeaten", standings[0], b.Winner())
+			}
+		})
+	}
+}
+
+func TestSwissPairsOnScore(t *testing.T) {
+	b, err := New(Swiss, entrants(4), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"S1-1", "S1-2"} {
+		if err := b.Report(id, higherSeed(find(t, b, id))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Seeds 1 and 3 won, seeds 2 and 4 lost
+	want := map[string][2]int{"S2-1": {1, 3}, "S2-2": {2, 4}}
+	for id, players := range want {
+		m := find(t, b, id)
+		if got := m.Players(); got != players {
+			t.Errorf("%s players = %v, want %v", id, got, players)
+		}
+	}
+}
+
+func TestReportErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		id      string
+		winner  int
+		wantErr error
+	}{
+		{"unknown match", "W9-9", 1, ErrUnknownMatch},
+		{"not a player", "W1-1", 2, ErrNotInMatch},
+		{"pending match", "W2-1", 1, ErrMatchNotReady},
+		{"already decided", "W1-2", 2, ErrMatchNotReady},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := New(SingleElimination, entrants(4), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := b.Report("W1-2", 2); err != nil {
+				t.Fatal(err)
+			}
+			if err := b.Report(tt.id, tt.winner); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Report(%q, %d) = %v, want %v", tt.id, tt.winner, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStart(t *testing.T) {
+	b, err := New(SingleElimination, entrants(4), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Start("W1-1"); err != nil {
+		t.Fatalf("Start(W1-1) = %v", err)
+	}
+	if err := b.Start("W1-1"); !errors.Is(err, ErrMatchNotReady) {
+		t.Errorf("second Start(W1-1) = %v, want %v", err, ErrMatchNotReady)
+	}
+	if err := b.Report("W1-1", 1); err != nil {
+		t.Errorf("Report on a live match = %v", err)
+	}
+}
+
+// find returns a bracket match by ID
+func find(t *testing.T, b Bracket, id string) Match {
+	t.Helper()
+	for _, m := range b.Matches() {
+		if m.ID == id {
+			return m
+		}
+	}
+	t.Fatalf("no match %s", id)
+	return Match{}
+}
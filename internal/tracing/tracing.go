@@ -0,0 +1,117 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Name spans are recorded under, and the service name unless OTEL_SERVICE_NAME is set
+const (
+	instrumentationName = "github.com/vindennt/akasha-showdown-engine"
+	serviceName         = "akasha-showdown-engine"
+)
+
+// Where spans are exported to
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"   // OTLP over HTTP, configured by the standard OTEL_EXPORTER_OTLP_* env vars
+	ExporterStdout = "stdout" // Pretty printed to stdout, for local testing
+)
+
+// Setup installs the global tracer provider and W3C trace context propagation
+// sampleRatio is the fraction of new traces recorded. Traces continued from
+// an incoming request follow the caller's sampling decision
+// Returns a function that flushes any buffered spans and stops exporting
+func Setup(ctx context.Context, exporter string, sampleRatio float64) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var exp sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case ExporterNone, "":
+		// The global provider stays a no-op, so spans cost next to nothing
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		exp, err = otlptracehttp.New(ctx)
+	case ExporterStdout:
+		exp, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf("invalid trace exporter %q, must be none, otlp or stdout", exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Env attributes come last so OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES win
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(serviceName)),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// Start starts a span, as a child of the span in ctx if there is one
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+// End marks span as failed if err is set, then ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Middleware starts a span for every request, continuing the trace from the
+// request's traceparent header if it has one
+// Spans are named after the route the ServeMux matched, so nothing between this
+// and the mux may replace the request
+func Middleware(next http.Handler) http.Handler {
+	routed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+		// The mux only sets the pattern once it's routed the request, after the span started
+		if r.Pattern != "" {
+			span := trace.SpanFromContext(r.Context())
+			span.SetName(r.Pattern)
+			span.SetAttributes(semconv.HTTPRoute(r.Pattern))
+		}
+	})
+	return otelhttp.NewHandler(routed, "unmatched")
+}
+
+// Transport traces requests sent through next to another service
+// Requests are children of the span in their context, so callers should send
+// them with a context wherever they can
+func Transport(service string, next http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(next, otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+		return service + " " + r.Method
+	}))
+}
@@ -0,0 +1,314 @@
+package ws
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/supabase-community/postgrest-go"
+	"github.com/vindennt/akasha-showdown-engine/internal/apikey"
+	"github.com/vindennt/akasha-showdown-engine/internal/moderation"
+)
+
+// Target kind for API key entries in the audit log
+const auditKindAPIKey = "api_key"
+
+// createdKey is returned when a key is created or rotated
+// This is the only time the plaintext key is ever shown
+type createdKey struct {
+	apikey.Key
+	Plaintext string `json:"key"`
+}
+
+// issueKey generates and stores a new key for a service principal
+func (gs *GameServer) issueKey(name string, scopes []apikey.Scope, ttl time.Duration, rotatedFrom string) (createdKey, error) {
+	plaintext, id, hash, err := apikey.Generate()
+	if err != nil {
+		return createdKey{}, err
+	}
+
+	now := gs.clock.Now()
+	key := apikey.Key{
+		ID:          id,
+		Name:        name,
+		Scopes:      scopes,
+		Hash:        hash,
+		CreatedAt:   now,
+		RotatedFrom: rotatedFrom,
+	}
+	if ttl > 0 {
+		key.ExpiresAt = now.Add(ttl)
+	}
+
+	gs.apiKeys.Put(key)
+	gs.goWrite(func() { gs.storeAPIKey(key) })
+	return createdKey{Key: key, Plaintext: plaintext}, nil
+}
+
+// handles admins creating an API key for a trusted backend
+// A ttl_seconds of 0 creates a key that doesn't expire
+func (gs *GameServer) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var req struct {
+		Name       string         `json:"name"`
+		Scopes     []apikey.Scope `json:"scopes"`
+		TTLSeconds int            `json:"ttl_seconds"`
+	}
+
+	if err := json.Unmarshal(data, &req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Scopes) == 0 {
+		http.Error(w, "At least one scope is required", http.StatusBadRequest)
+		return
+	}
+	for _, s := range req.Scopes {
+		if !apikey.ValidScope(s) {
+			http.Error(w, "Unknown scope: "+string(s), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.TTLSeconds < 0 {
+		http.Error(w, "ttl_seconds cannot be negative", http.StatusBadRequest)
+		return
+	}
+
+	created, err := gs.issueKey(req.Name, req.Scopes, time.Duration(req.TTLSeconds)*time.Second, "")
+	if err != nil {
+		gs.logc(r.Context(), "[ERROR] Failed to generate API key: %v", err)
+		http.Error(w, "Failed to generate key", http.StatusInternalServerError)
+		return
+	}
+
+	gs.audit(moderation.ActionKeyCreate, actorID(r), auditKindAPIKey, created.ID, "", map[string]interface{}{
+		"name":   created.Name,
+		"scopes": created.Scopes,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// handles admins replacing a key with a new one with the same name and scopes
+// The old key keeps working for grace_seconds so the backend can be redeployed, or stops now if 0
+func (gs *GameServer) rotateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var req struct {
+		ID           string `json:"id"`
+		GraceSeconds int    `json:"grace_seconds"`
+		TTLSeconds   int    `json:"ttl_seconds"`
+	}
+
+	if err := json.Unmarshal(data, &req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if req.GraceSeconds < 0 || req.TTLSeconds < 0 {
+		http.Error(w, "grace_seconds and ttl_seconds cannot be negative", http.StatusBadRequest)
+		return
+	}
+
+	old, exists := gs.apiKeys.Get(req.ID)
+	if !exists || !old.Active(gs.clock.Now()) {
+		http.Error(w, "Key not found", http.StatusNotFound)
+		return
+	}
+
+	created, err := gs.issueKey(old.Name, old.Scopes, time.Duration(req.TTLSeconds)*time.Second, old.ID)
+	if err != nil {
+		gs.logc(r.Context(), "[ERROR] Failed to generate API key: %v", err)
+		http.Error(w, "Failed to generate key", http.StatusInternalServerError)
+		return
+	}
+
+	// Never extend the old key past its own expiry
+	retired, _ := gs.apiKeys.Update(old.ID, func(k *apikey.Key) {
+		now := gs.clock.Now()
+		if req.GraceSeconds == 0 {
+			k.RevokedAt = now
+			return
+		}
+		until := now.Add(time.Duration(req.GraceSeconds) * time.Second)
+		if k.ExpiresAt.IsZero() || until.Before(k.ExpiresAt) {
+			k.ExpiresAt = until
+		}
+	})
+	gs.goWrite(func() { gs.retireAPIKey(retired) })
+
+	gs.audit(moderation.ActionKeyRotate, actorID(r), auditKindAPIKey, old.ID, "", map[string]interface{}{
+		"name":          old.Name,
+		"new_key_id":    created.ID,
+		"grace_seconds": req.GraceSeconds,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// handles admins revoking a key immediately
+func (gs *GameServer) revokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var req struct {
+		ID     string `json:"id"`
+		Reason string `json:"reason"`
+	}
+
+	if err := json.Unmarshal(data, &req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	key, exists := gs.apiKeys.Get(req.ID)
+	if !exists || !key.RevokedAt.IsZero() {
+		http.Error(w, "Key not found", http.StatusNotFound)
+		return
+	}
+
+	key, _ = gs.apiKeys.Update(req.ID, func(k *apikey.Key) {
+		k.RevokedAt = gs.clock.Now()
+	})
+	gs.goWrite(func() { gs.retireAPIKey(key) })
+
+	gs.audit(moderation.ActionKeyRevoke, actorID(r), auditKindAPIKey, key.ID, req.Reason, map[string]interface{}{
+		"name": key.Name,
+	})
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handles requests for every API key, newest first. Hashes are never included
+func (gs *GameServer) listAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Keys []apikey.Key `json:"keys"`
+	}{
+		Keys: gs.apiKeys.List(),
+	})
+}
+
+// storeAPIKey stores a new key's hash in the Supabase api_keys table
+func (gs *GameServer) storeAPIKey(key apikey.Key) {
+	record := map[string]interface{}{
+		"id":           key.ID,
+		"name":         key.Name,
+		"scopes":       key.Scopes,
+		"hash":         key.Hash,
+		"created_at":   key.CreatedAt.UTC().Format(time.RFC3339),
+		"expires_at":   nil,
+		"rotated_from": nil,
+	}
+	if !key.ExpiresAt.IsZero() {
+		record["expires_at"] = key.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	if key.RotatedFrom != "" {
+		record["rotated_from"] = key.RotatedFrom
+	}
+
+	client := gs.dbClient.GetSystemClient()
+	_, _, err := client.From("api_keys").Insert(record, false, "", "", "").Execute()
+	if err != nil {
+		gs.logf("[ERROR] Failed to store API key %s: %v", key.ID, err)
+	}
+}
+
+// retireAPIKey stores a rotated or revoked key's new expiry or revocation time
+func (gs *GameServer) retireAPIKey(key apikey.Key) {
+	update := map[string]interface{}{}
+	if !key.ExpiresAt.IsZero() {
+		update["expires_at"] = key.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	if !key.RevokedAt.IsZero() {
+		update["revoked_at"] = key.RevokedAt.UTC().Format(time.RFC3339)
+	}
+
+	client := gs.dbClient.GetSystemClient()
+	_, _, err := client.From("api_keys").Update(update, "", "").Eq("id", key.ID).Execute()
+	if err != nil {
+		gs.logf("[ERROR] Failed to update API key %s: %v", key.ID, err)
+	}
+}
+
+// loadAPIKeys restores the keys that haven't been revoked when the server starts
+// Expired keys are kept so they still show up in the key list
+func (gs *GameServer) loadAPIKeys() {
+	var rows []struct {
+		ID          string         `json:"id"`
+		Name        string         `json:"name"`
+		Scopes      []apikey.Scope `json:"scopes"`
+		Hash        string         `json:"hash"`
+		CreatedAt   time.Time      `json:"created_at"`
+		ExpiresAt   *time.Time     `json:"expires_at"`
+		RotatedFrom *string        `json:"rotated_from"`
+	}
+
+	client := gs.dbClient.GetSystemClient()
+	_, err := client.From("api_keys").
+		Select("id,name,scopes,hash,created_at,expires_at,rotated_from", "", false).
+		Is("revoked_at", "null").
+		Order("created_at", &postgrest.OrderOpts{Ascending: false}).
+		ExecuteTo(&rows)
+	if err != nil {
+		gs.logf("[ERROR] Failed to load API keys: %v", err)
+		return
+	}
+
+	for _, row := range rows {
+		key := apikey.Key{
+			ID:        row.ID,
+			Name:      row.Name,
+			Scopes:    row.Scopes,
+			Hash:      row.Hash,
+			CreatedAt: row.CreatedAt,
+		}
+		if row.ExpiresAt != nil {
+			key.ExpiresAt = *row.ExpiresAt
+		}
+		if row.RotatedFrom != nil {
+			key.RotatedFrom = *row.RotatedFrom
+		}
+		// Keys created since startup are newer than anything stored
+		if _, exists := gs.apiKeys.Get(key.ID); !exists {
+			gs.apiKeys.Put(key)
+		}
+	}
+
+	gs.logf("[SUCCESS] Loaded %d API keys", len(rows))
+}
@@ -0,0 +1,298 @@
+package ws
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vindennt/akasha-showdown-engine/internal/game"
+	"github.com/vindennt/akasha-showdown-engine/internal/logging"
+)
+
+// challenge is a pending direct challenge from one player to another
+// Accepting starts a series between them straight away, without the matchmaking queue
+type challenge struct {
+	ID        string
+	FromID    int
+	ToID      int
+	Series    SeriesOptions
+	ExpiresAt time.Time
+}
+
+func (c *challenge) message() Challenge {
+	return Challenge{
+		Type:        "CHALLENGE",
+		ChallengeID: c.ID,
+		FromID:      c.FromID,
+		ToID:        c.ToID,
+		Mode:        c.Series.Mode,
+		BestOf:      c.Series.BestOf,
+		Ranked:      c.Series.Ranked,
+		ExpiresAt:   c.ExpiresAt.UnixMilli(),
+	}
+}
+
+// available reports whether a player is connected and free to start a match
+func (gs *GameServer) available(id int) bool {
+	state := gs.presenceOf(id)
+	return state == PresenceOnline || state == PresenceIdle
+}
+
+// cancelChallenge removes a pending challenge and tells both players why
+// Does nothing if the challenge was already answered
+func (gs *GameServer) cancelChallenge(id, reason string) {
+	gs.challengesMutex.Lock()
+	c, exists := gs.challenges[id]
+	delete(gs.challenges, id)
+	gs.challengesMutex.Unlock()
+
+	if !exists {
+		return
+	}
+
+	gs.logf("[CHALLENGE] Challenge %s from user %d to user %d cancelled: %s", c.ID, c.FromID, c.ToID, reason)
+
+	msg, _ := json.Marshal(ChallengeCancelled{
+		Type:        "CHALLENGE_CANCELLED",
+		ChallengeID: c.ID,
+		Reason:      reason,
+	})
+	gs.sendTo(c.FromID, msg)
+	gs.sendTo(c.ToID, msg)
+}
+
+// handles challenging another player to a series
+// Challenges are unranked unless ranked is set
+func (gs *GameServer) sendChallengeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var req struct {
+		UserID   int    `json:"user_id"`
+		TargetID int    `json:"target_id"`
+		Mode     string `json:"mode"`
+		BestOf   int    `json:"best_of"`
+		Ranked   bool   `json:"ranked"`
+	}
+
+	if err := json.Unmarshal(data, &req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	r = r.WithContext(logging.With(r.Context(), "user_id", req.UserID))
+
+	challenger, ok := gs.authorize(w, r, req.UserID)
+	if !ok {
+		return
+	}
+
+	opts := SeriesOptions{Mode: req.Mode, BestOf: req.BestOf, Ranked: req.Ranked}
+	if opts.Mode == "" {
+		opts.Mode = game.DefaultMode
+	}
+	if opts.BestOf == 0 {
+		opts.BestOf = 1
+	}
+	if !game.ValidMode(opts.Mode) {
+		http.Error(w, "Unknown game mode", http.StatusBadRequest)
+		return
+	}
+	if !validBestOf(opts.BestOf) {
+		http.Error(w, "best_of must be 1, 3 or 5", http.StatusBadRequest)
+		return
+	}
+	if req.UserID == req.TargetID {
+		http.Error(w, "Cannot challenge yourself", http.StatusBadRequest)
+		return
+	}
+
+	if ban, banned := gs.banned(challenger, r); banned {
+		http.Error(w, ban.Message(), http.StatusForbidden)
+		return
+	}
+	if gs.rejectDraining(w) {
+		return
+	}
+
+	if gs.blockedEither(gs.accountOf(req.UserID), gs.accountOf(req.TargetID)) {
+		http.Error(w, "Cannot challenge this user", http.StatusForbidden)
+		return
+	}
+	if !gs.available(req.UserID) {
+		http.Error(w, "You are not available to play", http.StatusConflict)
+		return
+	}
+	if !gs.available(req.TargetID) {
+		http.Error(w, "User is not available to play", http.StatusConflict)
+		return
+	}
+
+	c := &challenge{
+		ID:        uuid.New().String(),
+		FromID:    req.UserID,
+		ToID:      req.TargetID,
+		Series:    opts,
+		ExpiresAt: gs.clock.Now().Add(gs.challengeTimeout),
+	}
+
+	gs.challengesMutex.Lock()
+	for _, other := range gs.challenges {
+		if other.FromID == c.FromID && other.ToID == c.ToID {
+			gs.challengesMutex.Unlock()
+			http.Error(w, "Challenge already sent", http.StatusConflict)
+			return
+		}
+	}
+	gs.challenges[c.ID] = c
+	gs.challengesMutex.Unlock()
+
+	gs.logc(r.Context(), "[CHALLENGE] User %d challenged user %d to %s best of %d (ranked: %t)", c.FromID, c.ToID, opts.Mode, opts.BestOf, opts.Ranked)
+
+	msg, _ := json.Marshal(c.message())
+	gs.sendTo(c.ToID, msg)
+	gs.sendTo(c.FromID, msg)
+
+	go func() {
+		<-gs.clock.After(gs.challengeTimeout)
+		gs.cancelChallenge(c.ID, "expired")
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(struct {
+		ChallengeID string `json:"challenge_id"`
+	}{c.ID})
+}
+
+// handles the challenged player accepting or declining
+func (gs *GameServer) respondChallengeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var req struct {
+		ChallengeID string `json:"challenge_id"`
+		UserID      int    `json:"user_id"`
+		Accept      bool   `json:"accept"`
+	}
+
+	if err := json.Unmarshal(data, &req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	r = r.WithContext(logging.With(r.Context(), "challenge_id", req.ChallengeID, "user_id", req.UserID))
+
+	if _, ok := gs.authorize(w, r, req.UserID); !ok {
+		return
+	}
+
+	gs.challengesMutex.Lock()
+	c, exists := gs.challenges[req.ChallengeID]
+	gs.challengesMutex.Unlock()
+
+	if !exists {
+		http.Error(w, "Challenge not found", http.StatusNotFound)
+		return
+	}
+	if c.ToID != req.UserID {
+		http.Error(w, "Only the challenged player can answer", http.StatusForbidden)
+		return
+	}
+
+	if !req.Accept {
+		gs.cancelChallenge(c.ID, "declined")
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if gs.rejectDraining(w) {
+		return
+	}
+
+	// Either player may have queued or started another match since
+	if !gs.available(c.FromID) || !gs.available(c.ToID) {
+		gs.cancelChallenge(c.ID, "unavailable")
+		http.Error(w, "A player is no longer available", http.StatusConflict)
+		return
+	}
+
+	// Only the first accept wins if it races with expiry or a cancel
+	gs.challengesMutex.Lock()
+	_, exists = gs.challenges[c.ID]
+	delete(gs.challenges, c.ID)
+	gs.challengesMutex.Unlock()
+
+	if !exists {
+		http.Error(w, "Challenge not found", http.StatusNotFound)
+		return
+	}
+
+	gs.logc(r.Context(), "[CHALLENGE] User %d accepted challenge %s from user %d", c.ToID, c.ID, c.FromID)
+
+	// Challenger moves first in game 1
+	go gs.startSeries(c.FromID, c.ToID, c.Series)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handles the challenger withdrawing a challenge before it is answered
+func (gs *GameServer) cancelChallengeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var req struct {
+		ChallengeID string `json:"challenge_id"`
+		UserID      int    `json:"user_id"`
+	}
+
+	if err := json.Unmarshal(data, &req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	r = r.WithContext(logging.With(r.Context(), "challenge_id", req.ChallengeID, "user_id", req.UserID))
+
+	if _, ok := gs.authorize(w, r, req.UserID); !ok {
+		return
+	}
+
+	gs.challengesMutex.Lock()
+	c, exists := gs.challenges[req.ChallengeID]
+	gs.challengesMutex.Unlock()
+
+	if !exists {
+		http.Error(w, "Challenge not found", http.StatusNotFound)
+		return
+	}
+	if c.FromID != req.UserID {
+		http.Error(w, "Only the challenger can cancel", http.StatusForbidden)
+		return
+	}
+
+	gs.cancelChallenge(c.ID, "cancelled")
+
+	w.WriteHeader(http.StatusAccepted)
+}
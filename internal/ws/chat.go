@@ -0,0 +1,453 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/supabase-community/postgrest-go"
+	"github.com/vindennt/akasha-showdown-engine/internal/chatfilter"
+	"github.com/vindennt/akasha-showdown-engine/internal/logging"
+	"github.com/vindennt/akasha-showdown-engine/internal/moderation"
+)
+
+// How often expired chat is pruned from memory and the database
+const chatSweepInterval = time.Minute * 10
+
+// Chat history page limits
+const (
+	defaultChatHistoryLimit = 50
+	maxChatHistoryLimit     = 200
+)
+
+// Default mute when a moderator doesn't give a duration
+const defaultMuteDuration = time.Minute * 10
+
+// newChatFilter builds the moderation pipeline every chat message goes through
+func newChatFilter(maxLength int, blockedWords []string, censor, blockLinks bool, spam *chatfilter.SpamDetector) *chatfilter.Pipeline {
+	checks := []chatfilter.Check{
+		chatfilter.MaxLength(maxLength),
+		chatfilter.WordFilter(blockedWords, censor),
+	}
+	if blockLinks {
+		checks = append(checks, chatfilter.BlockLinks())
+	}
+	checks = append(checks, spam.Check)
+	return chatfilter.New(checks...)
+}
+
+// chatFilterStatus maps a rejection from the chat filter to an HTTP status
+func chatFilterStatus(err error) int {
+	if errors.Is(err, chatfilter.ErrSpam) || errors.Is(err, chatfilter.ErrRepeat) {
+		return http.StatusTooManyRequests
+	}
+	return http.StatusBadRequest
+}
+
+// appendChatLocked adds a message to its lobby's history, dropping the oldest past the limit
+// Caller must hold chatMutex
+func (gs *GameServer) appendChatLocked(msg ChatMessage) {
+	history := append(gs.chatHistory[msg.LobbyID], msg)
+	if len(history) > gs.chatHistoryLimit {
+		history = slices.Clone(history[len(history)-gs.chatHistoryLimit:])
+	}
+	gs.chatHistory[msg.LobbyID] = history
+}
+
+// muteKey is who a mute applies to. Signed in users are muted by account so
+// reconnecting doesn't lift it, and guests by IP since they have nothing else
+type muteKey struct {
+	Kind   string // moderation.KindAccount or moderation.KindIP
+	Target string
+}
+
+func muteKeyFor(s *Subscriber) muteKey {
+	if s.account != "" {
+		return muteKey{moderation.KindAccount, s.account}
+	}
+	return muteKey{moderation.KindIP, s.ip}
+}
+
+// mutedUntil returns when a subscriber's mute ends, or the zero time if they aren't muted
+func (gs *GameServer) mutedUntil(s *Subscriber) time.Time {
+	gs.chatMutex.Lock()
+	defer gs.chatMutex.Unlock()
+
+	until, ok := gs.mutes[muteKeyFor(s)]
+	if !ok || !gs.clock.Now().Before(until) {
+		return time.Time{}
+	}
+	return until
+}
+
+// chatLoop prunes expired chat and idle spam history
+func (gs *GameServer) chatLoop() {
+	ticker := gs.clock.NewTicker(chatSweepInterval)
+	defer ticker.Stop()
+
+	for range ticker.C() {
+		now := gs.clock.Now()
+		cutoff := now.Add(-gs.chatRetention)
+
+		gs.chatMutex.Lock()
+		for lobbyID, history := range gs.chatHistory {
+			i := 0
+			for i < len(history) && history[i].Timestamp < cutoff.Unix() {
+				i++
+			}
+			gs.chatHistory[lobbyID] = history[i:]
+		}
+		for key, until := range gs.mutes {
+			if !now.Before(until) {
+				delete(gs.mutes, key)
+			}
+		}
+		gs.chatMutex.Unlock()
+
+		gs.settings.Load().spamDetector.Forget(now)
+		gs.purgeChat(cutoff)
+	}
+}
+
+// broadcastTombstone tells a lobby that messages were removed or a user was muted
+func (gs *GameServer) broadcastTombstone(ctx context.Context, t ChatTombstone) {
+	t.Type = "CHAT_TOMBSTONE"
+	msg, _ := json.Marshal(t)
+	gs.publishToLobby(ctx, t.LobbyID, msg)
+}
+
+// handles fetching a lobby's chat history, oldest first
+// Query: before (unix seconds, exclusive), limit, user_id (hides accounts they blocked, must be the caller)
+func (gs *GameServer) chatHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	lobbyID := r.PathValue("id")
+
+	limit := defaultChatHistoryLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if v, err := strconv.Atoi(l); err == nil && v > 0 {
+			limit = min(v, maxChatHistoryLimit)
+		}
+	}
+
+	var before int64
+	if b := r.URL.Query().Get("before"); b != "" {
+		v, err := strconv.ParseInt(b, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid before timestamp", http.StatusBadRequest)
+			return
+		}
+		before = v
+	}
+
+	var blocked map[string]bool
+	if v := r.URL.Query().Get("user_id"); v != "" {
+		userID, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+		s, ok := gs.authorize(w, r, userID)
+		if !ok {
+			return
+		}
+		gs.socialMutex.Lock()
+		blocked = maps.Clone(gs.blocks[s.account])
+		gs.socialMutex.Unlock()
+	}
+
+	gs.lobbiesMutex.Lock()
+	_, exists := gs.lobbies[lobbyID]
+	gs.lobbiesMutex.Unlock()
+	if !exists {
+		http.Error(w, "Lobby not found", http.StatusNotFound)
+		return
+	}
+
+	gs.chatMutex.Lock()
+	history := gs.chatHistory[lobbyID]
+	if len(blocked) > 0 {
+		history = slices.DeleteFunc(slices.Clone(history), func(m ChatMessage) bool { return blocked[m.SenderAccount] })
+	}
+	end := len(history)
+	if before > 0 {
+		for end > 0 && history[end-1].Timestamp >= before {
+			end--
+		}
+	}
+	messages := slices.Clone(history[max(end-limit, 0):end])
+	gs.chatMutex.Unlock()
+
+	if messages == nil {
+		messages = make([]ChatMessage, 0)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		LobbyID  string        `json:"lobby_id"`
+		Messages []ChatMessage `json:"messages"`
+	}{
+		LobbyID:  lobbyID,
+		Messages: messages,
+	})
+}
+
+// handles moderators deleting a chat message
+func (gs *GameServer) deleteChatHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var req struct {
+		LobbyID   string `json:"lobby_id"`
+		MessageID string `json:"message_id"`
+	}
+
+	if err := json.Unmarshal(data, &req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	r = r.WithContext(logging.With(r.Context(), "lobby_id", req.LobbyID))
+
+	gs.chatMutex.Lock()
+	history := gs.chatHistory[req.LobbyID]
+	i := slices.IndexFunc(history, func(m ChatMessage) bool { return m.ID == req.MessageID })
+	var deleted ChatMessage
+	if i >= 0 {
+		deleted = history[i]
+		gs.chatHistory[req.LobbyID] = slices.Delete(slices.Clone(history), i, i+1)
+	}
+	gs.chatMutex.Unlock()
+
+	if i < 0 {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+
+	moderator := actorID(r)
+	gs.audit(moderation.ActionDeleteMessage, moderator, "message", req.MessageID, "", map[string]interface{}{
+		"lobby_id":  req.LobbyID,
+		"sender_id": deleted.SenderID,
+		"message":   deleted.Message,
+	})
+
+	gs.goWrite(func() { gs.markChatDeleted([]string{req.MessageID}, moderator) })
+	gs.broadcastTombstone(r.Context(), ChatTombstone{
+		Action:      "delete",
+		LobbyID:     req.LobbyID,
+		MessageIDs:  []string{req.MessageID},
+		ModeratorID: moderator,
+	})
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handles moderators muting or unmuting a connected user in chat
+// The mute is kept against their account, or their IP for guests
+// With purge set, the user's messages still in history are deleted too
+func (gs *GameServer) muteChatHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var req struct {
+		UserID          int    `json:"user_id"`
+		LobbyID         string `json:"lobby_id"` // Where to announce it, defaults to global
+		DurationSeconds int    `json:"duration_seconds"`
+		Purge           bool   `json:"purge"`
+		Unmute          bool   `json:"unmute"`
+		Reason          string `json:"reason"`
+	}
+
+	if err := json.Unmarshal(data, &req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if req.LobbyID == "" {
+		req.LobbyID = "global"
+	}
+	r = r.WithContext(logging.With(r.Context(), "target_id", req.UserID, "lobby_id", req.LobbyID))
+
+	if req.DurationSeconds < 0 {
+		http.Error(w, "duration_seconds cannot be negative", http.StatusBadRequest)
+		return
+	}
+
+	target := gs.GetSubscriber(req.UserID)
+	if target == nil {
+		http.Error(w, "Subscriber not found", http.StatusNotFound)
+		return
+	}
+	key := muteKeyFor(target)
+
+	moderator := actorID(r)
+	tombstone := ChatTombstone{
+		Action:      moderation.ActionMute,
+		LobbyID:     req.LobbyID,
+		MessageIDs:  make([]string, 0),
+		UserID:      req.UserID,
+		ModeratorID: moderator,
+		Reason:      req.Reason,
+	}
+
+	gs.chatMutex.Lock()
+	if req.Unmute {
+		delete(gs.mutes, key)
+		tombstone.Action = moderation.ActionUnmute
+	} else {
+		duration := defaultMuteDuration
+		if req.DurationSeconds > 0 {
+			duration = time.Duration(req.DurationSeconds) * time.Second
+		}
+		until := gs.clock.Now().Add(duration)
+		gs.mutes[key] = until
+		tombstone.MutedUntil = until.Unix()
+	}
+
+	if req.Purge {
+		for lobbyID, history := range gs.chatHistory {
+			kept := make([]ChatMessage, 0, len(history))
+			for _, m := range history {
+				if m.SenderID == req.UserID || (target.account != "" && m.SenderAccount == target.account) {
+					tombstone.MessageIDs = append(tombstone.MessageIDs, m.ID)
+				} else {
+					kept = append(kept, m)
+				}
+			}
+			gs.chatHistory[lobbyID] = kept
+		}
+	}
+	gs.chatMutex.Unlock()
+
+	details := map[string]interface{}{
+		"lobby_id": req.LobbyID,
+		"user_id":  req.UserID,
+		"purged":   tombstone.MessageIDs,
+	}
+	if tombstone.MutedUntil > 0 {
+		details["muted_until"] = time.Unix(tombstone.MutedUntil, 0).UTC().Format(time.RFC3339)
+	}
+	gs.audit(tombstone.Action, moderator, key.Kind, key.Target, req.Reason, details)
+
+	if len(tombstone.MessageIDs) > 0 {
+		gs.goWrite(func() { gs.markChatDeleted(tombstone.MessageIDs, moderator) })
+	}
+	gs.broadcastTombstone(r.Context(), tombstone)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// storeChatMessage stores a chat message in the Supabase chat_messages table
+func (gs *GameServer) storeChatMessage(ctx context.Context, msg ChatMessage) {
+	record := map[string]interface{}{
+		"id":        msg.ID,
+		"lobby_id":  msg.LobbyID,
+		"sender_id": msg.SenderID,
+		"message":   msg.Message,
+		"sent_at":   time.Unix(msg.Timestamp, 0).UTC().Format(time.RFC3339),
+	}
+	if msg.SenderAccount != "" {
+		record["sender_account"] = msg.SenderAccount
+	}
+
+	client := gs.dbClient.GetSystemClient()
+	_, _, err := client.From("chat_messages").Insert(record, false, "", "", "").ExecuteWithContext(ctx)
+	if err != nil {
+		gs.logc(ctx, "[ERROR] Failed to store chat message %s: %v", msg.ID, err)
+	}
+}
+
+// markChatDeleted soft deletes messages so they stay available for review
+func (gs *GameServer) markChatDeleted(ids []string, moderator string) {
+	update := map[string]interface{}{
+		"deleted":    true,
+		"deleted_by": moderator,
+	}
+
+	client := gs.dbClient.GetSystemClient()
+	_, _, err := client.From("chat_messages").Update(update, "", "").In("id", ids).Execute()
+	if err != nil {
+		gs.logf("[ERROR] Failed to mark %d chat messages deleted: %v", len(ids), err)
+	}
+}
+
+// purgeChat deletes stored messages older than the retention cutoff
+func (gs *GameServer) purgeChat(cutoff time.Time) {
+	client := gs.dbClient.GetSystemClient()
+	_, _, err := client.From("chat_messages").Delete("", "").Lt("sent_at", cutoff.UTC().Format(time.RFC3339)).Execute()
+	if err != nil {
+		gs.logf("[ERROR] Failed to purge expired chat: %v", err)
+	}
+}
+
+// loadChatHistory restores recent global lobby chat when the server starts
+func (gs *GameServer) loadChatHistory() {
+	var rows []struct {
+		ID            string    `json:"id"`
+		LobbyID       string    `json:"lobby_id"`
+		SenderID      int       `json:"sender_id"`
+		SenderAccount *string   `json:"sender_account"`
+		Message       string    `json:"message"`
+		SentAt        time.Time `json:"sent_at"`
+	}
+
+	client := gs.dbClient.GetSystemClient()
+	_, err := client.From("chat_messages").
+		Select("id,lobby_id,sender_id,sender_account,message,sent_at", "", false).
+		Eq("lobby_id", "global").
+		Is("deleted", "false").
+		Gte("sent_at", gs.clock.Now().Add(-gs.chatRetention).UTC().Format(time.RFC3339)).
+		Order("sent_at", &postgrest.OrderOpts{Ascending: false}).
+		Limit(gs.chatHistoryLimit, "").
+		ExecuteTo(&rows)
+	if err != nil {
+		gs.logf("[ERROR] Failed to load chat history: %v", err)
+		return
+	}
+
+	// Newest first from the query; history is oldest first
+	loaded := make([]ChatMessage, 0, len(rows))
+	for i := len(rows) - 1; i >= 0; i-- {
+		msg := ChatMessage{
+			Type:      "CHAT_MESSAGE",
+			ID:        rows[i].ID,
+			SenderID:  rows[i].SenderID,
+			Message:   rows[i].Message,
+			LobbyID:   rows[i].LobbyID,
+			Timestamp: rows[i].SentAt.Unix(),
+		}
+		if rows[i].SenderAccount != nil {
+			msg.SenderAccount = *rows[i].SenderAccount
+		}
+		loaded = append(loaded, msg)
+	}
+
+	gs.chatMutex.Lock()
+	// Anything sent since startup goes after the loaded history
+	history := append(loaded, gs.chatHistory["global"]...)
+	if len(history) > gs.chatHistoryLimit {
+		history = history[len(history)-gs.chatHistoryLimit:]
+	}
+	gs.chatHistory["global"] = history
+	gs.chatMutex.Unlock()
+
+	gs.logf("[CHAT] Loaded %d messages of global chat history", len(loaded))
+}
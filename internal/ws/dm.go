@@ -0,0 +1,407 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/supabase-community/postgrest-go"
+	"github.com/vindennt/akasha-showdown-engine/internal/chatfilter"
+	"github.com/vindennt/akasha-showdown-engine/internal/logging"
+)
+
+// Direct messages are between signed in accounts. They are delivered straight
+// away to the recipient's connections and stored in Supabase. Unread messages
+// are also kept in memory so they can be delivered when the recipient next connects
+
+// Most unread messages kept in memory per recipient, older ones are only in the database
+const maxPendingDirectMessages = 500
+
+// Conversation history page limits
+const (
+	defaultDirectMessageLimit = 50
+	maxDirectMessageLimit     = 200
+)
+
+// unreadCountsLocked counts an account's unread messages by sender
+// Caller must hold dmMutex
+func (gs *GameServer) unreadCountsLocked(account string) DirectMessageUnread {
+	unread := DirectMessageUnread{
+		Type:   "DM_UNREAD",
+		Unread: make(map[string]int),
+	}
+	for _, dm := range gs.pendingDMs[account] {
+		unread.Unread[dm.SenderID]++
+		unread.Total++
+	}
+	return unread
+}
+
+// deliverPendingDMs sends a newly connected subscriber their account's unread messages and counts
+func (gs *GameServer) deliverPendingDMs(s *Subscriber) {
+	gs.dmMutex.Lock()
+	pending := append([]DirectMessage(nil), gs.pendingDMs[s.account]...)
+	unread := gs.unreadCountsLocked(s.account)
+	gs.dmMutex.Unlock()
+
+	for _, dm := range pending {
+		msg, _ := json.Marshal(dm)
+		gs.sendTo(s.ID(), msg)
+	}
+
+	msg, _ := json.Marshal(unread)
+	gs.sendTo(s.ID(), msg)
+}
+
+// handles sending a direct message to an account
+// Goes through the same filter as lobby chat, and is refused if either user blocked the other
+func (gs *GameServer) sendDirectMessageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var req struct {
+		UserID      int    `json:"user_id"`
+		RecipientID string `json:"recipient_id"` // Account ID
+		Message     string `json:"message"`
+	}
+
+	if err := json.Unmarshal(data, &req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	r = r.WithContext(logging.With(r.Context(), "user_id", req.UserID))
+
+	sender, ok := gs.authorizeAccount(w, r, req.UserID)
+	if !ok {
+		return
+	}
+	if uuid.Validate(req.RecipientID) != nil {
+		http.Error(w, "recipient_id must be an account ID", http.StatusBadRequest)
+		return
+	}
+	if sender.account == req.RecipientID {
+		http.Error(w, "Cannot message yourself", http.StatusBadRequest)
+		return
+	}
+
+	if ban, banned := gs.banned(sender, r); banned {
+		http.Error(w, ban.Message(), http.StatusForbidden)
+		return
+	}
+
+	if gs.blockedEither(sender.account, req.RecipientID) {
+		http.Error(w, "Cannot message this user", http.StatusForbidden)
+		return
+	}
+
+	if until := gs.mutedUntil(sender); !until.IsZero() {
+		http.Error(w, "You are muted until "+until.UTC().Format(time.RFC3339), http.StatusForbidden)
+		return
+	}
+
+	now := gs.clock.Now()
+
+	filtered := chatfilter.Message{
+		SenderID: req.UserID,
+		Text:     req.Message,
+		At:       now,
+	}
+	if err := gs.settings.Load().chatFilter.Run(&filtered); err != nil {
+		gs.logc(r.Context(), "[DM] Rejected message from user %d: %v", req.UserID, err)
+		http.Error(w, err.Error(), chatFilterStatus(err))
+		return
+	}
+
+	dm := DirectMessage{
+		Type:        "DIRECT_MESSAGE",
+		ID:          uuid.New().String(),
+		SenderID:    sender.account,
+		RecipientID: req.RecipientID,
+		Message:     filtered.Text,
+		Timestamp:   now.Unix(),
+	}
+
+	gs.seen(sender)
+
+	gs.dmMutex.Lock()
+	pending := append(gs.pendingDMs[req.RecipientID], dm)
+	if len(pending) > maxPendingDirectMessages {
+		pending = pending[len(pending)-maxPendingDirectMessages:]
+	}
+	gs.pendingDMs[req.RecipientID] = pending
+	gs.dmMutex.Unlock()
+	ctx := context.WithoutCancel(r.Context())
+	gs.goWrite(func() { gs.storeDirectMessage(ctx, dm) })
+
+	gs.logc(r.Context(), "[DM] Account %s sent a message to account %s", dm.SenderID, dm.RecipientID)
+
+	// The sender gets a copy too so their other tabs stay in sync
+	msg, _ := json.Marshal(dm)
+	gs.sendToAccount(dm.RecipientID, msg)
+	gs.sendToAccount(dm.SenderID, msg)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handles marking a conversation read, which sends the other side a read receipt
+func (gs *GameServer) readDirectMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var req struct {
+		UserID int    `json:"user_id"`
+		PeerID string `json:"peer_id"` // Account ID
+	}
+
+	if err := json.Unmarshal(data, &req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	r = r.WithContext(logging.With(r.Context(), "user_id", req.UserID))
+
+	s, ok := gs.authorizeAccount(w, r, req.UserID)
+	if !ok {
+		return
+	}
+	account := s.account
+
+	gs.dmMutex.Lock()
+	pending := gs.pendingDMs[account]
+	kept := make([]DirectMessage, 0, len(pending))
+	for _, dm := range pending {
+		if dm.SenderID != req.PeerID {
+			kept = append(kept, dm)
+		}
+	}
+	if len(kept) == 0 {
+		delete(gs.pendingDMs, account)
+	} else {
+		gs.pendingDMs[account] = kept
+	}
+	unread := gs.unreadCountsLocked(account)
+	gs.dmMutex.Unlock()
+
+	readAt := gs.clock.Now()
+	gs.goWrite(func() { gs.markDirectMessagesRead(req.PeerID, account, readAt) })
+
+	receipt, _ := json.Marshal(DirectMessageRead{
+		Type:      "DM_READ",
+		AccountID: account,
+		PeerID:    req.PeerID,
+		ReadAt:    readAt.Unix(),
+	})
+	gs.sendToAccount(req.PeerID, receipt)
+
+	counts, _ := json.Marshal(unread)
+	gs.sendToAccount(account, counts)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handles requests for the caller's unread message counts
+// Query: user_id
+func (gs *GameServer) unreadDirectMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil {
+		http.Error(w, "user_id is required", http.StatusBadRequest)
+		return
+	}
+	s, ok := gs.authorizeAccount(w, r, userID)
+	if !ok {
+		return
+	}
+
+	gs.dmMutex.Lock()
+	unread := gs.unreadCountsLocked(s.account)
+	gs.dmMutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(unread)
+}
+
+// handles fetching the caller's conversation with another account, oldest first
+// Query: user_id, peer_id (account ID), before (unix seconds, exclusive), limit
+func (gs *GameServer) directMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil {
+		http.Error(w, "user_id is required", http.StatusBadRequest)
+		return
+	}
+	peerID := r.URL.Query().Get("peer_id")
+	if uuid.Validate(peerID) != nil {
+		http.Error(w, "peer_id must be an account ID", http.StatusBadRequest)
+		return
+	}
+	s, ok := gs.authorizeAccount(w, r, userID)
+	if !ok {
+		return
+	}
+	account := s.account
+
+	limit := defaultDirectMessageLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if v, err := strconv.Atoi(l); err == nil && v > 0 {
+			limit = min(v, maxDirectMessageLimit)
+		}
+	}
+
+	ids := []string{account, peerID}
+
+	client := gs.dbClient.GetSystemClient()
+	query := client.From("direct_messages").
+		Select("id,sender_id,recipient_id,message,sent_at,read_at", "", false).
+		In("sender_id", ids).
+		In("recipient_id", ids)
+	if b := r.URL.Query().Get("before"); b != "" {
+		v, err := strconv.ParseInt(b, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid before timestamp", http.StatusBadRequest)
+			return
+		}
+		query = query.Lt("sent_at", time.Unix(v, 0).UTC().Format(time.RFC3339))
+	}
+
+	var rows []struct {
+		ID          string     `json:"id"`
+		SenderID    string     `json:"sender_id"`
+		RecipientID string     `json:"recipient_id"`
+		Message     string     `json:"message"`
+		SentAt      time.Time  `json:"sent_at"`
+		ReadAt      *time.Time `json:"read_at"`
+	}
+	_, err = query.
+		Order("sent_at", &postgrest.OrderOpts{Ascending: false}).
+		Limit(limit, "").
+		ExecuteToWithContext(r.Context(), &rows)
+	if err != nil {
+		gs.logc(r.Context(), "[ERROR] Failed to load messages between accounts %s and %s: %v", account, peerID, err)
+		http.Error(w, "Failed to load messages", http.StatusInternalServerError)
+		return
+	}
+
+	// Newest first from the query; pages are oldest first
+	messages := make([]DirectMessage, 0, len(rows))
+	for i := len(rows) - 1; i >= 0; i-- {
+		messages = append(messages, DirectMessage{
+			Type:        "DIRECT_MESSAGE",
+			ID:          rows[i].ID,
+			SenderID:    rows[i].SenderID,
+			RecipientID: rows[i].RecipientID,
+			Message:     rows[i].Message,
+			Timestamp:   rows[i].SentAt.Unix(),
+			Read:        rows[i].ReadAt != nil,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		AccountID string          `json:"account_id"`
+		PeerID    string          `json:"peer_id"`
+		Messages  []DirectMessage `json:"messages"`
+	}{
+		AccountID: account,
+		PeerID:    peerID,
+		Messages:  messages,
+	})
+}
+
+// storeDirectMessage stores a direct message in the Supabase direct_messages table
+func (gs *GameServer) storeDirectMessage(ctx context.Context, dm DirectMessage) {
+	record := map[string]interface{}{
+		"id":           dm.ID,
+		"sender_id":    dm.SenderID,
+		"recipient_id": dm.RecipientID,
+		"message":      dm.Message,
+		"sent_at":      time.Unix(dm.Timestamp, 0).UTC().Format(time.RFC3339),
+	}
+
+	client := gs.dbClient.GetSystemClient()
+	_, _, err := client.From("direct_messages").Insert(record, false, "", "", "").ExecuteWithContext(ctx)
+	if err != nil {
+		gs.logc(ctx, "[ERROR] Failed to store direct message %s: %v", dm.ID, err)
+	}
+}
+
+// markDirectMessagesRead sets read_at on every unread message from sender to recipient
+func (gs *GameServer) markDirectMessagesRead(senderID, recipientID string, readAt time.Time) {
+	update := map[string]interface{}{
+		"read_at": readAt.UTC().Format(time.RFC3339),
+	}
+
+	client := gs.dbClient.GetSystemClient()
+	_, _, err := client.From("direct_messages").Update(update, "", "").
+		Eq("sender_id", senderID).
+		Eq("recipient_id", recipientID).
+		Is("read_at", "null").
+		Execute()
+	if err != nil {
+		gs.logf("[ERROR] Failed to mark messages from account %s to account %s read: %v", senderID, recipientID, err)
+	}
+}
+
+// loadPendingDirectMessages restores unread messages when the server starts
+func (gs *GameServer) loadPendingDirectMessages() {
+	var rows []struct {
+		ID          string    `json:"id"`
+		SenderID    string    `json:"sender_id"`
+		RecipientID string    `json:"recipient_id"`
+		Message     string    `json:"message"`
+		SentAt      time.Time `json:"sent_at"`
+	}
+
+	client := gs.dbClient.GetSystemClient()
+	_, err := client.From("direct_messages").
+		Select("id,sender_id,recipient_id,message,sent_at", "", false).
+		Is("read_at", "null").
+		Order("sent_at", &postgrest.OrderOpts{Ascending: true}).
+		ExecuteTo(&rows)
+	if err != nil {
+		gs.logf("[ERROR] Failed to load unread direct messages: %v", err)
+		return
+	}
+
+	loaded := make(map[string][]DirectMessage)
+	for _, row := range rows {
+		loaded[row.RecipientID] = append(loaded[row.RecipientID], DirectMessage{
+			Type:        "DIRECT_MESSAGE",
+			ID:          row.ID,
+			SenderID:    row.SenderID,
+			RecipientID: row.RecipientID,
+			Message:     row.Message,
+			Timestamp:   row.SentAt.Unix(),
+		})
+	}
+
+	gs.dmMutex.Lock()
+	// Anything sent since startup goes after the loaded messages
+	for account, pending := range loaded {
+		pending = append(pending, gs.pendingDMs[account]...)
+		if len(pending) > maxPendingDirectMessages {
+			pending = pending[len(pending)-maxPendingDirectMessages:]
+		}
+		gs.pendingDMs[account] = pending
+	}
+	gs.dmMutex.Unlock()
+
+	gs.logf("[DM] Loaded %d unread direct messages for %d accounts", len(rows), len(loaded))
+}
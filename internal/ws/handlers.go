@@ -10,41 +10,66 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/vindennt/akasha-showdown-engine/internal/chatfilter"
+	"github.com/vindennt/akasha-showdown-engine/internal/game"
+	"github.com/vindennt/akasha-showdown-engine/internal/logging"
+	"github.com/vindennt/akasha-showdown-engine/internal/metrics"
+	"github.com/vindennt/akasha-showdown-engine/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // publishes a message to all subscribers in a specific lobby
-func (gs *GameServer) publishToLobby(lobbyID string, msg []byte) {
+func (gs *GameServer) publishToLobby(ctx context.Context, lobbyID string, msg []byte) {
+	gs.publishToLobbyExcept(ctx, lobbyID, msg, nil)
+}
+
+// publishes a message to the subscribers in a lobby that skip doesn't exclude
+// skip is called with the lobby locked, so it must not take lobby locks
+// ctx carries the attributes to log the publish with
+func (gs *GameServer) publishToLobbyExcept(ctx context.Context, lobbyID string, msg []byte, skip func(s *Subscriber) bool) {
+	ctx = logging.With(ctx, "lobby_id", lobbyID)
+
 	gs.lobbiesMutex.Lock()
 	lobby, exists := gs.lobbies[lobbyID]
 	gs.lobbiesMutex.Unlock()
 
 	if !exists {
-		gs.logf("[ERROR] Lobby '%s' does not exist", lobbyID)
+		gs.logc(ctx, "[ERROR] Lobby '%s' does not exist", lobbyID)
 		return
 	}
 
 	lobby.mutex.Lock()
 	subscriberCount := len(lobby.subscribers)
-	gs.logf("[PUBLISH] Publishing message to lobby '%s' with %d subscribers", lobbyID, subscriberCount)
+	gs.logc(ctx, "[PUBLISH] Publishing message to lobby '%s' with %d subscribers", lobbyID, subscriberCount)
 	lobby.mutex.Unlock()
 
+	start := time.Now()
+	defer func() {
+		metrics.PublishDuration.WithLabelValues("lobby").Observe(time.Since(start).Seconds())
+	}()
+
 	// Rate limit
-	gs.publishLimiter.Wait(context.Background())
+	gs.settings.Load().publishLimiter.Wait(context.Background())
 
 	lobby.mutex.Lock()
 	defer lobby.mutex.Unlock()
 
 	sentCount := 0
 	for _, s := range lobby.subscribers {
+		if skip != nil && skip(s) {
+			continue
+		}
 		select {
 		case s.messc <- msg:
 			sentCount++
 		default:
-			gs.logf("[WARN] Subscriber %d channel full, closing slow", s.ID())
+			gs.logc(s.ctx, "[WARN] Subscriber %d channel full, closing slow", s.ID())
+			metrics.MessagesDropped.WithLabelValues("subscriber_full").Inc()
 			s.closeSlow()
 		}
 	}
-	gs.logf("[PUBLISH] Message sent to %d/%d subscribers in lobby '%s'", sentCount, subscriberCount, lobbyID)
+	gs.logc(ctx, "[PUBLISH] Message sent to %d/%d subscribers in lobby '%s'", sentCount, subscriberCount, lobbyID)
 }
 
 // handles incoming chat messages
@@ -54,33 +79,82 @@ func (gs *GameServer) chatHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	body := http.MaxBytesReader(w, r.Body, 8192)
-	msgData, err := io.ReadAll(body)
+	msgData, err := io.ReadAll(r.Body)
 	if err != nil {
 		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
 		return
 	}
 
-	gs.logf("[CHAT] Received chat message: %s", string(msgData))
+	gs.logc(r.Context(), "[CHAT] Received chat message: %s", string(msgData))
 
 	var chatMsg ChatMessage
 	if err := json.Unmarshal(msgData, &chatMsg); err != nil {
-		gs.logf("[ERROR] Failed to parse chat message: %v", err)
+		gs.logc(r.Context(), "[ERROR] Failed to parse chat message: %v", err)
 		http.Error(w, "Invalid message format", http.StatusBadRequest)
 		return
 	}
+	r = r.WithContext(logging.With(r.Context(), "user_id", chatMsg.SenderID, "lobby_id", chatMsg.LobbyID))
+
+	sender, ok := gs.authorize(w, r, chatMsg.SenderID)
+	if !ok {
+		return
+	}
+
+	gs.lobbiesMutex.Lock()
+	_, exists := gs.lobbies[chatMsg.LobbyID]
+	gs.lobbiesMutex.Unlock()
+	if !exists {
+		http.Error(w, "Lobby not found", http.StatusNotFound)
+		return
+	}
+
+	if ban, banned := gs.banned(sender, r); banned {
+		http.Error(w, ban.Message(), http.StatusForbidden)
+		return
+	}
 
-	if chatMsg.Timestamp == 0 {
-		chatMsg.Timestamp = time.Now().Unix()
+	if until := gs.mutedUntil(sender); !until.IsZero() {
+		http.Error(w, "You are muted until "+until.UTC().Format(time.RFC3339), http.StatusForbidden)
+		return
+	}
+
+	// Server time, so history order and retention can't be spoofed
+	now := gs.clock.Now()
+
+	filtered := chatfilter.Message{
+		SenderID: chatMsg.SenderID,
+		LobbyID:  chatMsg.LobbyID,
+		Text:     chatMsg.Message,
+		At:       now,
+	}
+	if err := gs.settings.Load().chatFilter.Run(&filtered); err != nil {
+		gs.logc(r.Context(), "[CHAT] Rejected message from user %d: %v", chatMsg.SenderID, err)
+		http.Error(w, err.Error(), chatFilterStatus(err))
+		return
 	}
 
 	chatMsg.Type = "CHAT_MESSAGE"
+	chatMsg.ID = uuid.New().String()
+	chatMsg.Message = filtered.Text
+	chatMsg.Timestamp = now.Unix()
+	chatMsg.SenderAccount = sender.account
+
+	// Chatting counts as activity for presence
+	gs.seen(sender)
+
+	gs.chatMutex.Lock()
+	gs.appendChatLocked(chatMsg)
+	gs.chatMutex.Unlock()
+	ctx := context.WithoutCancel(r.Context())
+	gs.goWrite(func() { gs.storeChatMessage(ctx, chatMsg) })
 
-	gs.logf("[CHAT] User %d sending message to lobby '%s': %s", chatMsg.SenderID, chatMsg.LobbyID, chatMsg.Message)
+	gs.logc(r.Context(), "[CHAT] User %d sending message to lobby '%s': %s", chatMsg.SenderID, chatMsg.LobbyID, chatMsg.Message)
 
-	// Serialize and publish to the lobby
+	// Serialize and publish to the lobby, except to anyone who blocked the sender
 	msg, _ := json.Marshal(chatMsg)
-	gs.publishToLobby(chatMsg.LobbyID, msg)
+	gs.publishToLobbyExcept(r.Context(), chatMsg.LobbyID, msg, func(s *Subscriber) bool {
+		return gs.hasBlocked(s.account, chatMsg.SenderAccount)
+	})
 
 	w.WriteHeader(http.StatusAccepted)
 }
@@ -92,8 +166,7 @@ func (gs *GameServer) joinLobbyHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	body := http.MaxBytesReader(w, r.Body, 8192)
-	data, err := io.ReadAll(body)
+	data, err := io.ReadAll(r.Body)
 	if err != nil {
 		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
 		return
@@ -108,9 +181,10 @@ func (gs *GameServer) joinLobbyHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request format", http.StatusBadRequest)
 		return
 	}
+	r = r.WithContext(logging.With(r.Context(), "user_id", req.UserID, "lobby_id", req.LobbyID))
 
 	// TODO: Implement actual lobby switching logic
-	gs.logf("User %d requested to join lobby %s", req.UserID, req.LobbyID)
+	gs.logc(r.Context(), "User %d requested to join lobby %s", req.UserID, req.LobbyID)
 
 	w.WriteHeader(http.StatusAccepted)
 }
@@ -122,121 +196,303 @@ func (gs *GameServer) joinQueueHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	body := http.MaxBytesReader(w, r.Body, 8192)
-	data, err := io.ReadAll(body)
+	data, err := io.ReadAll(r.Body)
 	if err != nil {
 		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
 		return
 	}
 
+	// Mode and series length are optional and default to a single duel
 	var req struct {
-		UserID int `json:"user_id"`
+		UserID int    `json:"user_id"`
+		Mode   string `json:"mode"`
+		BestOf int    `json:"best_of"`
 	}
 
 	if err := json.Unmarshal(data, &req); err != nil {
 		http.Error(w, "Invalid request format", http.StatusBadRequest)
 		return
 	}
+	r = r.WithContext(logging.With(r.Context(), "user_id", req.UserID))
+
+	caller, ok := gs.authorize(w, r, req.UserID)
+	if !ok {
+		return
+	}
+
+	// Queued matches are always ranked
+	opts := SeriesOptions{Mode: req.Mode, BestOf: req.BestOf, Ranked: true}
+	if opts.Mode == "" {
+		opts.Mode = game.DefaultMode
+	}
+	if opts.BestOf == 0 {
+		opts.BestOf = 1
+	}
+	if !game.ValidMode(opts.Mode) {
+		http.Error(w, "Unknown game mode", http.StatusBadRequest)
+		return
+	}
+	if !validBestOf(opts.BestOf) {
+		http.Error(w, "best_of must be 1, 3 or 5", http.StatusBadRequest)
+		return
+	}
+
+	if ban, banned := gs.banned(caller, r); banned {
+		http.Error(w, ban.Message(), http.StatusForbidden)
+		return
+	}
+	if gs.rejectDraining(w) {
+		return
+	}
+	if gs.inMatch(req.UserID) {
+		http.Error(w, "Already in a match", http.StatusConflict)
+		return
+	}
+
+	// Set before queueing so the match start always broadcasts after it
+	// Already queued players are in the queue state anyway
+	gs.setPresence(req.UserID, PresenceInQueue)
 
 	gs.queueMutex.Lock()
-	gs.matchmakingQueue = append(gs.matchmakingQueue, req.UserID)
+	// Draining may have cleared the queue since the check above
+	if gs.Draining() {
+		gs.queueMutex.Unlock()
+		gs.setPresence(req.UserID, PresenceOnline)
+		gs.rejectDraining(w)
+		return
+	}
+	if gs.queuedLocked(req.UserID) {
+		gs.queueMutex.Unlock()
+		http.Error(w, "Already in the queue", http.StatusConflict)
+		return
+	}
+	gs.matchmakingQueue = append(gs.matchmakingQueue, queueEntry{UserID: req.UserID, Series: opts, JoinedAt: gs.clock.Now()})
 	queueSize := len(gs.matchmakingQueue)
-	gs.logf("User %d joined queue. Queue size: %d", req.UserID, queueSize)
+	gs.logc(r.Context(), "User %d joined queue for %s best of %d. Queue size: %d", req.UserID, opts.Mode, opts.BestOf, queueSize)
 
-	// Check if we can make a match (2+ players)
-	if queueSize >= 2 {
-		player1 := gs.matchmakingQueue[0]
-		player2 := gs.matchmakingQueue[1]
-		gs.matchmakingQueue = gs.matchmakingQueue[2:]
-		gs.queueMutex.Unlock()
+	// Check if we can make a match (2+ compatible players)
+	first, second, ok := gs.popPairLocked()
+	gs.queueMutex.Unlock()
 
-		gs.logf("User %d and User %d were matched", player1, player2)
+	if ok {
+		gs.logc(r.Context(), "User %d and User %d were matched", first.UserID, second.UserID)
+		now := gs.clock.Now()
+		metrics.QueueWait.WithLabelValues(first.Series.Mode).Observe(now.Sub(first.JoinedAt).Seconds())
+		metrics.QueueWait.WithLabelValues(second.Series.Mode).Observe(now.Sub(second.JoinedAt).Seconds())
 
-		// Start match in a goroutine
-		go gs.startMatch(player1, player2)
-	} else {
-		gs.queueMutex.Unlock()
+		// Start series in a goroutine
+		go gs.startSeries(first.UserID, second.UserID, first.Series)
 	}
 
 	w.WriteHeader(http.StatusAccepted)
 }
 
-// startMatch simulates a match between two players
-// TODO: Flesh out this game logic. Make it run in goroutine so if the game logic crashes, it doesnt crash server? Or would the function block just end anyways
-func (gs *GameServer) startMatch(player1, player2 int) {
-	rand.Seed(time.Now().UnixNano())
-	winner := player1
-	loser := player2
-	if rand.Intn(2) == 1 {
-		winner = player2
-		loser = player1
+// playMatch runs one game of a series until the engine declares a winner
+// players[0] moves first
+// TODO: Make it run in goroutine so if the game logic crashes, it doesnt crash server? Or would the function block just end anyways
+func (gs *GameServer) playMatch(sr *Series, players [2]int, opts game.Options) (*Match, MatchResult, error) {
+	player1, player2 := players[0], players[1]
+	gameNum := len(sr.MatchIDs) + 1
+
+	// The match span covers the whole game, split into start, play and finish
+	ctx, span := tracing.Start(sr.logCtx(), "match", trace.WithAttributes(
+		attribute.String("match.mode", sr.Mode),
+		attribute.Int("match.game", gameNum),
+		attribute.IntSlice("match.players", players[:]),
+	))
+	_, phase := tracing.Start(ctx, "match.start")
+
+	m, err := gs.newMatch(ctx, sr.Mode, player1, player2, opts)
+	if err != nil {
+		tracing.End(phase, err)
+		tracing.End(span, err)
+		return nil, MatchResult{}, err
+	}
+	m.SeriesID = sr.ID
+	m.series = sr
+	m.Game = gameNum
+	m.Ranked = sr.Ranked
+	span.SetAttributes(attribute.String("match.id", m.ID))
+
+	gs.setPresence(player1, PresenceInMatch)
+	gs.setPresence(player2, PresenceInMatch)
+
+	// Announce the match with each player's latency
+	start := MatchStart{
+		Type:     "MATCH_START",
+		MatchID:  m.ID,
+		Mode:     m.Mode,
+		Players:  gs.matchPlayers(player1, player2),
+		SeriesID: sr.ID,
+		Game:     m.Game,
+		BestOf:   sr.BestOf,
+		Ranked:   sr.Ranked,
+	}
+	startMsg, _ := json.Marshal(start)
+	gs.publish(startMsg)
+
+	// Players who aren't connected start out in their reconnect window
+	m.mutex.Lock()
+	for i, id := range m.Players {
+		if gs.GetSubscriber(id) == nil {
+			m.absentSince[i] = m.StartedAt
+		}
 	}
 
-	gs.logf("Match result: User %d wins against User %d", winner, loser)
+	// Send the initial state, then wait for players to finish through commands
+	// or for the clock to end it
+	gs.broadcastMatchStateLocked(m)
+	m.mutex.Unlock()
+
+	go gs.runMatchClock(m)
+	phase.End()
+
+	return gs.finishMatch(m, span)
+}
+
+// resumeMatch carries on a match restored from a snapshot
+// Its players start out absent, so they forfeit unless they reconnect in time
+// If neither does the match ends unranked rather than as an abandon
+func (gs *GameServer) resumeMatch(m *Match) (*Match, MatchResult, error) {
+	go gs.runMatchClock(m)
+	return gs.finishMatch(m, trace.SpanFromContext(m.ctx))
+}
+
+// finishMatch waits for a running match to end, then announces and stores the result
+// Ends the match span once the result is out
+func (gs *GameServer) finishMatch(m *Match, span trace.Span) (*Match, MatchResult, error) {
+	player1, player2 := m.Players[0], m.Players[1]
+
+	_, phase := tracing.Start(m.ctx, "match.play")
+	<-m.done
+	phase.SetAttributes(attribute.String("match.end_reason", m.endReason))
+	phase.End()
+
+	_, phase = tracing.Start(m.ctx, "match.finish")
+	defer func() {
+		phase.End()
+		span.End()
+	}()
+
+	winner := m.engine.Winner()
+	loser := player1
+	if winner == player1 {
+		loser = player2
+	}
+
+	gs.logc(m.logCtx(), "Match result: User %d wins against User %d (%s)", winner, loser, m.endReason)
+	span.SetAttributes(attribute.Int("match.winner_id", winner), attribute.String("match.end_reason", m.endReason))
 
 	// Send match result
 	result := MatchResult{
 		Type:     "MATCH_RESULT",
+		MatchID:  m.ID,
 		WinnerID: winner,
 		LoserID:  loser,
+		Reason:   m.endReason,
 	}
 	msg, _ := json.Marshal(result)
 	gs.publish(msg)
 
-	// Store match result in Supabase items table
-	// TODO: data engineering for dedicated match table and user results
+	metrics.MatchesCompleted.WithLabelValues(m.Mode, strconv.FormatBool(m.Ranked), m.endReason).Inc()
+
+	// Ratings are kept by account, so games involving a guest leave them alone
+	if m.Ranked {
+		winnerAccount, loserAccount := m.series.account(winner), m.series.account(loser)
+		if winnerAccount != "" && loserAccount != "" {
+			gs.updateRatings(m.Mode, winnerAccount, loserAccount)
+		} else {
+			gs.logc(m.logCtx(), "[RATING] Match %s has a guest player, ratings not updated", m.ID)
+		}
+	}
+
+	// Store match result in Supabase items table, with the replay alongside it
+	// The full record, including abandons for penalties, goes to the matches table
+	// TODO: user results
 	// How to make user results account based but be your own?
-	go gs.storeMatchResult(winner)
+	gs.goWrite(func() { gs.storeMatchResult(m.logCtx(), m.ID, winner) })
+	gs.goWrite(func() { gs.storeMatchRecord(m, result) })
+	gs.saveReplay(m)
 
-	time.Sleep(6 * time.Second) // TODO: defult time for result showing
+	gs.removeMatch(m.ID)
 
-	gs.logf("Returning players %d and %d to global lobby", player1, player2)
+	return m, result, nil
 }
 
 // generateLobbyID generates a unique lobby ID
 // TODO: make sure its unique
-func generateLobbyID() string {
-	return "lobby_" + randomString(8)
+func (gs *GameServer) generateLobbyID() string {
+	gs.rngMutex.Lock()
+	defer gs.rngMutex.Unlock()
+	return "lobby_" + randomString(gs.rng, 8)
 }
 
 // TODO: refactor into utils
-// randomString generates a random alphanumeric string
-func randomString(length int) string {
+// randomString generates a random alphanumeric string from rng
+func randomString(rng *rand.Rand, length int) string {
 	const charset = "abcdefghijklmnopqrstuvwxyz0123456789"
-	rand.Seed(time.Now().UnixNano())
 	result := make([]byte, length)
 	for i := range result {
-		result[i] = charset[rand.Intn(len(charset))]
+		result[i] = charset[rng.Intn(len(charset))]
 	}
 	return string(result)
 }
 
 // storeMatchResult stores the match result in the Supabase items table
-func (gs *GameServer) storeMatchResult(winnerID int) {
-	timestamp := time.Now().Unix()
+// The item ID is the match ID so the replay in match_replays can be joined to it
+// Rows are owned by the configured service principal, which config validation requires
+func (gs *GameServer) storeMatchResult(ctx context.Context, matchID string, winnerID int) {
+	timestamp := gs.clock.Now().Unix()
 	title := "match_result" + strconv.FormatInt(timestamp, 10)
 	description := strconv.Itoa(winnerID)
 
-	// Use a system user ID for owner_id (test user for now)
-	// TODO: remove this hardcoded ID and ensure that system stuff uses the admin acc
-	systemUserID := "fb490750-7386-4150-a047-2317d2f51e5b"
-
 	itemData := map[string]interface{}{
-		"id":          uuid.New().String(), // Generate UUID for id column
+		"id":          matchID, // Match IDs are UUIDs
 		"title":       title,
 		"description": description,
-		"owner_id":    systemUserID, // Required for RLS policies
+		"owner_id":    gs.servicePrincipalID, // Required for RLS policies
 	}
 
 	// Get system client (uses secret key, bypasses RLS)
 	client := gs.dbClient.GetSystemClient()
 
 	// REsponse body and row count ignored
-	_, _, err := client.From("items").Insert(itemData, false, "", "", "").Execute()
+	_, _, err := client.From("items").Insert(itemData, false, "", "", "").ExecuteWithContext(ctx)
+	if err != nil {
+		gs.logc(ctx, "[ERROR] Failed to store match result: %v", err)
+		return
+	}
+
+	gs.logc(ctx, "[SUCCESS] Match result stored: title=%s, winner=%d, owner=%s", title, winnerID, gs.servicePrincipalID)
+}
+
+// storeMatchRecord stores the full match record in the Supabase matches table
+// Abandons are recorded so repeat offenders can be penalized
+func (gs *GameServer) storeMatchRecord(m *Match, result MatchResult) {
+	record := map[string]interface{}{
+		"id":         m.ID,
+		"mode":       m.Mode,
+		"player1_id": m.Players[0],
+		"player2_id": m.Players[1],
+		"winner_id":  result.WinnerID,
+		"loser_id":   result.LoserID,
+		"end_reason": result.Reason,
+		"started_at": m.StartedAt.UTC().Format(time.RFC3339),
+		"ended_at":   gs.clock.Now().UTC().Format(time.RFC3339),
+		"series_id":  m.SeriesID,
+		"game":       m.Game,
+		"ranked":     m.Ranked,
+	}
+	if result.Reason == EndAbandon {
+		record["abandoned_by"] = result.LoserID
+	}
+
+	client := gs.dbClient.GetSystemClient()
+	_, _, err := client.From("matches").Insert(record, false, "", "", "").ExecuteWithContext(m.logCtx())
 	if err != nil {
-		gs.logf("[ERROR] Failed to store match result: %v", err)
+		gs.logc(m.logCtx(), "[ERROR] Failed to store match record %s: %v", m.ID, err)
 		return
 	}
 
-	gs.logf("[SUCCESS] Match result stored: title=%s, winner=%d, owner=%s", title, winnerID, systemUserID)
+	gs.logc(m.logCtx(), "[SUCCESS] Match record stored: id=%s, reason=%s", m.ID, result.Reason)
 }
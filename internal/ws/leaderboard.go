@@ -0,0 +1,219 @@
+package ws
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/vindennt/akasha-showdown-engine/internal/game"
+)
+
+// Rank tiers by minimum rating, highest first
+// New players start in Liyue at defaultRating
+var rankTiers = []struct {
+	Name      string
+	MinRating int
+}{
+	{"Celestia", 2300},
+	{"Snezhnaya", 2150},
+	{"Natlan", 2000},
+	{"Fontaine", 1850},
+	{"Sumeru", 1700},
+	{"Inazuma", 1550},
+	{"Liyue", 1400},
+	{"Mondstadt", 0},
+}
+
+// tierFor returns the rank tier for a rating
+func tierFor(rating int) string {
+	for _, t := range rankTiers {
+		if rating >= t.MinRating {
+			return t.Name
+		}
+	}
+	return rankTiers[len(rankTiers)-1].Name
+}
+
+// Leaderboard page limits
+const (
+	defaultLeaderboardLimit = 50
+	maxLeaderboardLimit     = 100
+	defaultAroundRadius     = 5
+	maxAroundRadius         = 25
+)
+
+type leaderboardRow struct {
+	Account string
+	playerRating
+}
+
+// leaderboard keeps one mode's players sorted by rating, highest first
+// Updated in place on every result so reads never have to sort
+// Guarded by ratingsMutex
+type leaderboard struct {
+	rows []leaderboardRow
+}
+
+// ahead reports whether a player with rating a and account aID ranks above b
+// Equal ratings rank by account ID so order is stable
+func ahead(a int, aID string, b int, bID string) bool {
+	if a != b {
+		return a > b
+	}
+	return aID < bID
+}
+
+// search returns the position a player with this rating is or would be at
+func (lb *leaderboard) search(account string, rating int) int {
+	return sort.Search(len(lb.rows), func(i int) bool {
+		return !ahead(lb.rows[i].Rating, lb.rows[i].Account, rating, account)
+	})
+}
+
+func (lb *leaderboard) insert(row leaderboardRow) {
+	i := lb.search(row.Account, row.Rating)
+	lb.rows = append(lb.rows, leaderboardRow{})
+	copy(lb.rows[i+1:], lb.rows[i:])
+	lb.rows[i] = row
+}
+
+func (lb *leaderboard) remove(account string, rating int) {
+	i := lb.search(account, rating)
+	if i < len(lb.rows) && lb.rows[i].Account == account {
+		lb.rows = append(lb.rows[:i], lb.rows[i+1:]...)
+	}
+}
+
+// rank returns a player's 1-based rank, or 0 if they aren't on the board
+func (lb *leaderboard) rank(account string, rating int) int {
+	if lb == nil {
+		return 0
+	}
+	i := lb.search(account, rating)
+	if i < len(lb.rows) && lb.rows[i].Account == account {
+		return i + 1
+	}
+	return 0
+}
+
+// entries returns rows [from, to) as sent to clients
+func (lb *leaderboard) entries(from, to int) []LeaderboardEntry {
+	entries := make([]LeaderboardEntry, 0)
+	if lb == nil {
+		return entries
+	}
+	from = max(from, 0)
+	to = min(to, len(lb.rows))
+	for i := from; i < to; i++ {
+		row := lb.rows[i]
+		entries = append(entries, LeaderboardEntry{
+			Rank:      i + 1,
+			AccountID: row.Account,
+			Rating:    row.Rating,
+			Tier:      tierFor(row.Rating),
+			Wins:      row.Wins,
+			Losses:    row.Losses,
+		})
+	}
+	return entries
+}
+
+func (lb *leaderboard) size() int {
+	if lb == nil {
+		return 0
+	}
+	return len(lb.rows)
+}
+
+// leaderboardMode reads the mode query parameter, defaulting to the global board
+// Writes the error response and returns false if the mode is unknown
+func (gs *GameServer) leaderboardMode(w http.ResponseWriter, r *http.Request) (string, bool) {
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = globalBoard
+	}
+	if mode != globalBoard && !game.ValidMode(mode) {
+		http.Error(w, "Unknown game mode", http.StatusBadRequest)
+		return "", false
+	}
+	return mode, true
+}
+
+// handles paginated leaderboard requests
+// Query: mode (default global), skip, limit
+func (gs *GameServer) leaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	mode, ok := gs.leaderboardMode(w, r)
+	if !ok {
+		return
+	}
+
+	skip := 0
+	limit := defaultLeaderboardLimit
+	if s := r.URL.Query().Get("skip"); s != "" {
+		if v, err := strconv.Atoi(s); err == nil && v >= 0 {
+			skip = v
+		}
+	}
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if v, err := strconv.Atoi(l); err == nil && v > 0 {
+			limit = min(v, maxLeaderboardLimit)
+		}
+	}
+
+	gs.ratingsMutex.Lock()
+	board := gs.boards[mode]
+	page := LeaderboardPage{
+		Mode:    mode,
+		Season:  gs.season.info(),
+		Total:   board.size(),
+		Entries: board.entries(skip, skip+limit),
+	}
+	gs.ratingsMutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// handles requests for the players ranked around a given player
+// Query: mode (default global), account_id, radius
+func (gs *GameServer) leaderboardAroundHandler(w http.ResponseWriter, r *http.Request) {
+	mode, ok := gs.leaderboardMode(w, r)
+	if !ok {
+		return
+	}
+
+	account := r.URL.Query().Get("account_id")
+	if err := uuid.Validate(account); err != nil {
+		http.Error(w, "account_id is required", http.StatusBadRequest)
+		return
+	}
+
+	radius := defaultAroundRadius
+	if s := r.URL.Query().Get("radius"); s != "" {
+		if v, err := strconv.Atoi(s); err == nil && v >= 0 {
+			radius = min(v, maxAroundRadius)
+		}
+	}
+
+	gs.ratingsMutex.Lock()
+	board := gs.boards[mode]
+	rank := board.rank(account, gs.ratingLocked(mode, account).Rating)
+	if rank == 0 {
+		gs.ratingsMutex.Unlock()
+		http.Error(w, "Player is not ranked in this mode", http.StatusNotFound)
+		return
+	}
+
+	page := LeaderboardPage{
+		Mode:    mode,
+		Season:  gs.season.info(),
+		Total:   board.size(),
+		Entries: board.entries(rank-1-radius, rank+radius),
+	}
+	gs.ratingsMutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
@@ -0,0 +1,79 @@
+package ws
+
+import "testing"
+
+func TestTierFor(t *testing.T) {
+	tests := []struct {
+		rating int
+		want   string
+	}{
+		{defaultRating, "Liyue"},
+		{1399, "Mondstadt"},
+		{1400, "Liyue"},
+		{1550, "Inazuma"},
+		{2299, "Snezhnaya"},
+		{2300, "Celestia"},
+		{0, "Mondstadt"},
+		{-50, "Mondstadt"},
+	}
+
+	for _, tt := range tests {
+		if got := tierFor(tt.rating); got != tt.want {
+			t.Errorf("tierFor(%d) = %q, want %q", tt.rating, got, tt.want)
+		}
+	}
+}
+
+func TestLeaderboard(t *testing.T) {
+	lb := &leaderboard{}
+	for _, row := range []leaderboardRow{
+		{Account: "c", playerRating: playerRating{Rating: 1500}},
+		{Account: "a", playerRating: playerRating{Rating: 1600}},
+		{Account: "b", playerRating: playerRating{Rating: 1500}},
+		{Account: "d", playerRating: playerRating{Rating: 1400}},
+	} {
+		lb.insert(row)
+	}
+
+	// Equal ratings rank by account
+	tests := []struct {
+		name    string
+		account string
+		rating  int
+		want    int
+	}{
+		{"top", "a", 1600, 1},
+		{"tie ranks first account first", "b", 1500, 2},
+		{"tie ranks later account second", "c", 1500, 3},
+		{"bottom", "d", 1400, 4},
+		{"not on the board", "e", 1500, 0},
+		{"wrong rating", "a", 1500, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lb.rank(tt.account, tt.rating); got != tt.want {
+				t.Errorf("rank(%q, %d) = %d, want %d", tt.account, tt.rating, got, tt.want)
+			}
+		})
+	}
+
+	lb.remove("b", 1500)
+	lb.insert(leaderboardRow{Account: "b", playerRating: playerRating{Rating: 1700}})
+	entries := lb.entries(0, 10)
+	want := []string{"b", "a", "c", "d"}
+	if len(entries) != len(want) {
+		t.Fatalf("entries() has %d rows, want %d", len(entries), len(want))
+	}
+	for i, e := range entries {
+		if e.AccountID != want[i] || e.Rank != i+1 {
+			t.Errorf("entries()[%d] = %+v, want %s ranked %d", i, e, want[i], i+1)
+		}
+	}
+
+	if got := lb.entries(3, 100); len(got) != 1 || got[0].AccountID != "d" {
+		t.Errorf("entries(3, 100) = %+v, want only d", got)
+	}
+	if got := lb.entries(-5, 1); len(got) != 1 || got[0].AccountID != "b" {
+		t.Errorf("entries(-5, 1) = %+v, want only b", got)
+	}
+}
@@ -0,0 +1,489 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vindennt/akasha-showdown-engine/internal/clock"
+	"github.com/vindennt/akasha-showdown-engine/internal/game"
+	"github.com/vindennt/akasha-showdown-engine/internal/logging"
+	"github.com/vindennt/akasha-showdown-engine/internal/metrics"
+	"github.com/vindennt/akasha-showdown-engine/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Match is an in-progress match between two players
+// The engine owns the game rules; Match handles delivery to players and spectators
+type Match struct {
+	ID        string
+	Mode      string
+	Players   [2]int
+	StartedAt time.Time
+	SeriesID  string
+	Game      int // 1-based game number within the series
+	Ranked    bool
+
+	series     *Series         // Series this match is a game of
+	ctx        context.Context // Carries the match span, a child of the series span
+	mutex      sync.Mutex
+	clock      clock.Clock
+	engine     game.Engine
+	replay     Replay // Seed and accepted commands, recorded as they happen
+	finished   bool
+	done       chan struct{} // Closed once the engine reports the match finished
+	spectators map[int]bool  // Subscriber IDs watching this match
+	endReason  string        // Set when the match finishes
+
+	// Time control, see timecontrol.go
+	clocks      [2]time.Duration // Remaining main time per player
+	turnStarted time.Time
+	absentSince [2]time.Time  // When each player disconnected, zero while connected
+	moved       chan struct{} // Wakes the clock loop to re-arm its deadline
+
+	// Spectator updates are queued on feed and delivered after spectatorDelay
+	// spectatorSnapshot is the latest state spectators have been sent
+	feed              chan spectatorUpdate
+	spectatorSnapshot []byte
+}
+
+// logCtx carries the match's IDs and span for logging
+func (m *Match) logCtx() context.Context {
+	return logging.With(m.ctx, "match_id", m.ID, "series_id", m.SeriesID, "mode", m.Mode)
+}
+
+type spectatorUpdate struct {
+	at  time.Time
+	msg []byte
+}
+
+// Max spectator updates waiting out the delay before new ones are dropped
+const spectatorFeedBuffer = 256
+
+// newMatch creates a match with a fresh engine and registers it as in progress
+// ctx carries the match's span
+func (gs *GameServer) newMatch(ctx context.Context, mode string, player1, player2 int, opts game.Options) (*Match, error) {
+	// Each match gets its own seeded RNG so it can be replayed exactly
+	// The seed is recorded so the replay can rebuild the same engine
+	m, err := gs.buildMatch(ctx, uuid.New().String(), mode, [2]int{player1, player2}, gs.nextSeed(), opts, gs.clock.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	gs.registerMatch(m)
+	return m, nil
+}
+
+// buildMatch creates a match without registering it
+func (gs *GameServer) buildMatch(ctx context.Context, id, mode string, players [2]int, seed int64, opts game.Options, startedAt time.Time) (*Match, error) {
+	engine, err := game.New(mode, players, rand.New(rand.NewSource(seed)), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Match{
+		ID:        id,
+		Mode:      mode,
+		Players:   players,
+		StartedAt: startedAt,
+		ctx:       ctx,
+		clock:     gs.clock,
+		engine:    engine,
+		replay: Replay{
+			Version:   replayVersion,
+			MatchID:   id,
+			Mode:      mode,
+			Seed:      seed,
+			Options:   opts,
+			Players:   players,
+			StartedAt: startedAt.UnixMilli(),
+			Events:    make([]ReplayEvent, 0),
+		},
+		done:        make(chan struct{}),
+		spectators:  make(map[int]bool),
+		clocks:      [2]time.Duration{gs.timeControl.Base, gs.timeControl.Base},
+		turnStarted: startedAt,
+		moved:       make(chan struct{}, 1),
+		feed:        make(chan spectatorUpdate, spectatorFeedBuffer),
+	}, nil
+}
+
+// registerMatch lists a match as in progress and starts delivering to its spectators
+func (gs *GameServer) registerMatch(m *Match) {
+	gs.matchesMutex.Lock()
+	gs.matches[m.ID] = m
+	gs.matchesMutex.Unlock()
+
+	go gs.runSpectatorFeed(m)
+}
+
+// nextSeed draws a match seed from the server RNG
+func (gs *GameServer) nextSeed() int64 {
+	gs.rngMutex.Lock()
+	defer gs.rngMutex.Unlock()
+	return gs.rng.Int63()
+}
+
+// getMatch returns an in-progress match by ID, or nil if not found
+func (gs *GameServer) getMatch(id string) *Match {
+	gs.matchesMutex.Lock()
+	defer gs.matchesMutex.Unlock()
+	return gs.matches[id]
+}
+
+// inMatch reports whether the subscriber is a player in any in-progress match
+func (gs *GameServer) inMatch(id int) bool {
+	gs.matchesMutex.Lock()
+	defer gs.matchesMutex.Unlock()
+	for _, m := range gs.matches {
+		if m.isPlayer(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeMatch drops a match from the in-progress list
+func (gs *GameServer) removeMatch(id string) {
+	gs.matchesMutex.Lock()
+	defer gs.matchesMutex.Unlock()
+	delete(gs.matches, id)
+}
+
+// isPlayer reports whether the subscriber is one of the match's players
+func (m *Match) isPlayer(id int) bool {
+	return m.Players[0] == id || m.Players[1] == id
+}
+
+// spectatorIDsLocked returns the IDs of everyone spectating
+// Caller must hold m.mutex
+func (m *Match) spectatorIDsLocked() []int {
+	ids := make([]int, 0, len(m.spectators))
+	for id := range m.spectators {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// broadcastMatchStateLocked sends the current state to both players
+// and queues it for spectators. Marks the match done if the engine finished
+// Caller must hold m.mutex
+func (gs *GameServer) broadcastMatchStateLocked(m *Match) {
+	if m.finished {
+		return
+	}
+
+	state := gs.matchStateLocked(m, "MATCH_STATE")
+	msg, _ := json.Marshal(state)
+	for _, id := range m.Players {
+		gs.sendTo(id, msg)
+	}
+
+	state.Type = "SPECTATOR_STATE"
+	specMsg, _ := json.Marshal(state)
+	select {
+	case m.feed <- spectatorUpdate{at: m.clock.Now(), msg: specMsg}:
+	default:
+		// Every update is a full snapshot, so spectators catch up on the next one
+		gs.logc(m.logCtx(), "[WARN] Spectator feed full for match %s, dropping update", m.ID)
+		metrics.MessagesDropped.WithLabelValues("spectator_feed").Inc()
+	}
+
+	if m.engine.Finished() {
+		m.finished = true
+		close(m.feed)
+		close(m.done)
+	}
+}
+
+// matchStateLocked returns the current state and clocks as sent to clients
+// Caller must hold m.mutex
+func (gs *GameServer) matchStateLocked(m *Match, msgType string) MatchState {
+	return MatchState{
+		Type:       msgType,
+		MatchID:    m.ID,
+		State:      m.engine.State(),
+		Clock:      gs.clockStateLocked(m),
+		Spectators: len(m.spectators),
+	}
+}
+
+// runSpectatorFeed delivers queued updates to spectators once they are spectatorDelay old
+// The delay keeps spectators from relaying live information to players (ghosting)
+// Releases all spectators back to the lobby once the final state is delivered
+func (gs *GameServer) runSpectatorFeed(m *Match) {
+	for u := range m.feed {
+		if wait := u.at.Add(gs.spectatorDelay).Sub(gs.clock.Now()); wait > 0 {
+			gs.clock.Sleep(wait)
+		}
+
+		m.mutex.Lock()
+		m.spectatorSnapshot = u.msg
+		ids := m.spectatorIDsLocked()
+		m.mutex.Unlock()
+
+		for _, id := range ids {
+			gs.sendTo(id, u.msg)
+		}
+	}
+
+	m.mutex.Lock()
+	ids := m.spectatorIDsLocked()
+	m.spectators = make(map[int]bool)
+	m.mutex.Unlock()
+
+	for _, id := range ids {
+		gs.swapPresence(id, PresenceSpectating, PresenceOnline)
+	}
+}
+
+// broadcastSpectatorCount tells players and spectators how many are watching
+func (gs *GameServer) broadcastSpectatorCount(m *Match) {
+	m.mutex.Lock()
+	ids := m.spectatorIDsLocked()
+	m.mutex.Unlock()
+
+	count := SpectatorCount{
+		Type:    "SPECTATOR_COUNT",
+		MatchID: m.ID,
+		Count:   len(ids),
+	}
+	msg, _ := json.Marshal(count)
+
+	for _, id := range m.Players {
+		gs.sendTo(id, msg)
+	}
+	for _, id := range ids {
+		gs.sendTo(id, msg)
+	}
+}
+
+// leaveSpectating removes a subscriber from every match they are watching
+// Returns true if they were spectating anything
+func (gs *GameServer) leaveSpectating(id int) bool {
+	gs.matchesMutex.Lock()
+	matches := make([]*Match, 0, len(gs.matches))
+	for _, m := range gs.matches {
+		matches = append(matches, m)
+	}
+	gs.matchesMutex.Unlock()
+
+	left := false
+	for _, m := range matches {
+		m.mutex.Lock()
+		watching := m.spectators[id]
+		delete(m.spectators, id)
+		m.mutex.Unlock()
+
+		if watching {
+			left = true
+			gs.broadcastSpectatorCount(m)
+		}
+	}
+	return left
+}
+
+// handles game commands from players in a match
+// Only the match's players may send commands, and only for themselves; spectators are rejected
+func (gs *GameServer) matchCommandHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var req struct {
+		MatchID string `json:"match_id"`
+		UserID  int    `json:"user_id"`
+		Action  string `json:"action"`
+	}
+
+	if err := json.Unmarshal(data, &req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	r = r.WithContext(logging.With(r.Context(), "match_id", req.MatchID, "user_id", req.UserID))
+
+	s, ok := gs.authorize(w, r, req.UserID)
+	if !ok {
+		return
+	}
+
+	m := gs.getMatch(req.MatchID)
+	if m == nil {
+		http.Error(w, "Match not found", http.StatusNotFound)
+		return
+	}
+
+	if !m.isPlayer(req.UserID) {
+		http.Error(w, "Only players can send game commands", http.StatusForbidden)
+		return
+	}
+
+	// Commands belong to the request's trace, linked to the match they were played in
+	_, span := tracing.Start(r.Context(), "match.command", trace.WithLinks(trace.LinkFromContext(m.ctx)), trace.WithAttributes(
+		attribute.String("match.id", m.ID),
+		attribute.Int("match.player_id", req.UserID),
+		attribute.String("match.action", req.Action),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	reason := EndKnockout
+	if req.Action == game.ActionForfeit {
+		reason = EndResign
+	}
+
+	err = gs.applyLocked(m, game.Command{PlayerID: req.UserID, Action: req.Action}, reason)
+	if errors.Is(err, game.ErrInvalidAction) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	gs.seen(s)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handles requests to spectate an in-progress match
+// Sends the latest spectator snapshot right away, then live updates from the feed
+func (gs *GameServer) spectateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var req struct {
+		MatchID string `json:"match_id"`
+		UserID  int    `json:"user_id"`
+	}
+
+	if err := json.Unmarshal(data, &req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	r = r.WithContext(logging.With(r.Context(), "match_id", req.MatchID, "user_id", req.UserID))
+
+	// Spectators must be connected to the lobby to receive updates, which authorize checks
+	if _, ok := gs.authorize(w, r, req.UserID); !ok {
+		return
+	}
+
+	m := gs.getMatch(req.MatchID)
+	if m == nil {
+		http.Error(w, "Match not found", http.StatusNotFound)
+		return
+	}
+
+	if m.isPlayer(req.UserID) {
+		http.Error(w, "Players cannot spectate their own match", http.StatusBadRequest)
+		return
+	}
+
+	// Only watch one match at a time
+	gs.leaveSpectating(req.UserID)
+
+	m.mutex.Lock()
+	if m.finished {
+		m.mutex.Unlock()
+		http.Error(w, "Match is over", http.StatusConflict)
+		return
+	}
+	m.spectators[req.UserID] = true
+	snapshot := m.spectatorSnapshot
+	m.mutex.Unlock()
+
+	gs.logc(r.Context(), "[SPECTATE] User %d is spectating match %s", req.UserID, m.ID)
+	gs.setPresence(req.UserID, PresenceSpectating)
+
+	// Snapshot may not exist yet if the first update is still delayed
+	if snapshot != nil {
+		gs.sendTo(req.UserID, snapshot)
+	}
+	gs.broadcastSpectatorCount(m)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handles requests to stop spectating
+func (gs *GameServer) leaveSpectateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var req struct {
+		UserID int `json:"user_id"`
+	}
+
+	if err := json.Unmarshal(data, &req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	r = r.WithContext(logging.With(r.Context(), "user_id", req.UserID))
+
+	if _, ok := gs.authorize(w, r, req.UserID); !ok {
+		return
+	}
+
+	if gs.leaveSpectating(req.UserID) {
+		gs.swapPresence(req.UserID, PresenceSpectating, PresenceOnline)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handles listing in-progress matches so lobby members can pick one to spectate
+func (gs *GameServer) listMatchesHandler(w http.ResponseWriter, r *http.Request) {
+	gs.matchesMutex.Lock()
+	matches := make([]MatchInfo, 0, len(gs.matches))
+	for _, m := range gs.matches {
+		m.mutex.Lock()
+		matches = append(matches, MatchInfo{
+			MatchID:    m.ID,
+			Mode:       m.Mode,
+			Players:    m.Players[:],
+			Spectators: len(m.spectators),
+			StartedAt:  m.StartedAt.Unix(),
+		})
+		m.mutex.Unlock()
+	}
+	gs.matchesMutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Matches []MatchInfo `json:"matches"`
+	}{
+		Matches: matches,
+	})
+}
@@ -0,0 +1,108 @@
+package ws
+
+import (
+	"math"
+	"time"
+)
+
+// queueEntry is a player waiting in the matchmaking queue
+// Players are only paired with others queued for the same mode and series length
+type queueEntry struct {
+	UserID   int
+	Series   SeriesOptions
+	JoinedAt time.Time
+}
+
+// popPairLocked removes and returns the next two compatible players to match
+// The longest waiting player with a compatible opponent is always matched. With
+// preferLowLatency, their opponent is the lowest latency compatible player within
+// the queue window, otherwise the next compatible player in line
+// Returns false if no two queued players are compatible
+// Caller must hold queueMutex
+func (gs *GameServer) popPairLocked() (queueEntry, queueEntry, bool) {
+	for first, entry := range gs.matchmakingQueue {
+		pick := -1
+		best := time.Duration(math.MaxInt64)
+		window := min(len(gs.matchmakingQueue), first+gs.settings.Load().MatchmakingWindow+1)
+
+		for i := first + 1; i < len(gs.matchmakingQueue); i++ {
+			if gs.matchmakingQueue[i].Series != entry.Series {
+				continue
+			}
+			if !gs.preferLowLatency {
+				pick = i
+				break
+			}
+			// Ties keep queue order, so unmeasured players fall back to first come first serve
+			rtt := gs.queuedLatency(gs.matchmakingQueue[i].UserID)
+			if pick < 0 || (i < window && rtt < best) {
+				best = rtt
+				pick = i
+			}
+		}
+
+		if pick < 0 {
+			continue
+		}
+
+		opponent := gs.matchmakingQueue[pick]
+
+		remaining := make([]queueEntry, 0, len(gs.matchmakingQueue)-2)
+		remaining = append(remaining, gs.matchmakingQueue[:first]...)
+		remaining = append(remaining, gs.matchmakingQueue[first+1:pick]...)
+		remaining = append(remaining, gs.matchmakingQueue[pick+1:]...)
+		gs.matchmakingQueue = remaining
+
+		return entry, opponent, true
+	}
+
+	return queueEntry{}, queueEntry{}, false
+}
+
+// queuedLocked reports whether a player is waiting in the matchmaking queue
+// Caller must hold queueMutex
+func (gs *GameServer) queuedLocked(id int) bool {
+	for _, entry := range gs.matchmakingQueue {
+		if entry.UserID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// leaveQueue removes a player from the matchmaking queue, reporting whether they were in it
+func (gs *GameServer) leaveQueue(id int) bool {
+	gs.queueMutex.Lock()
+	defer gs.queueMutex.Unlock()
+
+	for i, entry := range gs.matchmakingQueue {
+		if entry.UserID == id {
+			gs.matchmakingQueue = append(gs.matchmakingQueue[:i:i], gs.matchmakingQueue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// queuedLatency returns a queued player's ping RTT for pairing
+// Players that are disconnected or not yet measured sort last
+func (gs *GameServer) queuedLatency(id int) time.Duration {
+	s := gs.GetSubscriber(id)
+	if s == nil || s.Latency() == 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	return s.Latency()
+}
+
+// matchPlayers returns match metadata for the given players, including their latency
+func (gs *GameServer) matchPlayers(ids ...int) []MatchPlayer {
+	players := make([]MatchPlayer, 0, len(ids))
+	for _, id := range ids {
+		p := MatchPlayer{ID: id}
+		if s := gs.GetSubscriber(id); s != nil {
+			p.LatencyMs = s.Latency().Milliseconds()
+		}
+		players = append(players, p)
+	}
+	return players
+}
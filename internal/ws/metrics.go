@@ -0,0 +1,37 @@
+package ws
+
+import (
+	"github.com/vindennt/akasha-showdown-engine/internal/metrics"
+)
+
+// registerMetrics exposes game server state as gauges, read when /metrics is scraped
+func (gs *GameServer) registerMetrics() {
+	metrics.RegisterGaugeVec("lobby_subscribers", "Subscribers connected to each lobby.", "lobby", func() map[string]float64 {
+		gs.lobbiesMutex.Lock()
+		lobbies := make([]*Lobby, 0, len(gs.lobbies))
+		for _, lobby := range gs.lobbies {
+			lobbies = append(lobbies, lobby)
+		}
+		gs.lobbiesMutex.Unlock()
+
+		counts := make(map[string]float64, len(lobbies))
+		for _, lobby := range lobbies {
+			lobby.mutex.Lock()
+			counts[lobby.ID] = float64(len(lobby.subscribers))
+			lobby.mutex.Unlock()
+		}
+		return counts
+	})
+
+	metrics.RegisterGauge("queue_length", "Players waiting in the matchmaking queue.", func() float64 {
+		gs.queueMutex.Lock()
+		defer gs.queueMutex.Unlock()
+		return float64(len(gs.matchmakingQueue))
+	})
+
+	metrics.RegisterGauge("matches_in_progress", "Matches currently being played.", func() float64 {
+		gs.matchesMutex.Lock()
+		defer gs.matchesMutex.Unlock()
+		return float64(len(gs.matches))
+	})
+}
@@ -1,8 +1,15 @@
 package ws
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vindennt/akasha-showdown-engine/internal/clock"
+	"github.com/vindennt/akasha-showdown-engine/internal/logging"
+	"github.com/vindennt/akasha-showdown-engine/internal/tournament"
 )
 
 var (
@@ -11,9 +18,10 @@ var (
 )
 
 type Peer struct {
-	Type  string `json:"type"`
-	ID    int    `json:"id"`
-	State string `json:"state"`
+	Type      string        `json:"type"`
+	ID        int           `json:"id"`
+	AccountID string        `json:"account_id,omitempty"` // Empty for guests
+	State     PresenceState `json:"state"`
 }
 
 // Lobby represents a chat/game lobby
@@ -26,10 +34,26 @@ type Lobby struct {
 
 type ChatMessage struct {
 	Type      string `json:"type"` // "CHAT_MESSAGE"
+	ID        string `json:"id"`   // Assigned by the server
 	SenderID  int    `json:"sender_id"`
 	Message   string `json:"message"`
 	LobbyID   string `json:"lobby_id"`
 	Timestamp int64  `json:"timestamp"`
+
+	// Set by the server, so blocks can be applied to history after the sender disconnects
+	SenderAccount string `json:"sender_account,omitempty"`
+}
+
+// ChatTombstone tells clients to hide deleted messages or that a user was muted
+type ChatTombstone struct {
+	Type        string   `json:"type"`   // "CHAT_TOMBSTONE"
+	Action      string   `json:"action"` // "delete", "mute", "unmute"
+	LobbyID     string   `json:"lobby_id"`
+	MessageIDs  []string `json:"message_ids"`
+	UserID      int      `json:"user_id,omitempty"`     // Muted or unmuted user
+	MutedUntil  int64    `json:"muted_until,omitempty"` // Unix seconds
+	ModeratorID string   `json:"moderator_id"`
+	Reason      string   `json:"reason,omitempty"`
 }
 
 type LobbyInfo struct {
@@ -45,11 +69,256 @@ type LobbyEvent struct {
 	LobbyID string `json:"lobby_id"`
 }
 
+type PresenceUpdate struct {
+	Type      string        `json:"type"` // "PRESENCE_UPDATE"
+	ID        int           `json:"id"`
+	State     PresenceState `json:"state"`
+	PrevState PresenceState `json:"prev_state"`
+}
+
+type PresenceInfo struct {
+	ID         int           `json:"id"`
+	State      PresenceState `json:"state"`
+	LastActive int64         `json:"last_active,omitempty"` // Unix seconds, omitted when offline
+	LatencyMs  int64         `json:"latency_ms,omitempty"`  // Last measured ping RTT, omitted until measured
+}
+
 // Matchmaking 
+type MatchPlayer struct {
+	ID        int   `json:"id"`
+	LatencyMs int64 `json:"latency_ms"` // 0 if not measured yet
+}
+
+type MatchStart struct {
+	Type     string        `json:"type"` // "MATCH_START"
+	MatchID  string        `json:"match_id"`
+	Mode     string        `json:"mode"`
+	Players  []MatchPlayer `json:"players"` // First player moves first
+	SeriesID string        `json:"series_id"`
+	Game     int           `json:"game"` // 1-based game number within the series
+	BestOf   int           `json:"best_of"`
+	Ranked   bool          `json:"ranked"`
+}
+
+type MatchState struct {
+	Type       string      `json:"type"` // "MATCH_STATE" to players, "SPECTATOR_STATE" to spectators
+	MatchID    string      `json:"match_id"`
+	State      any         `json:"state"` // Engine specific snapshot
+	Clock      *ClockState `json:"clock"`
+	Spectators int         `json:"spectators"`
+}
+
+type ClockState struct {
+	Active      int     `json:"active"`
+	RemainingMs []int64 `json:"remaining_ms"`           // Main clock per player, in match player order
+	TurnEndsAt  int64   `json:"turn_ends_at,omitempty"` // Unix ms when the turn times out
+}
+
+type PlayerStatus struct {
+	Type        string `json:"type"` // "PLAYER_DISCONNECTED", "PLAYER_RECONNECTED"
+	MatchID     string `json:"match_id"`
+	PlayerID    int    `json:"player_id"`
+	ReconnectBy int64  `json:"reconnect_by,omitempty"` // Unix ms the player forfeits at if still gone
+}
+
+type ReplayFrame struct {
+	Type    string       `json:"type"` // "REPLAY_START", "REPLAY_STATE", "REPLAY_END"
+	MatchID string       `json:"match_id"`
+	Speed   int          `json:"speed"`
+	Event   *ReplayEvent `json:"event,omitempty"` // Command that produced this state
+	State   any          `json:"state"`
+}
+
+type SpectatorCount struct {
+	Type    string `json:"type"` // "SPECTATOR_COUNT"
+	MatchID string `json:"match_id"`
+	Count   int    `json:"count"`
+}
+
+type MatchInfo struct {
+	MatchID    string `json:"match_id"`
+	Mode       string `json:"mode"`
+	Players    []int  `json:"players"`
+	Spectators int    `json:"spectators"`
+	StartedAt  int64  `json:"started_at"` // Unix seconds
+}
+
 type MatchResult struct {
 	Type     string `json:"type"` // "MATCH_RESULT"
+	MatchID  string `json:"match_id"`
 	WinnerID int    `json:"winner_id"`
 	LoserID  int    `json:"loser_id"`
+	Reason   string `json:"reason"` // "knockout", "resign", "timeout", "abandon", "no_show"
+}
+
+type SeriesUpdate struct {
+	Type     string `json:"type"` // "SERIES_UPDATE" between games, "SERIES_RESULT" once decided
+	SeriesID string `json:"series_id"`
+	Mode     string `json:"mode"`
+	BestOf   int    `json:"best_of"`
+	Players  [2]int `json:"players"`
+	Wins     [2]int `json:"wins"` // Indexed like Players
+	NextGame int    `json:"next_game,omitempty"`
+	WinnerID int    `json:"winner_id,omitempty"`
+	Reason   string `json:"reason,omitempty"` // "decided", "abandon" or "no_show", only in SERIES_RESULT
+}
+
+type RematchUpdate struct {
+	Type      string `json:"type"` // "REMATCH_OFFER", "REMATCH_UPDATE", "REMATCH_CANCELLED"
+	SeriesID  string `json:"series_id"`
+	Accepted  []int  `json:"accepted"`             // Players who have accepted so far
+	ExpiresAt int64  `json:"expires_at,omitempty"` // Unix ms
+	Reason    string `json:"reason,omitempty"`     // "declined" or "expired", only in REMATCH_CANCELLED
+}
+
+type TournamentInfo struct {
+	TournamentID string `json:"tournament_id"`
+	Name         string `json:"name"`
+	Format       string `json:"format"` // "single_elimination", "double_elimination", "swiss"
+	Mode         string `json:"mode"`
+	BestOf       int    `json:"best_of"`
+	Status       string `json:"status"` // "registration", "check_in", "running", "finished"
+	OrganizerID  int    `json:"organizer_id"`
+	MaxPlayers   int    `json:"max_players"`
+	Registered   []int  `json:"registered"` // In registration order
+	CheckedIn    []int  `json:"checked_in"`
+	CreatedAt    int64  `json:"created_at"` // Unix seconds
+}
+
+type TournamentBracket struct {
+	Type       string                `json:"type"` // "TOURNAMENT_UPDATE"
+	Tournament TournamentInfo        `json:"tournament"`
+	Matches    []TournamentMatch     `json:"matches"` // Empty until the tournament starts
+	Standings  []tournament.Standing `json:"standings"`
+	WinnerID   int                   `json:"winner_id,omitempty"` // Set once finished
+}
+
+type TournamentMatch struct {
+	tournament.Match
+	SeriesID string `json:"series_id,omitempty"` // Set while live, for spectating
+	Ready    []int  `json:"ready"`               // Players who are ready to play
+}
+
+type TournamentMatchReady struct {
+	Type           string `json:"type"` // "TOURNAMENT_MATCH_READY"
+	TournamentID   string `json:"tournament_id"`
+	BracketMatchID string `json:"bracket_match_id"`
+	Players        [2]int `json:"players"`
+}
+
+type RatingUpdate struct {
+	Type      string `json:"type"` // "RATING_UPDATE"
+	Mode      string `json:"mode"` // "global" or a game mode
+	AccountID string `json:"account_id"`
+	Rating    int    `json:"rating"`
+	Change    int    `json:"change"`
+	Tier      string `json:"tier"`
+	Rank      int    `json:"rank"`
+	Wins      int    `json:"wins"`
+	Losses    int    `json:"losses"`
+}
+
+type SeasonInfo struct {
+	Type     string `json:"type,omitempty"` // "SEASON_START" when broadcast
+	Number   int    `json:"number"`
+	StartsAt int64  `json:"starts_at"` // Unix seconds
+	EndsAt   int64  `json:"ends_at"`   // Unix seconds
+}
+
+type LeaderboardEntry struct {
+	Rank      int    `json:"rank"` // Starts at 1
+	AccountID string `json:"account_id"`
+	Rating    int    `json:"rating"`
+	Tier      string `json:"tier"`
+	Wins      int    `json:"wins"`
+	Losses    int    `json:"losses"`
+}
+
+type LeaderboardPage struct {
+	Mode    string             `json:"mode"` // "global" or a game mode
+	Season  SeasonInfo         `json:"season"`
+	Total   int                `json:"total"` // Ranked players in this mode
+	Entries []LeaderboardEntry `json:"entries"`
+}
+
+// FriendEvent tells a user their social graph changed
+type FriendEvent struct {
+	Type      string        `json:"type"`       // "FRIEND_REQUEST", "FRIEND_ADDED", "FRIEND_REMOVED"
+	AccountID string        `json:"account_id"` // The other user
+	State     PresenceState `json:"state,omitempty"`
+}
+
+type FriendInfo struct {
+	AccountID string        `json:"account_id"`
+	State     PresenceState `json:"state"`
+}
+
+// FriendsList holds account IDs
+type FriendsList struct {
+	Friends  []FriendInfo `json:"friends"`
+	Incoming []string     `json:"incoming"` // Pending requests to the user
+	Outgoing []string     `json:"outgoing"` // Pending requests from the user
+	Blocked  []string     `json:"blocked"`
+}
+
+// DirectMessage is between two accounts
+type DirectMessage struct {
+	Type        string `json:"type"` // "DIRECT_MESSAGE"
+	ID          string `json:"id"`   // Assigned by the server
+	SenderID    string `json:"sender_id"`
+	RecipientID string `json:"recipient_id"`
+	Message     string `json:"message"`
+	Timestamp   int64  `json:"timestamp"`
+	Read        bool   `json:"read"`
+}
+
+// DirectMessageUnread is sent on connect and whenever unread counts change
+type DirectMessageUnread struct {
+	Type   string         `json:"type"`   // "DM_UNREAD"
+	Unread map[string]int `json:"unread"` // Sender account to unread count
+	Total  int            `json:"total"`
+}
+
+// DirectMessageRead is a read receipt sent to the other side of a conversation
+type DirectMessageRead struct {
+	Type      string `json:"type"`       // "DM_READ"
+	AccountID string `json:"account_id"` // Who read the messages
+	PeerID    string `json:"peer_id"`
+	ReadAt    int64  `json:"read_at"`
+}
+
+// Kicked tells a user a moderator removed them from a lobby
+type Kicked struct {
+	Type    string `json:"type"` // "KICKED"
+	LobbyID string `json:"lobby_id"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// Challenge is sent to both players when a direct challenge is made
+type Challenge struct {
+	Type        string `json:"type"` // "CHALLENGE"
+	ChallengeID string `json:"challenge_id"`
+	FromID      int    `json:"from_id"`
+	ToID        int    `json:"to_id"`
+	Mode        string `json:"mode"`
+	BestOf      int    `json:"best_of"`
+	Ranked      bool   `json:"ranked"`
+	ExpiresAt   int64  `json:"expires_at"` // Unix milliseconds
+}
+
+type ChallengeCancelled struct {
+	Type        string `json:"type"` // "CHALLENGE_CANCELLED"
+	ChallengeID string `json:"challenge_id"`
+	Reason      string `json:"reason"` // "declined", "cancelled", "expired", "unavailable", "shutdown"
+}
+
+// ServerShutdown is sent to every client when the server starts draining
+// Clients should reconnect with their session token after ReconnectAfterMS
+type ServerShutdown struct {
+	Type             string `json:"type"` // "SERVER_SHUTDOWN"
+	Reason           string `json:"reason"`
+	ReconnectAfterMS int64  `json:"reconnect_after_ms"`
+	Deadline         int64  `json:"deadline,omitempty"` // Unix milliseconds. Matches still running then are snapshotted
 }
 
 // subscriber represents a subscriber
@@ -59,23 +328,106 @@ type Subscriber struct {
 	id        int         // unique subscriber id (0-based)
 	messc     chan []byte // Channel for incoming messages
 	closeSlow func()
+	kick      func(reason string) // Closes the connection, showing the client reason
+	goAway    func(reason string) // Closes the connection because the server is shutting down
+	ip        string
+	account   string   // Supabase user ID if the connection was authenticated
+	roles     []string // Guests are players
+	clock     clock.Clock
+	ctx       context.Context // Carries the connection and user IDs for logging
+
+	// Presence is updated by server events, client heartbeats and actions
+	presenceMu sync.Mutex
+	presence   PresenceState
+	lastActive time.Time
+
+	latency atomic.Int64 // Last ping round trip time in nanoseconds, 0 until measured
 }
 
 // newSubscriber allocates a subscriber id (starting at 0) and returns a ready subscriber.
-func NewSubscriber(messc chan []byte, closeSlow func()) *Subscriber {
+func NewSubscriber(messc chan []byte, clk clock.Clock, closeSlow func()) *Subscriber {
 	nextSubscriberIDMu.Lock()
 	id := nextSubscriberID
 	nextSubscriberID++
 	nextSubscriberIDMu.Unlock()
 
-	log.Printf("Assigned new subscriber id=%d", id)
+	slog.Debug("Assigned new subscriber", "user_id", id)
+
+	return resumeSubscriber(id, messc, clk, closeSlow)
+}
 
+// resumeSubscriber returns a subscriber reusing an id from an earlier connection.
+func resumeSubscriber(id int, messc chan []byte, clk clock.Clock, closeSlow func()) *Subscriber {
 	return &Subscriber{
-		id:        id,
-		messc:     messc,
-		closeSlow: closeSlow,
+		id:         id,
+		messc:      messc,
+		closeSlow:  closeSlow,
+		ctx:        logging.With(context.Background(), "user_id", id),
+		clock:      clk,
+		presence:   PresenceOnline,
+		lastActive: clk.Now(),
 	}
 }
 
 // ID returns the subscriber's id.
-func (s *Subscriber) ID() int { return s.id }
\ No newline at end of file
+func (s *Subscriber) ID() int { return s.id }
+
+// Presence returns the subscriber's current presence state.
+func (s *Subscriber) Presence() PresenceState {
+	s.presenceMu.Lock()
+	defer s.presenceMu.Unlock()
+	return s.presence
+}
+
+// LastActive returns the time of the subscriber's last heartbeat or action.
+func (s *Subscriber) LastActive() time.Time {
+	s.presenceMu.Lock()
+	defer s.presenceMu.Unlock()
+	return s.lastActive
+}
+
+// Latency returns the last measured ping round trip time, or 0 if not measured yet.
+func (s *Subscriber) Latency() time.Duration {
+	return time.Duration(s.latency.Load())
+}
+
+// setLatency records a ping round trip time.
+func (s *Subscriber) setLatency(rtt time.Duration) {
+	s.latency.Store(int64(rtt))
+}
+
+// touch records activity from the subscriber and moves them back online if idle.
+// Returns the previous state and whether it changed.
+func (s *Subscriber) touch() (PresenceState, bool) {
+	s.presenceMu.Lock()
+	defer s.presenceMu.Unlock()
+	s.lastActive = s.clock.Now()
+	prev := s.presence
+	if prev != PresenceIdle {
+		return prev, false
+	}
+	s.presence = PresenceOnline
+	return prev, true
+}
+
+// setPresence sets the presence state and returns the previous state
+// and whether it changed.
+func (s *Subscriber) setPresence(state PresenceState) (PresenceState, bool) {
+	s.presenceMu.Lock()
+	defer s.presenceMu.Unlock()
+	prev := s.presence
+	s.presence = state
+	return prev, prev != state
+}
+
+// swapPresence sets the presence state only if it is currently from.
+// Returns whether it changed.
+func (s *Subscriber) swapPresence(from, to PresenceState) bool {
+	s.presenceMu.Lock()
+	defer s.presenceMu.Unlock()
+	if s.presence != from || from == to {
+		return false
+	}
+	s.presence = to
+	return true
+}
\ No newline at end of file
@@ -0,0 +1,491 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/supabase-community/postgrest-go"
+	"github.com/vindennt/akasha-showdown-engine/internal/logging"
+	"github.com/vindennt/akasha-showdown-engine/internal/moderation"
+)
+
+// Audit log page limits
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 200
+)
+
+// Returned by subscribe when a banned client tries to connect
+var errBanned = errors.New("client is banned")
+
+// banned returns the ban in force on an authorized subscriber, their account
+// or the IP their request came from
+func (gs *GameServer) banned(s *Subscriber, r *http.Request) (moderation.Ban, bool) {
+	if ban, ok := gs.bans.Check(moderation.KindUser, strconv.Itoa(s.ID())); ok {
+		return ban, true
+	}
+	if s.account != "" {
+		if ban, ok := gs.bans.Check(moderation.KindAccount, s.account); ok {
+			return ban, true
+		}
+	}
+	return gs.bans.Check(moderation.KindIP, moderation.ClientIP(r))
+}
+
+// kickSubscriber disconnects a subscriber and takes them out of the queue
+// Returns false if they aren't connected
+func (gs *GameServer) kickSubscriber(id int, reason string) bool {
+	s := gs.GetSubscriber(id)
+	if s == nil {
+		return false
+	}
+	gs.leaveQueue(id)
+	// Closing waits for the client's close frame, so don't hold up the caller
+	go s.kick(reason)
+	return true
+}
+
+// subscribersFrom returns the IDs of subscribers connected from an IP
+func (gs *GameServer) subscribersFrom(ip string) []int {
+	gs.globalLobby.mutex.Lock()
+	defer gs.globalLobby.mutex.Unlock()
+
+	ids := make([]int, 0)
+	for id, s := range gs.globalLobby.subscribers {
+		if s.ip == ip {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// subscribersOf returns the IDs of subscribers signed in to an account
+func (gs *GameServer) subscribersOf(account string) []int {
+	gs.globalLobby.mutex.Lock()
+	defer gs.globalLobby.mutex.Unlock()
+
+	ids := make([]int, 0)
+	for id, s := range gs.globalLobby.subscribers {
+		if s.account == account {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// audit appends a moderation action to the audit log
+func (gs *GameServer) audit(action, actorID, targetKind, target, reason string, details map[string]interface{}) {
+	entry := moderation.Entry{
+		ID:         uuid.New().String(),
+		Action:     action,
+		ActorID:    actorID,
+		TargetKind: targetKind,
+		Target:     target,
+		Reason:     reason,
+		Details:    details,
+		At:         gs.clock.Now(),
+	}
+
+	gs.logf("[MODERATION] %s: %s %s %s: %s", actorID, action, targetKind, target, reason)
+	gs.goWrite(func() { gs.storeAuditEntry(entry) })
+}
+
+// handles moderators banning an account, user or IP
+// A duration of 0 bans permanently. Banned users and IPs are disconnected straight away
+// Subscriber IDs change on reconnect, so they can only be banned for a set time
+func (gs *GameServer) banHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var req struct {
+		Kind            string `json:"kind"` // "account" (default), "user" or "ip"
+		Target          string `json:"target"`
+		DurationSeconds int    `json:"duration_seconds"`
+		Reason          string `json:"reason"`
+	}
+
+	if err := json.Unmarshal(data, &req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if req.Kind == "" {
+		req.Kind = moderation.KindAccount
+	}
+	target, err := moderation.Normalize(req.Kind, req.Target)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.DurationSeconds < 0 {
+		http.Error(w, "duration_seconds cannot be negative", http.StatusBadRequest)
+		return
+	}
+	if req.Kind == moderation.KindUser && req.DurationSeconds == 0 {
+		http.Error(w, "Subscriber IDs can't be banned permanently, ban the account or IP", http.StatusBadRequest)
+		return
+	}
+
+	now := gs.clock.Now()
+	ban := moderation.Ban{
+		ID:        uuid.New().String(),
+		Kind:      req.Kind,
+		Target:    target,
+		Reason:    req.Reason,
+		ActorID:   actorID(r),
+		CreatedAt: now,
+	}
+	if req.DurationSeconds > 0 {
+		ban.ExpiresAt = now.Add(time.Duration(req.DurationSeconds) * time.Second)
+	}
+
+	gs.bans.Add(ban)
+	gs.goWrite(func() { gs.storeBan(ban) })
+
+	var ids []int
+	switch ban.Kind {
+	case moderation.KindUser:
+		id, _ := strconv.Atoi(ban.Target)
+		ids = []int{id}
+	case moderation.KindAccount:
+		ids = gs.subscribersOf(ban.Target)
+	case moderation.KindIP:
+		ids = gs.subscribersFrom(ban.Target)
+	}
+
+	var kicked []int
+	for _, id := range ids {
+		gs.revokeSessions(id)
+		if gs.kickSubscriber(id, ban.Message()) {
+			kicked = append(kicked, id)
+		}
+	}
+
+	details := map[string]interface{}{
+		"ban_id": ban.ID,
+		"kicked": kicked,
+	}
+	if !ban.Permanent() {
+		details["expires_at"] = ban.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	gs.audit(moderation.ActionBan, ban.ActorID, ban.Kind, ban.Target, ban.Reason, details)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ban)
+}
+
+// handles moderators lifting a ban early
+func (gs *GameServer) unbanHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var req struct {
+		Kind   string `json:"kind"`
+		Target string `json:"target"`
+		Reason string `json:"reason"`
+	}
+
+	if err := json.Unmarshal(data, &req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if req.Kind == "" {
+		req.Kind = moderation.KindAccount
+	}
+	target, err := moderation.Normalize(req.Kind, req.Target)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ban, ok := gs.bans.Remove(req.Kind, target)
+	if !ok {
+		http.Error(w, "No ban in force on this target", http.StatusNotFound)
+		return
+	}
+
+	moderator := actorID(r)
+	gs.goWrite(func() { gs.revokeBan(ban.ID, moderator) })
+	gs.audit(moderation.ActionUnban, moderator, ban.Kind, ban.Target, req.Reason, map[string]interface{}{
+		"ban_id": ban.ID,
+	})
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handles requests for every ban in force, newest first
+func (gs *GameServer) listBansHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Bans []moderation.Ban `json:"bans"`
+	}{
+		Bans: gs.bans.List(),
+	})
+}
+
+// handles moderators kicking a user from a lobby, or from the server
+// Kicking from the global lobby, or without a lobby, disconnects the user
+func (gs *GameServer) kickHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var req struct {
+		UserID  int    `json:"user_id"`
+		LobbyID string `json:"lobby_id"`
+		Reason  string `json:"reason"`
+	}
+
+	if err := json.Unmarshal(data, &req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if req.LobbyID == "" {
+		req.LobbyID = "global"
+	}
+	r = r.WithContext(logging.With(r.Context(), "target_id", req.UserID, "lobby_id", req.LobbyID))
+
+	moderator := actorID(r)
+	target := strconv.Itoa(req.UserID)
+
+	if req.LobbyID == "global" {
+		reason := "Kicked by a moderator"
+		if req.Reason != "" {
+			reason += ": " + req.Reason
+		}
+		if !gs.kickSubscriber(req.UserID, reason) {
+			http.Error(w, "Subscriber not found", http.StatusNotFound)
+			return
+		}
+
+		gs.audit(moderation.ActionKick, moderator, moderation.KindUser, target, req.Reason, map[string]interface{}{
+			"lobby_id": req.LobbyID,
+		})
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	gs.lobbiesMutex.Lock()
+	lobby, exists := gs.lobbies[req.LobbyID]
+	gs.lobbiesMutex.Unlock()
+	if !exists {
+		http.Error(w, "Lobby not found", http.StatusNotFound)
+		return
+	}
+
+	lobby.mutex.Lock()
+	_, inLobby := lobby.subscribers[req.UserID]
+	delete(lobby.subscribers, req.UserID)
+	lobby.mutex.Unlock()
+
+	if !inLobby {
+		http.Error(w, "User is not in this lobby", http.StatusNotFound)
+		return
+	}
+
+	gs.audit(moderation.ActionKick, moderator, moderation.KindUser, target, req.Reason, map[string]interface{}{
+		"lobby_id": req.LobbyID,
+	})
+
+	kicked, _ := json.Marshal(Kicked{
+		Type:    "KICKED",
+		LobbyID: req.LobbyID,
+		Reason:  req.Reason,
+	})
+	gs.sendTo(req.UserID, kicked)
+
+	leave, _ := json.Marshal(LobbyEvent{
+		Type:    "LOBBY_LEAVE",
+		UserID:  req.UserID,
+		LobbyID: req.LobbyID,
+	})
+	gs.publishToLobby(r.Context(), req.LobbyID, leave)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handles moderators querying the audit log, newest first
+// Query: actor_id, action, target, since (unix seconds), skip, limit
+func (gs *GameServer) auditLogHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	skip := 0
+	limit := defaultAuditLimit
+	if s := q.Get("skip"); s != "" {
+		if v, err := strconv.Atoi(s); err == nil && v >= 0 {
+			skip = v
+		}
+	}
+	if l := q.Get("limit"); l != "" {
+		if v, err := strconv.Atoi(l); err == nil && v > 0 {
+			limit = min(v, maxAuditLimit)
+		}
+	}
+
+	client := gs.dbClient.GetSystemClient()
+	query := client.From("moderation_audit").
+		Select("id,action,actor_id,target_kind,target,reason,details,at", "", false)
+	if v := q.Get("actor_id"); v != "" {
+		query = query.Eq("actor_id", v)
+	}
+	if v := q.Get("action"); v != "" {
+		query = query.Eq("action", v)
+	}
+	if v := q.Get("target"); v != "" {
+		query = query.Eq("target", v)
+	}
+	if v := q.Get("since"); v != "" {
+		since, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid since timestamp", http.StatusBadRequest)
+			return
+		}
+		query = query.Gte("at", time.Unix(since, 0).UTC().Format(time.RFC3339))
+	}
+
+	resp, _, err := query.
+		Order("at", &postgrest.OrderOpts{Ascending: false}).
+		Range(skip, skip+limit-1, "").
+		Execute()
+	if err != nil {
+		gs.logc(r.Context(), "[ERROR] Failed to load audit log: %v", err)
+		http.Error(w, "Failed to load audit log", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+// storeAuditEntry appends an entry to the Supabase moderation_audit table
+// Entries are only ever inserted, never updated or deleted
+func (gs *GameServer) storeAuditEntry(entry moderation.Entry) {
+	record := map[string]interface{}{
+		"id":          entry.ID,
+		"action":      entry.Action,
+		"actor_id":    entry.ActorID,
+		"target_kind": entry.TargetKind,
+		"target":      entry.Target,
+		"reason":      entry.Reason,
+		"details":     entry.Details,
+		"at":          entry.At.UTC().Format(time.RFC3339),
+	}
+
+	client := gs.dbClient.GetSystemClient()
+	_, _, err := client.From("moderation_audit").Insert(record, false, "", "", "").Execute()
+	if err != nil {
+		gs.logf("[ERROR] Failed to store audit entry %s: %v", entry.ID, err)
+	}
+}
+
+// storeBan stores a ban in the Supabase bans table
+func (gs *GameServer) storeBan(ban moderation.Ban) {
+	record := map[string]interface{}{
+		"id":         ban.ID,
+		"kind":       ban.Kind,
+		"target":     ban.Target,
+		"reason":     ban.Reason,
+		"actor_id":   ban.ActorID,
+		"created_at": ban.CreatedAt.UTC().Format(time.RFC3339),
+		"expires_at": nil,
+	}
+	if !ban.Permanent() {
+		record["expires_at"] = ban.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+
+	client := gs.dbClient.GetSystemClient()
+	_, _, err := client.From("bans").Insert(record, false, "", "", "").Execute()
+	if err != nil {
+		gs.logf("[ERROR] Failed to store ban %s: %v", ban.ID, err)
+	}
+}
+
+// revokeBan marks a stored ban as lifted so it isn't loaded again
+func (gs *GameServer) revokeBan(id, moderator string) {
+	update := map[string]interface{}{
+		"revoked_at": gs.clock.Now().UTC().Format(time.RFC3339),
+		"revoked_by": moderator,
+	}
+
+	client := gs.dbClient.GetSystemClient()
+	_, _, err := client.From("bans").Update(update, "", "").Eq("id", id).Execute()
+	if err != nil {
+		gs.logf("[ERROR] Failed to revoke ban %s: %v", id, err)
+	}
+}
+
+// loadBans restores the bans still in force when the server starts
+func (gs *GameServer) loadBans() {
+	var rows []struct {
+		ID        string     `json:"id"`
+		Kind      string     `json:"kind"`
+		Target    string     `json:"target"`
+		Reason    string     `json:"reason"`
+		ActorID   string     `json:"actor_id"`
+		CreatedAt time.Time  `json:"created_at"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	client := gs.dbClient.GetSystemClient()
+	_, err := client.From("bans").
+		Select("id,kind,target,reason,actor_id,created_at,expires_at", "", false).
+		Is("revoked_at", "null").
+		Order("created_at", &postgrest.OrderOpts{Ascending: false}).
+		ExecuteTo(&rows)
+	if err != nil {
+		gs.logf("[ERROR] Failed to load bans: %v", err)
+		return
+	}
+
+	now := gs.clock.Now()
+	loaded := 0
+	for _, row := range rows {
+		ban := moderation.Ban{
+			ID:        row.ID,
+			Kind:      row.Kind,
+			Target:    row.Target,
+			Reason:    row.Reason,
+			ActorID:   row.ActorID,
+			CreatedAt: row.CreatedAt,
+		}
+		if row.ExpiresAt != nil {
+			ban.ExpiresAt = *row.ExpiresAt
+		}
+		// Newest first, so a ban already in force is either from since startup or a later ban on the same target
+		if _, exists := gs.bans.Check(ban.Kind, ban.Target); exists || !ban.Active(now) {
+			continue
+		}
+		gs.bans.Add(ban)
+		loaded++
+	}
+
+	gs.logf("[MODERATION] Loaded %d bans", loaded)
+}
@@ -0,0 +1,185 @@
+package ws
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/vindennt/akasha-showdown-engine/internal/logging"
+)
+
+// PresenceState is the user-facing status of a subscriber
+type PresenceState string
+
+const (
+	PresenceOnline     PresenceState = "online"
+	PresenceIdle       PresenceState = "idle"
+	PresenceInQueue    PresenceState = "in_queue"
+	PresenceInMatch    PresenceState = "in_match"
+	PresenceSpectating PresenceState = "spectating"
+	PresenceOffline    PresenceState = "offline"
+)
+
+// Max number of ids accepted by a single GET /presence query
+const maxPresenceQueryIDs = 100
+
+// setPresence moves a subscriber to a new presence state and broadcasts the diff
+// Does nothing if the subscriber is not connected or is already in that state
+func (gs *GameServer) setPresence(id int, state PresenceState) {
+	s := gs.GetSubscriber(id)
+	if s == nil {
+		return
+	}
+
+	prev, changed := s.setPresence(state)
+	if !changed {
+		return
+	}
+
+	gs.broadcastPresence(id, prev, state)
+}
+
+// swapPresence moves a subscriber to a new state only if they are currently in from
+// Used to end a state without overwriting one set since, e.g. spectating -> online
+func (gs *GameServer) swapPresence(id int, from, to PresenceState) {
+	s := gs.GetSubscriber(id)
+	if s == nil {
+		return
+	}
+
+	if s.swapPresence(from, to) {
+		gs.broadcastPresence(id, from, to)
+	}
+}
+
+// broadcastPresence sends a presence diff to the lobby
+// Every subscriber is in the global lobby, so this reaches their friends too
+// Diffs skip the publish limiter so that a burst of them can't stall the caller
+func (gs *GameServer) broadcastPresence(id int, prev, state PresenceState) {
+	gs.logf("[PRESENCE] User %d: %s -> %s", id, prev, state)
+
+	update := PresenceUpdate{
+		Type:      "PRESENCE_UPDATE",
+		ID:        id,
+		State:     state,
+		PrevState: prev,
+	}
+	msg, _ := json.Marshal(update)
+	gs.deliver(msg)
+}
+
+// presenceLoop periodically marks subscribers idle when their heartbeats and actions stop
+func (gs *GameServer) presenceLoop() {
+	ticker := gs.clock.NewTicker(gs.presenceSweepInterval)
+	defer ticker.Stop()
+
+	for range ticker.C() {
+		gs.sweepIdle()
+		gs.expireSessions()
+	}
+}
+
+// sweepIdle moves online subscribers without recent activity to idle
+// Only online subscribers go idle; queue and match states are owned by the server
+func (gs *GameServer) sweepIdle() {
+	cutoff := gs.clock.Now().Add(-gs.presenceIdleTimeout)
+
+	gs.globalLobby.mutex.Lock()
+	idle := make([]*Subscriber, 0)
+	for _, s := range gs.globalLobby.subscribers {
+		if s.Presence() == PresenceOnline && s.LastActive().Before(cutoff) {
+			idle = append(idle, s)
+		}
+	}
+	gs.globalLobby.mutex.Unlock()
+
+	// Broadcast outside the lobby lock since publish takes it again
+	for _, s := range idle {
+		if prev, changed := s.setPresence(PresenceIdle); changed {
+			gs.broadcastPresence(s.ID(), prev, PresenceIdle)
+		}
+	}
+}
+
+// seen records a heartbeat or action from the subscriber, which keeps them from going idle
+// An idle subscriber who is active again is back online
+func (gs *GameServer) seen(s *Subscriber) {
+	if prev, changed := s.touch(); changed {
+		gs.broadcastPresence(s.ID(), prev, PresenceOnline)
+	}
+}
+
+// handles client heartbeats, sent while the user is interacting with the page
+// Pongs are answered by the browser even in a background tab, so they don't count
+func (gs *GameServer) heartbeatHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var req struct {
+		UserID int `json:"user_id"`
+	}
+
+	if err := json.Unmarshal(data, &req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	r = r.WithContext(logging.With(r.Context(), "user_id", req.UserID))
+
+	s, ok := gs.authorize(w, r, req.UserID)
+	if !ok {
+		return
+	}
+	gs.seen(s)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handles bulk presence lookups: GET /presence?ids=1,2,3
+// Unknown or disconnected ids are reported as offline
+func (gs *GameServer) presenceHandler(w http.ResponseWriter, r *http.Request) {
+	raw := r.URL.Query().Get("ids")
+	if raw == "" {
+		http.Error(w, "ids is required", http.StatusBadRequest)
+		return
+	}
+
+	parts := strings.Split(raw, ",")
+	if len(parts) > maxPresenceQueryIDs {
+		http.Error(w, "Too many ids", http.StatusBadRequest)
+		return
+	}
+
+	users := make([]PresenceInfo, 0, len(parts))
+	for _, p := range parts {
+		id, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			http.Error(w, "Invalid id: "+p, http.StatusBadRequest)
+			return
+		}
+
+		info := PresenceInfo{ID: id, State: PresenceOffline}
+		if s := gs.GetSubscriber(id); s != nil {
+			info.State = s.Presence()
+			info.LastActive = s.LastActive().Unix()
+			info.LatencyMs = s.Latency().Milliseconds()
+		}
+		users = append(users, info)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Users []PresenceInfo `json:"users"`
+	}{
+		Users: users,
+	})
+}
@@ -0,0 +1,136 @@
+package ws
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+)
+
+// Elo ratings per game mode, plus a global rating across every mode
+// Players start each mode at defaultRating, and ratings reset softly each season
+const (
+	defaultRating = 1500
+	ratingK       = 32       // Most a rating can move in one match
+	globalBoard   = "global" // Rating and leaderboard covering every mode
+)
+
+// Ratings are kept by Supabase account, so they follow a player across connections
+// Guests have no account and are never rated
+type ratingKey struct {
+	Mode    string
+	Account string
+}
+
+// playerRating is a player's rating and record for the current season
+type playerRating struct {
+	Rating int
+	Wins   int
+	Losses int
+}
+
+// rating returns an account's rating in a mode, guests get defaultRating
+func (gs *GameServer) rating(mode, account string) int {
+	gs.ratingsMutex.Lock()
+	defer gs.ratingsMutex.Unlock()
+	return gs.ratingLocked(mode, account).Rating
+}
+
+// Caller must hold ratingsMutex
+func (gs *GameServer) ratingLocked(mode, account string) playerRating {
+	if r, ok := gs.ratings[ratingKey{mode, account}]; ok {
+		return r
+	}
+	return playerRating{Rating: defaultRating}
+}
+
+// setRatingLocked stores a rating and moves the player on that mode's leaderboard
+// Caller must hold ratingsMutex
+func (gs *GameServer) setRatingLocked(mode, account string, r playerRating) {
+	key := ratingKey{mode, account}
+
+	board, ok := gs.boards[mode]
+	if !ok {
+		board = &leaderboard{}
+		gs.boards[mode] = board
+	}
+	if old, ok := gs.ratings[key]; ok {
+		board.remove(account, old.Rating)
+	}
+	board.insert(leaderboardRow{Account: account, playerRating: r})
+
+	gs.ratings[key] = r
+}
+
+// updateRatings applies the Elo update for a finished match to the mode and global
+// ratings, stores them, and tells both accounts their new ratings
+func (gs *GameServer) updateRatings(mode string, winner, loser string) {
+	updates := make([]RatingUpdate, 0, 4)
+
+	gs.ratingsMutex.Lock()
+	season := gs.season.Number
+	for _, board := range []string{mode, globalBoard} {
+		w := gs.ratingLocked(board, winner)
+		l := gs.ratingLocked(board, loser)
+
+		delta := eloDelta(w.Rating, l.Rating)
+
+		gs.setRatingLocked(board, winner, playerRating{w.Rating + delta, w.Wins + 1, w.Losses})
+		gs.setRatingLocked(board, loser, playerRating{l.Rating - delta, l.Wins, l.Losses + 1})
+
+		gs.logf("[RATING] %s: Account %s %d -> %d, Account %s %d -> %d", board, winner, w.Rating, w.Rating+delta, loser, l.Rating, l.Rating-delta)
+
+		updates = append(updates,
+			gs.ratingUpdateLocked(board, winner, delta),
+			gs.ratingUpdateLocked(board, loser, -delta),
+		)
+	}
+	gs.ratingsMutex.Unlock()
+
+	for _, u := range updates {
+		msg, _ := json.Marshal(u)
+		gs.sendToAccount(u.AccountID, msg)
+		gs.goWrite(func() { gs.storeRating(season, u.Mode, u.AccountID, playerRating{u.Rating, u.Wins, u.Losses}) })
+	}
+}
+
+// eloDelta returns the points the winner gains and the loser gives up
+func eloDelta(winner, loser int) int {
+	expected := 1 / (1 + math.Pow(10, float64(loser-winner)/400))
+	return int(math.Round(ratingK * (1 - expected)))
+}
+
+// ratingUpdateLocked builds the RATING_UPDATE sent to a player after a match
+// Caller must hold ratingsMutex
+func (gs *GameServer) ratingUpdateLocked(mode, account string, change int) RatingUpdate {
+	r := gs.ratingLocked(mode, account)
+	return RatingUpdate{
+		Type:      "RATING_UPDATE",
+		Mode:      mode,
+		AccountID: account,
+		Rating:    r.Rating,
+		Change:    change,
+		Tier:      tierFor(r.Rating),
+		Rank:      gs.boards[mode].rank(account, r.Rating),
+		Wins:      r.Wins,
+		Losses:    r.Losses,
+	}
+}
+
+// storeRating upserts an account's rating in the Supabase player_ratings table
+func (gs *GameServer) storeRating(season int, mode, account string, r playerRating) {
+	record := map[string]interface{}{
+		"user_id":    account,
+		"mode":       mode,
+		"season":     season,
+		"rating":     r.Rating,
+		"wins":       r.Wins,
+		"losses":     r.Losses,
+		"updated_at": gs.clock.Now().UTC().Format(time.RFC3339),
+	}
+
+	client := gs.dbClient.GetSystemClient()
+	_, _, err := client.From("player_ratings").Upsert(record, "user_id,mode,season", "", "").Execute()
+	if err != nil {
+		gs.logf("[ERROR] Failed to store rating for account %s: %v", account, err)
+	}
+}
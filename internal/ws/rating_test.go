@@ -0,0 +1,26 @@
+package ws
+
+import "testing"
+
+func TestEloDelta(t *testing.T) {
+	tests := []struct {
+		name          string
+		winner, loser int
+		want          int
+	}{
+		{"even", 1500, 1500, 16},
+		{"underdog wins", 1500, 1900, 29},
+		{"favourite wins", 1900, 1500, 3},
+		{"small gap", 1550, 1500, 14},
+		{"huge upset", 1000, 3000, 32},
+		{"expected result", 3000, 1000, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := eloDelta(tt.winner, tt.loser); got != tt.want {
+				t.Errorf("eloDelta(%d, %d) = %d, want %d", tt.winner, tt.loser, got, tt.want)
+			}
+		})
+	}
+}
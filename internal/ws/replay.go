@@ -0,0 +1,313 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/vindennt/akasha-showdown-engine/internal/game"
+	"github.com/vindennt/akasha-showdown-engine/internal/logging"
+)
+
+// Bump when the replay format changes
+const replayVersion = 1
+
+// Number of finished replays kept in memory for fast download and playback
+const replayCacheSize = 100
+
+// Replay is the compact log of a match: the engine seed plus every accepted command
+// Feeding the events back into a fresh engine with the same seed reproduces the match
+type Replay struct {
+	Version   int           `json:"v"`
+	MatchID   string        `json:"match_id"`
+	Mode      string        `json:"mode"`
+	Seed      int64         `json:"seed"`
+	Options   game.Options  `json:"options"` // Engine options, such as bans carried from earlier in a series
+	Players   [2]int        `json:"players"`
+	StartedAt int64         `json:"started_at"` // Unix ms
+	WinnerID  int           `json:"winner_id"`
+	Events    []ReplayEvent `json:"events"`
+}
+
+type ReplayEvent struct {
+	At       int64  `json:"t"` // ms since match start
+	PlayerID int    `json:"p"`
+	Action   string `json:"a"`
+}
+
+// playback is a running replay stream to a subscriber
+type playback struct {
+	cancel context.CancelFunc
+}
+
+// recordLocked appends an accepted command to the match's replay
+// Caller must hold m.mutex
+func (m *Match) recordLocked(cmd game.Command) {
+	m.replay.Events = append(m.replay.Events, ReplayEvent{
+		At:       m.clock.Since(m.StartedAt).Milliseconds(),
+		PlayerID: cmd.PlayerID,
+		Action:   cmd.Action,
+	})
+}
+
+// saveReplay caches a finished match's replay and stores it next to the match record
+func (gs *GameServer) saveReplay(m *Match) {
+	m.mutex.Lock()
+	replay := m.replay
+	replay.WinnerID = m.engine.Winner()
+	replay.Events = append([]ReplayEvent(nil), m.replay.Events...)
+	m.mutex.Unlock()
+
+	gs.cacheReplay(&replay)
+	gs.goWrite(func() { gs.storeReplay(m.logCtx(), &replay) })
+}
+
+// cacheReplay keeps the most recent replays in memory, evicting the oldest
+func (gs *GameServer) cacheReplay(replay *Replay) {
+	gs.replaysMutex.Lock()
+	defer gs.replaysMutex.Unlock()
+
+	if _, exists := gs.replays[replay.MatchID]; !exists {
+		gs.replayOrder = append(gs.replayOrder, replay.MatchID)
+	}
+	gs.replays[replay.MatchID] = replay
+
+	for len(gs.replayOrder) > replayCacheSize {
+		delete(gs.replays, gs.replayOrder[0])
+		gs.replayOrder = gs.replayOrder[1:]
+	}
+}
+
+// storeReplay stores a replay in the Supabase match_replays table, keyed by match ID
+func (gs *GameServer) storeReplay(ctx context.Context, replay *Replay) {
+	row := map[string]interface{}{
+		"match_id": replay.MatchID,
+		"mode":     replay.Mode,
+		"seed":     replay.Seed,
+		"replay":   replay,
+	}
+
+	client := gs.dbClient.GetSystemClient()
+	_, _, err := client.From("match_replays").Insert(row, false, "", "", "").ExecuteWithContext(ctx)
+	if err != nil {
+		gs.logc(ctx, "[ERROR] Failed to store replay for match %s: %v", replay.MatchID, err)
+		return
+	}
+
+	gs.logc(ctx, "[SUCCESS] Replay stored: match=%s, events=%d", replay.MatchID, len(replay.Events))
+}
+
+// loadReplay returns a replay from the cache, falling back to Supabase
+func (gs *GameServer) loadReplay(ctx context.Context, matchID string) (*Replay, error) {
+	gs.replaysMutex.Lock()
+	replay, ok := gs.replays[matchID]
+	gs.replaysMutex.Unlock()
+	if ok {
+		return replay, nil
+	}
+
+	client := gs.dbClient.GetSystemClient()
+	resp, _, err := client.From("match_replays").Select("replay", "", false).Eq("match_id", matchID).ExecuteWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		Replay Replay `json:"replay"`
+	}
+	if err := json.Unmarshal(resp, &rows); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	return &rows[0].Replay, nil
+}
+
+// handles replay downloads: GET /matches/{id}/replay
+func (gs *GameServer) replayHandler(w http.ResponseWriter, r *http.Request) {
+	matchID := r.PathValue("id")
+	if matchID == "" {
+		http.Error(w, "Missing ID", http.StatusBadRequest)
+		return
+	}
+
+	replay, err := gs.loadReplay(r.Context(), matchID)
+	if err != nil {
+		gs.logc(r.Context(), "[ERROR] Failed to load replay for match %s: %v", matchID, err)
+		http.Error(w, "Failed to load replay", http.StatusInternalServerError)
+		return
+	}
+	if replay == nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="replay_%s.json"`, matchID))
+	json.NewEncoder(w).Encode(replay)
+}
+
+// handles requests to play a replay back over the subscriber's WebSocket
+// Supported speeds are 1, 2 and 4. Starting a new playback stops the previous one
+func (gs *GameServer) playReplayHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var req struct {
+		MatchID string `json:"match_id"`
+		UserID  int    `json:"user_id"`
+		Speed   int    `json:"speed"`
+	}
+
+	if err := json.Unmarshal(data, &req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	r = r.WithContext(logging.With(r.Context(), "match_id", req.MatchID, "user_id", req.UserID))
+
+	if _, ok := gs.authorize(w, r, req.UserID); !ok {
+		return
+	}
+
+	if req.Speed == 0 {
+		req.Speed = 1
+	}
+	if req.Speed != 1 && req.Speed != 2 && req.Speed != 4 {
+		http.Error(w, "Speed must be 1, 2 or 4", http.StatusBadRequest)
+		return
+	}
+
+	replay, err := gs.loadReplay(r.Context(), req.MatchID)
+	if err != nil {
+		gs.logc(r.Context(), "[ERROR] Failed to load replay for match %s: %v", req.MatchID, err)
+		http.Error(w, "Failed to load replay", http.StatusInternalServerError)
+		return
+	}
+	if replay == nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pb := &playback{cancel: cancel}
+
+	gs.replaysMutex.Lock()
+	if prev, playing := gs.playbacks[req.UserID]; playing {
+		prev.cancel()
+	}
+	gs.playbacks[req.UserID] = pb
+	gs.replaysMutex.Unlock()
+
+	go gs.playReplay(ctx, pb, req.UserID, replay, req.Speed)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handles requests to stop a running replay playback
+func (gs *GameServer) stopReplayHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var req struct {
+		UserID int `json:"user_id"`
+	}
+
+	if err := json.Unmarshal(data, &req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	r = r.WithContext(logging.With(r.Context(), "user_id", req.UserID))
+
+	if _, ok := gs.authorize(w, r, req.UserID); !ok {
+		return
+	}
+
+	gs.replaysMutex.Lock()
+	if pb, playing := gs.playbacks[req.UserID]; playing {
+		pb.cancel()
+	}
+	gs.replaysMutex.Unlock()
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// playReplay rebuilds the match from its seed and streams each state to the subscriber
+// Keeps the recorded gaps between commands, divided by speed
+// Stops early if canceled or the subscriber disconnects
+func (gs *GameServer) playReplay(ctx context.Context, pb *playback, userID int, replay *Replay, speed int) {
+	defer func() {
+		pb.cancel()
+		gs.replaysMutex.Lock()
+		// A newer playback may have replaced this one
+		if gs.playbacks[userID] == pb {
+			delete(gs.playbacks, userID)
+		}
+		gs.replaysMutex.Unlock()
+	}()
+
+	engine, err := game.New(replay.Mode, replay.Players, rand.New(rand.NewSource(replay.Seed)), replay.Options)
+	if err != nil {
+		gs.logf("[ERROR] Cannot play replay for match %s: %v", replay.MatchID, err)
+		return
+	}
+
+	send := func(frame ReplayFrame) bool {
+		if gs.GetSubscriber(userID) == nil {
+			return false
+		}
+		msg, _ := json.Marshal(frame)
+		gs.sendTo(userID, msg)
+		return true
+	}
+
+	if !send(ReplayFrame{Type: "REPLAY_START", MatchID: replay.MatchID, Speed: speed, State: engine.State()}) {
+		return
+	}
+
+	var last int64
+	for i := range replay.Events {
+		event := replay.Events[i]
+
+		wait := time.Duration(event.At-last) * time.Millisecond / time.Duration(speed)
+		last = event.At
+
+		select {
+		case <-gs.clock.After(wait):
+		case <-ctx.Done():
+			return
+		}
+
+		if err := engine.Apply(game.Command{PlayerID: event.PlayerID, Action: event.Action}); err != nil {
+			gs.logf("[ERROR] Replay for match %s diverged at event %d: %v", replay.MatchID, i, err)
+			return
+		}
+
+		if !send(ReplayFrame{Type: "REPLAY_STATE", MatchID: replay.MatchID, Speed: speed, Event: &event, State: engine.State()}) {
+			return
+		}
+	}
+
+	send(ReplayFrame{Type: "REPLAY_END", MatchID: replay.MatchID, Speed: speed, State: engine.State()})
+}
@@ -0,0 +1,36 @@
+package ws
+
+import (
+	"net/http"
+
+	"github.com/vindennt/akasha-showdown-engine/internal/apikey"
+	"github.com/vindennt/akasha-showdown-engine/internal/auth"
+	"github.com/vindennt/akasha-showdown-engine/internal/models"
+)
+
+// Roles for subscribers that connect without an access token
+var guestRoles = []string{string(auth.RolePlayer)}
+
+// requireRole only lets through authenticated users holding one of roles
+func (gs *GameServer) requireRole(next http.HandlerFunc, roles ...auth.Role) http.HandlerFunc {
+	return gs.authClient.RequireRole(roles...)(next).ServeHTTP
+}
+
+// requireAccess lets through users holding one of roles, and API keys granted scope
+func (gs *GameServer) requireAccess(next http.HandlerFunc, scope apikey.Scope, roles ...auth.Role) http.HandlerFunc {
+	return gs.authClient.RequireAccess(scope, roles...)(next).ServeHTTP
+}
+
+// actorID returns the authenticated user's Supabase user ID, or the service principal
+// for API keys, for the audit log
+func actorID(r *http.Request) string {
+	user, _ := r.Context().Value(auth.UserContextKey).(models.User)
+	return user.ID
+}
+
+// subscriberHasRole reports whether a connected subscriber holds a role
+// Used for WebSocket commands, which identify the subscriber rather than a Supabase user
+func (gs *GameServer) subscriberHasRole(id int, role auth.Role) bool {
+	s := gs.GetSubscriber(id)
+	return s != nil && auth.HasRole(s.roles, role)
+}
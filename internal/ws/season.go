@@ -0,0 +1,270 @@
+package ws
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Season is a ranked season. Seasons run back to back from seasonStart,
+// each seasonLength long, so the current season only depends on the time
+// When a season ends, standings are archived and ratings soft reset halfway to defaultRating
+type Season struct {
+	Number   int // Starts at 1
+	StartsAt time.Time
+	EndsAt   time.Time
+}
+
+func (s Season) info() SeasonInfo {
+	return SeasonInfo{
+		Number:   s.Number,
+		StartsAt: s.StartsAt.Unix(),
+		EndsAt:   s.EndsAt.Unix(),
+	}
+}
+
+// How much of a rating's distance from defaultRating carries into the next season
+const seasonCarryOver = 0.5
+
+// seasonAt returns the season in progress at t
+// Anything before the first season counts as the first season
+func (gs *GameServer) seasonAt(t time.Time) Season {
+	n := 0
+	if t.After(gs.seasonStart) {
+		n = int(t.Sub(gs.seasonStart) / gs.seasonLength)
+	}
+	start := gs.seasonStart.Add(time.Duration(n) * gs.seasonLength)
+	return Season{
+		Number:   n + 1,
+		StartsAt: start,
+		EndsAt:   start.Add(gs.seasonLength),
+	}
+}
+
+// softReset pulls a rating towards defaultRating for the start of a new season
+func softReset(rating int) int {
+	return defaultRating + int(float64(rating-defaultRating)*seasonCarryOver)
+}
+
+// seasonLoop rolls the season over each time one ends
+func (gs *GameServer) seasonLoop() {
+	for {
+		gs.ratingsMutex.Lock()
+		endsAt := gs.season.EndsAt
+		gs.ratingsMutex.Unlock()
+
+		<-gs.clock.After(endsAt.Sub(gs.clock.Now()))
+		gs.rolloverSeason()
+	}
+}
+
+// rolloverSeason archives the ended season's standings and soft resets every rating
+func (gs *GameServer) rolloverSeason() {
+	gs.ratingsMutex.Lock()
+	ended := gs.season
+	gs.season = gs.seasonAt(ended.EndsAt)
+	next := gs.season
+
+	standings := seasonStandings(ended.Number, gs.ratings)
+
+	previous := gs.ratings
+	gs.ratings = make(map[ratingKey]playerRating, len(previous))
+	gs.boards = make(map[string]*leaderboard)
+	for key, r := range previous {
+		gs.setRatingLocked(key.Mode, key.Account, playerRating{Rating: softReset(r.Rating)})
+	}
+	reset := make(map[ratingKey]playerRating, len(gs.ratings))
+	for key, r := range gs.ratings {
+		reset[key] = r
+	}
+	gs.ratingsMutex.Unlock()
+
+	gs.logf("[SEASON] Season %d ended, season %d started with %d ratings carried over", ended.Number, next.Number, len(reset))
+
+	gs.goWrite(func() { gs.archiveStandings(ended.Number, standings) })
+	gs.goWrite(func() { gs.storeRatings(next.Number, reset) })
+
+	info := next.info()
+	info.Type = "SEASON_START"
+	msg, _ := json.Marshal(info)
+	gs.publish(msg)
+}
+
+// seasonStandings ranks every account on every board for the archive
+func seasonStandings(season int, ratings map[ratingKey]playerRating) []map[string]interface{} {
+	boards := make(map[string][]leaderboardRow)
+	for key, r := range ratings {
+		boards[key.Mode] = append(boards[key.Mode], leaderboardRow{Account: key.Account, playerRating: r})
+	}
+
+	standings := make([]map[string]interface{}, 0, len(ratings))
+	for mode, rows := range boards {
+		sort.Slice(rows, func(i, j int) bool {
+			return ahead(rows[i].Rating, rows[i].Account, rows[j].Rating, rows[j].Account)
+		})
+		for i, row := range rows {
+			standings = append(standings, map[string]interface{}{
+				"season":  season,
+				"mode":    mode,
+				"user_id": row.Account,
+				"rank":    i + 1,
+				"rating":  row.Rating,
+				"tier":    tierFor(row.Rating),
+				"wins":    row.Wins,
+				"losses":  row.Losses,
+			})
+		}
+	}
+	return standings
+}
+
+// archiveStandings stores final standings in the Supabase season_standings table
+// Upserts so archiving the same season twice is harmless
+func (gs *GameServer) archiveStandings(season int, standings []map[string]interface{}) {
+	if len(standings) == 0 {
+		return
+	}
+
+	client := gs.dbClient.GetSystemClient()
+	_, _, err := client.From("season_standings").Upsert(standings, "season,mode,user_id", "", "").Execute()
+	if err != nil {
+		gs.logf("[ERROR] Failed to archive season %d standings: %v", season, err)
+		return
+	}
+
+	gs.logf("[SUCCESS] Archived %d standings for season %d", len(standings), season)
+}
+
+// storeRatings upserts many ratings at once in the Supabase player_ratings table
+func (gs *GameServer) storeRatings(season int, ratings map[ratingKey]playerRating) {
+	if len(ratings) == 0 {
+		return
+	}
+
+	updatedAt := gs.clock.Now().UTC().Format(time.RFC3339)
+	records := make([]map[string]interface{}, 0, len(ratings))
+	for key, r := range ratings {
+		records = append(records, map[string]interface{}{
+			"user_id":    key.Account,
+			"mode":       key.Mode,
+			"season":     season,
+			"rating":     r.Rating,
+			"wins":       r.Wins,
+			"losses":     r.Losses,
+			"updated_at": updatedAt,
+		})
+	}
+
+	client := gs.dbClient.GetSystemClient()
+	_, _, err := client.From("player_ratings").Upsert(records, "user_id,mode,season", "", "").Execute()
+	if err != nil {
+		gs.logf("[ERROR] Failed to store season %d ratings: %v", season, err)
+	}
+}
+
+// loadRatings fills the leaderboards from stored ratings when the server starts
+// Ratings only found in the previous season mean the server was down when it ended,
+// so that season is archived and soft reset here instead
+// Players who finished a match before the load keep their newer in-memory rating
+func (gs *GameServer) loadRatings() {
+	gs.ratingsMutex.Lock()
+	season := gs.season.Number
+	gs.ratingsMutex.Unlock()
+
+	var rows []struct {
+		Account string `json:"user_id"`
+		Mode    string `json:"mode"`
+		Season  int    `json:"season"`
+		Rating  int    `json:"rating"`
+		Wins    int    `json:"wins"`
+		Losses  int    `json:"losses"`
+	}
+
+	client := gs.dbClient.GetSystemClient()
+	_, err := client.From("player_ratings").
+		Select("user_id,mode,season,rating,wins,losses", "", false).
+		Gte("season", strconv.Itoa(season-1)).
+		ExecuteTo(&rows)
+	if err != nil {
+		gs.logf("[ERROR] Failed to load ratings: %v", err)
+		return
+	}
+
+	current := make(map[ratingKey]playerRating)
+	previous := make(map[ratingKey]playerRating)
+	for _, row := range rows {
+		key := ratingKey{row.Mode, row.Account}
+		r := playerRating{row.Rating, row.Wins, row.Losses}
+		switch row.Season {
+		case season:
+			current[key] = r
+		case season - 1:
+			previous[key] = r
+		}
+	}
+
+	carried := make(map[ratingKey]playerRating)
+	for key, r := range previous {
+		if _, ok := current[key]; !ok {
+			carried[key] = playerRating{Rating: softReset(r.Rating)}
+			current[key] = carried[key]
+		}
+	}
+
+	gs.ratingsMutex.Lock()
+	loaded := 0
+	for key, r := range current {
+		if _, ok := gs.ratings[key]; !ok {
+			gs.setRatingLocked(key.Mode, key.Account, r)
+			loaded++
+		}
+	}
+	gs.ratingsMutex.Unlock()
+
+	gs.logf("[SEASON] Season %d: loaded %d ratings", season, loaded)
+
+	if len(carried) > 0 {
+		gs.logf("[SEASON] Carrying %d ratings over from season %d", len(carried), season-1)
+		standings := seasonStandings(season-1, previous)
+		gs.goWrite(func() { gs.archiveStandings(season-1, standings) })
+		gs.goWrite(func() { gs.storeRatings(season, carried) })
+	}
+}
+
+// handles requests for the current season
+func (gs *GameServer) seasonHandler(w http.ResponseWriter, r *http.Request) {
+	gs.ratingsMutex.Lock()
+	info := gs.season.info()
+	gs.ratingsMutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+// handles requests for an account's archived end-of-season standings
+// Standings are archived by Supabase account, so id is an account ID
+func (gs *GameServer) playerSeasonsHandler(w http.ResponseWriter, r *http.Request) {
+	account := r.PathValue("id")
+	if err := uuid.Validate(account); err != nil {
+		http.Error(w, "Invalid account ID", http.StatusBadRequest)
+		return
+	}
+
+	client := gs.dbClient.GetSystemClient()
+	resp, _, err := client.From("season_standings").
+		Select("season,mode,rank,rating,tier,wins,losses", "", false).
+		Eq("user_id", account).
+		Execute()
+	if err != nil {
+		gs.logc(r.Context(), "[ERROR] Failed to load season standings for account %s: %v", account, err)
+		http.Error(w, "Failed to load season standings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
@@ -0,0 +1,408 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vindennt/akasha-showdown-engine/internal/game"
+	"github.com/vindennt/akasha-showdown-engine/internal/logging"
+	"github.com/vindennt/akasha-showdown-engine/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SeriesOptions are what players queue for. Only identical options are paired
+type SeriesOptions struct {
+	Mode   string
+	BestOf int
+	Ranked bool // Whether results change ratings
+}
+
+// validBestOf reports whether a series length is supported
+func validBestOf(n int) bool {
+	return n == 1 || n == 3 || n == 5
+}
+
+// Reasons a series ended, sent with SERIES_RESULT and stored in the series record
+const (
+	SeriesDecided = "decided" // A player won enough games
+)
+
+// Series is a best-of-N set of matches between the same two players
+// A single match is a best of 1. Sides swap every game so neither player always
+// moves first, and draft bans carry from game to game
+type Series struct {
+	ID        string
+	Mode      string
+	BestOf    int
+	Ranked    bool
+	Players   [2]int    // Sides for game 1
+	Accounts  [2]string // Indexed like Players, empty for guests. Ratings are kept by account
+	Wins      [2]int    // Indexed like Players
+	MatchIDs  []string
+	Bans      []string // Carried into the next game by draft modes
+	WinnerID  int
+	Reason    string // Set when the series ends
+	StartedAt time.Time
+
+	TournamentID   string // Set when this is a tournament bracket match
+	BracketMatchID string // Which match of the tournament's bracket
+
+	ctx     context.Context // Carries the series span while it runs, see runSeries
+	resumed *Match          // Game in progress restored from a snapshot, finished before any new game
+}
+
+// account returns the account a player of the series signed in as
+func (sr *Series) account(id int) string {
+	if sr.Players[1] == id {
+		return sr.Accounts[1]
+	}
+	return sr.Accounts[0]
+}
+
+// logCtx carries the series' IDs for logging, and its span once it's running
+func (sr *Series) logCtx() context.Context {
+	ctx := sr.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return logging.With(ctx, "series_id", sr.ID, "mode", sr.Mode, "tournament_id", sr.TournamentID)
+}
+
+// rematch is a pending rematch offer after a series
+// decided receives "" once both players accept, or the reason it was cancelled
+type rematch struct {
+	players  [2]int
+	accepted [2]bool
+	decided  chan string
+}
+
+// startSeries plays series between two players until they stop accepting rematches
+func (gs *GameServer) startSeries(player1, player2 int, opts SeriesOptions) {
+	gs.playSeries(gs.newSeries([2]int{player1, player2}, opts))
+}
+
+// playSeries plays a series, then rematches until players stop accepting
+// Each rematch keeps the options and swaps sides, then players return to the lobby
+func (gs *GameServer) playSeries(sr *Series) {
+	players := sr.Players
+	opts := SeriesOptions{Mode: sr.Mode, BestOf: sr.BestOf, Ranked: sr.Ranked}
+
+	for {
+		if err := gs.runSeries(sr); err != nil {
+			gs.logf("[ERROR] Failed to run series for users %d and %d: %v", players[0], players[1], err)
+			break
+		}
+
+		// No rematch with a player who abandoned, or once the server is shutting down
+		if sr.Reason == EndAbandon || sr.Reason == EndNoShow || gs.rematchTimeout == 0 || gs.Draining() {
+			gs.clock.Sleep(gs.resultDelay)
+			break
+		}
+		if !gs.offerRematch(sr) || gs.Draining() {
+			break
+		}
+
+		players = [2]int{players[1], players[0]}
+		sr = gs.newSeries(players, opts)
+	}
+
+	gs.logf("Returning players %d and %d to global lobby", players[0], players[1])
+	gs.setPresence(players[0], PresenceOnline)
+	gs.setPresence(players[1], PresenceOnline)
+}
+
+// newSeries creates a series that hasn't started yet
+func (gs *GameServer) newSeries(players [2]int, opts SeriesOptions) *Series {
+	return &Series{
+		ID:        uuid.New().String(),
+		Mode:      opts.Mode,
+		BestOf:    opts.BestOf,
+		Ranked:    opts.Ranked,
+		Players:   players,
+		Accounts:  [2]string{gs.accountOf(players[0]), gs.accountOf(players[1])},
+		MatchIDs:  make([]string, 0, opts.BestOf),
+		StartedAt: gs.clock.Now(),
+	}
+}
+
+// runSeries plays games until a player has won a majority of BestOf
+// Abandoning any game forfeits the whole series, and both players missing one ends it
+func (gs *GameServer) runSeries(sr *Series) (err error) {
+	// Each series is its own trace, with a span per game under it
+	ctx, span := tracing.Start(context.Background(), "series", trace.WithAttributes(
+		attribute.String("series.id", sr.ID),
+		attribute.String("series.mode", sr.Mode),
+		attribute.Int("series.best_of", sr.BestOf),
+		attribute.Bool("series.ranked", sr.Ranked),
+	))
+	if sr.TournamentID != "" {
+		span.SetAttributes(attribute.String("tournament.id", sr.TournamentID))
+	}
+	sr.ctx = ctx
+	defer func() {
+		span.SetAttributes(attribute.Int("series.winner_id", sr.WinnerID), attribute.String("series.reason", sr.Reason))
+		tracing.End(span, err)
+	}()
+
+	needed := sr.BestOf/2 + 1
+
+	for {
+		sides := sr.Players
+		if len(sr.MatchIDs)%2 == 1 {
+			sides = [2]int{sr.Players[1], sr.Players[0]}
+		}
+
+		var m *Match
+		var result MatchResult
+		var err error
+		if sr.resumed != nil {
+			m, result, err = gs.resumeMatch(sr.resumed)
+			sr.resumed = nil
+		} else {
+			m, result, err = gs.playMatch(sr, sides, game.Options{Bans: sr.Bans})
+		}
+		if err != nil {
+			return err
+		}
+		sr.MatchIDs = append(sr.MatchIDs, m.ID)
+
+		m.mutex.Lock()
+		if d, ok := m.engine.(game.Drafter); ok {
+			sr.Bans = d.Bans()
+		}
+		m.mutex.Unlock()
+
+		winner := 0
+		if result.WinnerID == sr.Players[1] {
+			winner = 1
+		}
+		sr.Wins[winner]++
+
+		if result.Reason == EndAbandon || result.Reason == EndNoShow || sr.Wins[winner] >= needed {
+			sr.WinnerID = result.WinnerID
+			sr.Reason = SeriesDecided
+			if result.Reason == EndAbandon || result.Reason == EndNoShow {
+				sr.Reason = result.Reason
+			}
+			break
+		}
+
+		gs.publishSeries(sr, "SERIES_UPDATE")
+
+		// Let players see the result before the next game starts
+		gs.clock.Sleep(gs.resultDelay)
+	}
+
+	gs.logc(sr.logCtx(), "[MATCH] Series %s won by User %d (%d-%d, %s)", sr.ID, sr.WinnerID, sr.Wins[0], sr.Wins[1], sr.Reason)
+	gs.publishSeries(sr, "SERIES_RESULT")
+	gs.goWrite(func() { gs.storeSeriesRecord(sr) })
+
+	return nil
+}
+
+// publishSeries announces the series score
+func (gs *GameServer) publishSeries(sr *Series, msgType string) {
+	update := SeriesUpdate{
+		Type:     msgType,
+		SeriesID: sr.ID,
+		Mode:     sr.Mode,
+		BestOf:   sr.BestOf,
+		Players:  sr.Players,
+		Wins:     sr.Wins,
+		WinnerID: sr.WinnerID,
+		Reason:   sr.Reason,
+	}
+	if sr.Reason == "" {
+		update.NextGame = len(sr.MatchIDs) + 1
+	}
+	msg, _ := json.Marshal(update)
+	gs.publish(msg)
+}
+
+// offerRematch asks both players for a rematch and waits for them to decide
+// Returns true only if both accept within rematchTimeout
+func (gs *GameServer) offerRematch(sr *Series) bool {
+	r := &rematch{
+		players: sr.Players,
+		decided: make(chan string, 1),
+	}
+
+	gs.rematchesMutex.Lock()
+	gs.rematches[sr.ID] = r
+	gs.rematchesMutex.Unlock()
+
+	gs.sendRematch(r, RematchUpdate{
+		Type:      "REMATCH_OFFER",
+		SeriesID:  sr.ID,
+		Accepted:  []int{},
+		ExpiresAt: gs.clock.Now().Add(gs.rematchTimeout).UnixMilli(),
+	})
+
+	var reason string
+	select {
+	case reason = <-r.decided:
+	case <-gs.clock.After(gs.rematchTimeout):
+		reason = "expired"
+	}
+
+	gs.rematchesMutex.Lock()
+	delete(gs.rematches, sr.ID)
+	// Both may have accepted just as the offer expired
+	select {
+	case reason = <-r.decided:
+	default:
+	}
+	gs.rematchesMutex.Unlock()
+
+	if reason != "" {
+		gs.logc(sr.logCtx(), "[MATCH] Rematch for series %s cancelled: %s", sr.ID, reason)
+		gs.sendRematch(r, RematchUpdate{
+			Type:     "REMATCH_CANCELLED",
+			SeriesID: sr.ID,
+			Accepted: []int{},
+			Reason:   reason,
+		})
+		return false
+	}
+
+	gs.logc(sr.logCtx(), "[MATCH] Rematch accepted for series %s", sr.ID)
+	return true
+}
+
+// sendRematch sends a rematch message to both players
+func (gs *GameServer) sendRematch(r *rematch, update RematchUpdate) {
+	msg, _ := json.Marshal(update)
+	for _, id := range r.players {
+		gs.sendTo(id, msg)
+	}
+}
+
+// handles players accepting or declining a rematch
+func (gs *GameServer) rematchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var req struct {
+		SeriesID string `json:"series_id"`
+		UserID   int    `json:"user_id"`
+		Accept   bool   `json:"accept"`
+	}
+
+	if err := json.Unmarshal(data, &req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	r = r.WithContext(logging.With(r.Context(), "series_id", req.SeriesID, "user_id", req.UserID))
+
+	if _, ok := gs.authorize(w, r, req.UserID); !ok {
+		return
+	}
+
+	gs.rematchesMutex.Lock()
+	defer gs.rematchesMutex.Unlock()
+
+	offer, exists := gs.rematches[req.SeriesID]
+	if !exists {
+		http.Error(w, "No rematch offer for this series", http.StatusNotFound)
+		return
+	}
+
+	i := -1
+	for j, id := range offer.players {
+		if id == req.UserID {
+			i = j
+		}
+	}
+	if i < 0 {
+		http.Error(w, "Only players can answer a rematch offer", http.StatusForbidden)
+		return
+	}
+
+	if req.Accept && gs.rejectDraining(w) {
+		return
+	}
+
+	if !req.Accept {
+		gs.logc(r.Context(), "[MATCH] User %d declined a rematch for series %s", req.UserID, req.SeriesID)
+		select {
+		case offer.decided <- "declined":
+		default:
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	offer.accepted[i] = true
+
+	accepted := make([]int, 0, len(offer.players))
+	for j, id := range offer.players {
+		if offer.accepted[j] {
+			accepted = append(accepted, id)
+		}
+	}
+	gs.sendRematch(offer, RematchUpdate{
+		Type:     "REMATCH_UPDATE",
+		SeriesID: req.SeriesID,
+		Accepted: accepted,
+	})
+
+	if offer.accepted[0] && offer.accepted[1] {
+		select {
+		case offer.decided <- "":
+		default:
+		}
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// storeSeriesRecord stores the series result in the Supabase series table
+// Each game is stored separately in the matches table with the series ID
+func (gs *GameServer) storeSeriesRecord(sr *Series) {
+	loser := sr.Players[0]
+	if sr.WinnerID == loser {
+		loser = sr.Players[1]
+	}
+
+	record := map[string]interface{}{
+		"id":           sr.ID,
+		"mode":         sr.Mode,
+		"best_of":      sr.BestOf,
+		"ranked":       sr.Ranked,
+		"player1_id":   sr.Players[0],
+		"player2_id":   sr.Players[1],
+		"player1_wins": sr.Wins[0],
+		"player2_wins": sr.Wins[1],
+		"winner_id":    sr.WinnerID,
+		"loser_id":     loser,
+		"end_reason":   sr.Reason,
+		"match_ids":    sr.MatchIDs,
+		"started_at":   sr.StartedAt.UTC().Format(time.RFC3339),
+		"ended_at":     gs.clock.Now().UTC().Format(time.RFC3339),
+	}
+	if sr.TournamentID != "" {
+		record["tournament_id"] = sr.TournamentID
+	}
+
+	client := gs.dbClient.GetSystemClient()
+	_, _, err := client.From("series").Insert(record, false, "", "", "").Execute()
+	if err != nil {
+		gs.logc(sr.logCtx(), "[ERROR] Failed to store series record %s: %v", sr.ID, err)
+		return
+	}
+
+	gs.logc(sr.logCtx(), "[SUCCESS] Series record stored: id=%s, score=%d-%d", sr.ID, sr.Wins[0], sr.Wins[1])
+}
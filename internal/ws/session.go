@@ -0,0 +1,163 @@
+package ws
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SessionHeader carries the session token from WELCOME on HTTP requests made by a subscriber
+const SessionHeader = "X-Session-Token"
+
+// session lets a client reclaim its subscriber ID after a dropped connection
+// The token is sent in WELCOME. Reconnecting with /ws/subscribe?session=<token>
+// within the reconnect window resumes the same ID, and with it any match in progress
+// HTTP requests made as the subscriber send the token in SessionHeader
+type session struct {
+	id             int
+	disconnectedAt time.Time // Zero while connected
+}
+
+// newSessionToken returns an unguessable session token
+func newSessionToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// createSession issues a new session token for a subscriber
+func (gs *GameServer) createSession(id int) string {
+	token := newSessionToken()
+
+	gs.sessionsMutex.Lock()
+	defer gs.sessionsMutex.Unlock()
+	gs.sessions[token] = &session{id: id}
+
+	return token
+}
+
+// resumeSession returns the subscriber ID for a token if it can be resumed
+// Only sessions whose connection dropped within the reconnect window can be resumed
+func (gs *GameServer) resumeSession(token string) (int, bool) {
+	if token == "" {
+		return 0, false
+	}
+
+	gs.sessionsMutex.Lock()
+	defer gs.sessionsMutex.Unlock()
+
+	sess, ok := gs.sessions[token]
+	if !ok || sess.disconnectedAt.IsZero() {
+		return 0, false
+	}
+	if gs.clock.Since(sess.disconnectedAt) > gs.reconnectWindow {
+		delete(gs.sessions, token)
+		return 0, false
+	}
+
+	sess.disconnectedAt = time.Time{}
+	return sess.id, true
+}
+
+// closeSession starts the reconnect window for a session
+func (gs *GameServer) closeSession(token string) {
+	gs.sessionsMutex.Lock()
+	defer gs.sessionsMutex.Unlock()
+
+	if sess, ok := gs.sessions[token]; ok {
+		sess.disconnectedAt = gs.clock.Now()
+	}
+}
+
+// revokeSessions drops every session for a subscriber ID so it can't be resumed
+func (gs *GameServer) revokeSessions(id int) {
+	gs.sessionsMutex.Lock()
+	defer gs.sessionsMutex.Unlock()
+
+	for token, sess := range gs.sessions {
+		if sess.id == id {
+			delete(gs.sessions, token)
+		}
+	}
+}
+
+// expireSessions drops sessions that can no longer be resumed
+func (gs *GameServer) expireSessions() {
+	gs.sessionsMutex.Lock()
+	defer gs.sessionsMutex.Unlock()
+
+	for token, sess := range gs.sessions {
+		if !sess.disconnectedAt.IsZero() && gs.clock.Since(sess.disconnectedAt) > gs.reconnectWindow {
+			delete(gs.sessions, token)
+		}
+	}
+}
+
+// sessionID returns the subscriber ID for the token of a connected session
+func (gs *GameServer) sessionID(token string) (int, bool) {
+	gs.sessionsMutex.Lock()
+	defer gs.sessionsMutex.Unlock()
+
+	sess, ok := gs.sessions[token]
+	if !ok || !sess.disconnectedAt.IsZero() {
+		return 0, false
+	}
+	return sess.id, true
+}
+
+// authorize checks a request acting for subscriber userID was made by them
+// The caller is identified by their session token, or by an access token for
+// the account their connection authenticated as
+// Writes 401 if the caller can't be identified and 403 if they aren't userID
+func (gs *GameServer) authorize(w http.ResponseWriter, r *http.Request, userID int) (*Subscriber, bool) {
+	if token := r.Header.Get(SessionHeader); token != "" {
+		id, ok := gs.sessionID(token)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return nil, false
+		}
+		if id != userID {
+			http.Error(w, "user_id does not match the caller", http.StatusForbidden)
+			return nil, false
+		}
+		s := gs.GetSubscriber(id)
+		if s == nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return nil, false
+		}
+		return s, true
+	}
+
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		user, err := gs.authClient.Authenticate(r.Context(), token)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return nil, false
+		}
+		s := gs.GetSubscriber(userID)
+		if s == nil || s.account != user.ID {
+			http.Error(w, "user_id does not match the caller", http.StatusForbidden)
+			return nil, false
+		}
+		return s, true
+	}
+
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	return nil, false
+}
+
+// authorizeAccount is authorize for requests that need a signed in user, like
+// anything stored against their account. Guests get a 403
+func (gs *GameServer) authorizeAccount(w http.ResponseWriter, r *http.Request, userID int) (*Subscriber, bool) {
+	s, ok := gs.authorize(w, r, userID)
+	if !ok {
+		return nil, false
+	}
+	if s.account == "" {
+		http.Error(w, "Sign in to do this", http.StatusForbidden)
+		return nil, false
+	}
+	return s, true
+}
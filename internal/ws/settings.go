@@ -0,0 +1,189 @@
+package ws
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"slices"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/vindennt/akasha-showdown-engine/internal/chatfilter"
+	"github.com/vindennt/akasha-showdown-engine/internal/config"
+)
+
+// Settings are the knobs that can be changed while the server runs, through
+// /admin/settings/update or by editing the config file and sending SIGHUP
+// The message buffer only applies to subscribers that connect after a change
+type Settings struct {
+	MessageBuffer     int      `json:"message_buffer"`
+	PublishIntervalMS int64    `json:"publish_interval_ms"`
+	PublishBurst      int      `json:"publish_burst"`
+	MatchmakingWindow int      `json:"matchmaking_window"`
+	ChatMaxLength     int      `json:"chat_max_length"`
+	ChatBlockedWords  []string `json:"chat_blocked_words"`
+	ChatCensorWords   bool     `json:"chat_censor_words"`
+	ChatBlockLinks    bool     `json:"chat_block_links"`
+	ChatSpamMessages  int      `json:"chat_spam_messages"`
+	ChatSpamRepeats   int      `json:"chat_spam_repeats"`
+	ChatSpamWindowMS  int64    `json:"chat_spam_window_ms"`
+}
+
+// liveSettings are the settings in force with the components built from them
+// Swapped as a whole, so readers never see half of a change
+type liveSettings struct {
+	Settings
+	chatFilter     *chatfilter.Pipeline
+	spamDetector   *chatfilter.SpamDetector // Checked by chatFilter
+	publishLimiter *rate.Limiter
+}
+
+// SettingsFrom takes the runtime settings out of a config
+func SettingsFrom(cfg *config.Config) Settings {
+	return Settings{
+		MessageBuffer:     cfg.WSMessageBuffer,
+		PublishIntervalMS: cfg.PublishInterval.Milliseconds(),
+		PublishBurst:      cfg.PublishBurst,
+		MatchmakingWindow: cfg.MatchmakingWindow,
+		ChatMaxLength:     cfg.ChatMaxLength,
+		ChatBlockedWords:  cfg.ChatBlockedWords,
+		ChatCensorWords:   cfg.ChatCensorWords,
+		ChatBlockLinks:    cfg.ChatBlockLinks,
+		ChatSpamMessages:  cfg.ChatSpamMessages,
+		ChatSpamRepeats:   cfg.ChatSpamRepeats,
+		ChatSpamWindowMS:  cfg.ChatSpamWindow.Milliseconds(),
+	}
+}
+
+// validate reports every setting out of range, named by its JSON key
+func (s Settings) validate() error {
+	var errs []error
+	atLeast := func(n int64, least int64, key string) {
+		if n < least {
+			errs = append(errs, fmt.Errorf("%s=%d must be at least %d", key, n, least))
+		}
+	}
+
+	atLeast(int64(s.MessageBuffer), 1, "message_buffer")
+	atLeast(s.PublishIntervalMS, 1, "publish_interval_ms")
+	atLeast(int64(s.PublishBurst), 1, "publish_burst")
+	atLeast(int64(s.MatchmakingWindow), 1, "matchmaking_window")
+	atLeast(int64(s.ChatMaxLength), 1, "chat_max_length")
+	atLeast(int64(s.ChatSpamMessages), 0, "chat_spam_messages")
+	atLeast(int64(s.ChatSpamRepeats), 0, "chat_spam_repeats")
+	if s.ChatSpamMessages > 0 || s.ChatSpamRepeats > 0 {
+		atLeast(s.ChatSpamWindowMS, 1, "chat_spam_window_ms")
+	}
+	return errors.Join(errs...)
+}
+
+// Settings returns the settings in force
+func (gs *GameServer) Settings() Settings {
+	return gs.settings.Load().Settings
+}
+
+// ApplySettings validates s and puts it in force, logging every value that changed
+// source says where the change came from, e.g. "SIGHUP" or the admin's user ID
+// Invalid settings leave the current ones in force
+func (gs *GameServer) ApplySettings(s Settings, source string) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+
+	gs.settingsMutex.Lock()
+	old := gs.settings.Load().Settings
+	gs.storeSettingsLocked(s)
+	gs.settingsMutex.Unlock()
+
+	changed := 0
+	oldValue, newValue := reflect.ValueOf(old), reflect.ValueOf(s)
+	for i := 0; i < oldValue.NumField(); i++ {
+		before, after := oldValue.Field(i).Interface(), newValue.Field(i).Interface()
+		if reflect.DeepEqual(before, after) {
+			continue
+		}
+		changed++
+		gs.logf("[SETTINGS] %s changed from %v to %v by %s", settingKey(oldValue.Type().Field(i)), before, after, source)
+	}
+	if changed == 0 {
+		gs.logf("[SETTINGS] Settings from %s unchanged", source)
+	}
+	return nil
+}
+
+// storeSettingsLocked builds the components for s and swaps them in together
+// Chat senders' spam history carries over, and the publish limiter is only
+// replaced, starting with a full burst, if its rate changed
+// Caller must hold settingsMutex, or be the constructor
+func (gs *GameServer) storeSettingsLocked(s Settings) {
+	spamWindow := time.Duration(s.ChatSpamWindowMS) * time.Millisecond
+	limit := rate.Every(time.Duration(s.PublishIntervalMS) * time.Millisecond)
+
+	live := &liveSettings{Settings: s}
+	if old := gs.settings.Load(); old != nil {
+		live.spamDetector = old.spamDetector.WithLimits(s.ChatSpamMessages, s.ChatSpamRepeats, spamWindow)
+		if old.publishLimiter.Limit() == limit && old.publishLimiter.Burst() == s.PublishBurst {
+			live.publishLimiter = old.publishLimiter
+		}
+	} else {
+		live.spamDetector = chatfilter.NewSpamDetector(s.ChatSpamMessages, s.ChatSpamRepeats, spamWindow)
+	}
+	if live.publishLimiter == nil {
+		live.publishLimiter = rate.NewLimiter(limit, s.PublishBurst)
+	}
+	live.chatFilter = newChatFilter(s.ChatMaxLength, s.ChatBlockedWords, s.ChatCensorWords, s.ChatBlockLinks, live.spamDetector)
+
+	gs.settings.Store(live)
+}
+
+// settingKey is a Settings field's JSON key
+func settingKey(field reflect.StructField) string {
+	if tag := field.Tag.Get("json"); tag != "" {
+		return tag
+	}
+	return field.Name
+}
+
+// handles admins reading the runtime settings
+func (gs *GameServer) settingsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(gs.Settings())
+}
+
+// handles admins changing runtime settings
+// Only the fields given are changed, and unknown fields are rejected so typos don't go unnoticed
+func (gs *GameServer) updateSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// Cloned so decoding doesn't write into the blocked words in force
+	settings := gs.Settings()
+	settings.ChatBlockedWords = slices.Clone(settings.ChatBlockedWords)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&settings); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	if err := gs.ApplySettings(settings, "admin "+actorID(r)); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(gs.Settings())
+}
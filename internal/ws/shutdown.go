@@ -0,0 +1,169 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// How often draining checks whether matches and writes have finished
+const drainPollInterval = time.Millisecond * 250
+
+// Shown to clients when the server is shutting down, and the reason
+// challenges and rematches are cancelled with
+const (
+	shutdownReason = "Server is shutting down"
+	shutdownCancel = "shutdown"
+)
+
+// Draining reports whether the server is shutting down
+// New queues, challenges, rematches and tournament matches are refused while draining
+func (gs *GameServer) Draining() bool {
+	return gs.shutdownNotice.Load() != nil
+}
+
+// rejectDraining responds 503 if the server is shutting down, and reports whether it did
+func (gs *GameServer) rejectDraining(w http.ResponseWriter) bool {
+	if !gs.Draining() {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(gs.reconnectDelay.Seconds())))
+	http.Error(w, shutdownReason, http.StatusServiceUnavailable)
+	return true
+}
+
+// goWrite runs a database write in the background
+// Shutdown waits for writes started this way before the process exits
+func (gs *GameServer) goWrite(write func()) {
+	gs.pendingWrites.Add(1)
+	go func() {
+		defer gs.pendingWrites.Add(-1)
+		write()
+	}()
+}
+
+// Drain stops new matches from starting, tells every client the server is going
+// away, and waits for matches in progress to finish or ctx to be done
+// Returns how many matches were still running when it gave up
+func (gs *GameServer) Drain(ctx context.Context) int {
+	notice := ServerShutdown{
+		Type:             "SERVER_SHUTDOWN",
+		Reason:           shutdownReason,
+		ReconnectAfterMS: gs.reconnectDelay.Milliseconds(),
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		notice.Deadline = deadline.UnixMilli()
+	}
+	if !gs.shutdownNotice.CompareAndSwap(nil, &notice) {
+		return gs.matchesInProgress()
+	}
+
+	gs.logf("[SHUTDOWN] Draining, %d matches in progress", gs.matchesInProgress())
+
+	// Queued players would never be matched, so send them back to the lobby
+	gs.queueMutex.Lock()
+	queued := gs.matchmakingQueue
+	gs.matchmakingQueue = nil
+	gs.queueMutex.Unlock()
+	for _, e := range queued {
+		gs.setPresence(e.UserID, PresenceOnline)
+	}
+
+	gs.challengesMutex.Lock()
+	ids := make([]string, 0, len(gs.challenges))
+	for id := range gs.challenges {
+		ids = append(ids, id)
+	}
+	gs.challengesMutex.Unlock()
+	for _, id := range ids {
+		gs.cancelChallenge(id, shutdownCancel)
+	}
+
+	gs.rematchesMutex.Lock()
+	for _, r := range gs.rematches {
+		select {
+		case r.decided <- shutdownCancel:
+		default:
+		}
+	}
+	gs.rematchesMutex.Unlock()
+
+	msg, _ := json.Marshal(notice)
+	gs.publish(msg)
+
+	ticker := gs.clock.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		remaining := gs.matchesInProgress()
+		if remaining == 0 {
+			gs.logf("[SHUTDOWN] All matches finished")
+			return 0
+		}
+
+		select {
+		case <-ticker.C():
+		case <-ctx.Done():
+			gs.logf("[WARN] Drain deadline reached with %d matches in progress", remaining)
+			return remaining
+		}
+	}
+}
+
+// Close snapshots matches still in progress, waits for pending database
+// writes, then disconnects every client. Call it after Drain
+// Gives up on writes that haven't finished when ctx is done
+func (gs *GameServer) Close(ctx context.Context) {
+	running := gs.matchesInProgress()
+	if gs.snapshots == nil && running > 0 {
+		gs.logf("[WARN] Snapshots are disabled, %d matches in progress will be lost", running)
+	}
+	if err := gs.saveSnapshot(ctx); err != nil {
+		gs.logf("[ERROR] Failed to save snapshot: %v", err)
+	} else if gs.snapshots != nil {
+		gs.logf("[SHUTDOWN] Saved snapshot with %d matches in progress", running)
+	}
+
+	gs.waitForWrites(ctx)
+
+	gs.globalLobby.mutex.Lock()
+	subscribers := make([]*Subscriber, 0, len(gs.globalLobby.subscribers))
+	for _, s := range gs.globalLobby.subscribers {
+		subscribers = append(subscribers, s)
+	}
+	gs.globalLobby.mutex.Unlock()
+
+	for _, s := range subscribers {
+		if s.goAway != nil {
+			s.goAway(shutdownReason)
+		}
+	}
+	gs.logf("[SHUTDOWN] Disconnected %d subscribers", len(subscribers))
+}
+
+// waitForWrites blocks until background writes finish or ctx is done
+func (gs *GameServer) waitForWrites(ctx context.Context) {
+	ticker := gs.clock.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		pending := gs.pendingWrites.Load()
+		if pending == 0 {
+			return
+		}
+
+		select {
+		case <-ticker.C():
+		case <-ctx.Done():
+			gs.logf("[ERROR] Shutting down with %d database writes unfinished", pending)
+			return
+		}
+	}
+}
+
+// matchesInProgress returns how many matches are being played
+func (gs *GameServer) matchesInProgress() int {
+	gs.matchesMutex.Lock()
+	defer gs.matchesMutex.Unlock()
+	return len(gs.matches)
+}
@@ -0,0 +1,500 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/vindennt/akasha-showdown-engine/internal/game"
+	"github.com/vindennt/akasha-showdown-engine/internal/snapshot"
+	"github.com/vindennt/akasha-showdown-engine/internal/tournament"
+	"github.com/vindennt/akasha-showdown-engine/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Bump when the snapshot format changes. Snapshots of another version are ignored
+const snapshotVersion = 1
+
+// serverSnapshot is the state a restarted server needs to pick up where the last one left off
+// Ratings, chat, social and bans are already stored as they change, so aren't included
+type serverSnapshot struct {
+	Version          int                  `json:"v"`
+	TakenAt          time.Time            `json:"taken_at"`
+	NextSubscriberID int                  `json:"next_subscriber_id"`
+	Lobbies          []lobbySnapshot      `json:"lobbies"`
+	Queue            []queueEntry         `json:"queue"`
+	Sessions         []sessionSnapshot    `json:"sessions"`
+	Matches          []matchSnapshot      `json:"matches"`
+	Tournaments      []tournamentSnapshot `json:"tournaments"`
+}
+
+// Subscribers are connections, so lobbies are restored empty and fill as players reconnect
+type lobbySnapshot struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type sessionSnapshot struct {
+	Token string `json:"token"`
+	ID    int    `json:"id"`
+}
+
+// matchSnapshot is a match in progress and the series it belongs to
+// The replay's seed and commands rebuild the engine
+type matchSnapshot struct {
+	ID          string           `json:"id"`
+	Game        int              `json:"game"`
+	Players     [2]int           `json:"players"`
+	StartedAt   time.Time        `json:"started_at"`
+	Clocks      [2]time.Duration `json:"clocks_ns"`
+	TurnElapsed time.Duration    `json:"turn_elapsed_ns"` // Not yet charged to the active player
+	Replay      Replay           `json:"replay"`
+	Series      seriesSnapshot   `json:"series"`
+}
+
+type seriesSnapshot struct {
+	ID        string    `json:"id"`
+	Mode      string    `json:"mode"`
+	BestOf    int       `json:"best_of"`
+	Ranked    bool      `json:"ranked"`
+	Players   [2]int    `json:"players"`
+	Accounts  [2]string `json:"accounts"`
+	Wins      [2]int    `json:"wins"`
+	MatchIDs  []string  `json:"match_ids"`
+	Bans      []string  `json:"bans"`
+	StartedAt time.Time `json:"started_at"`
+
+	TournamentID   string `json:"tournament_id,omitempty"`
+	BracketMatchID string `json:"bracket_match_id,omitempty"`
+}
+
+// tournamentSnapshot is a tournament that hasn't finished
+// Its bracket is rebuilt by replaying the reported results onto the seeded entrants
+type tournamentSnapshot struct {
+	ID          string               `json:"id"`
+	Name        string               `json:"name"`
+	Format      string               `json:"format"`
+	Mode        string               `json:"mode"`
+	BestOf      int                  `json:"best_of"`
+	Ranked      bool                 `json:"ranked"`
+	SwissRounds int                  `json:"swiss_rounds"`
+	OrganizerID int                  `json:"organizer_id"`
+	MaxPlayers  int                  `json:"max_players"`
+	CreatedAt   time.Time            `json:"created_at"`
+	Status      string               `json:"status"`
+	Registered  []int                `json:"registered"`
+	CheckedIn   []int                `json:"checked_in"`
+	Ready       map[string][]int     `json:"ready"`
+	Notified    []string             `json:"notified"`
+	Entrants    []tournament.Entrant `json:"entrants"`
+	Results     []bracketResult      `json:"results"`
+}
+
+// takeSnapshot captures lobbies, the queue, sessions, matches in progress and unfinished tournaments
+// Series between games have no match in progress, so aren't carried over
+func (gs *GameServer) takeSnapshot() serverSnapshot {
+	now := gs.clock.Now()
+	snap := serverSnapshot{
+		Version: snapshotVersion,
+		TakenAt: now,
+	}
+
+	nextSubscriberIDMu.Lock()
+	snap.NextSubscriberID = nextSubscriberID
+	nextSubscriberIDMu.Unlock()
+
+	gs.lobbiesMutex.Lock()
+	for _, lobby := range gs.lobbies {
+		if lobby != gs.globalLobby {
+			snap.Lobbies = append(snap.Lobbies, lobbySnapshot{ID: lobby.ID, Name: lobby.Name})
+		}
+	}
+	gs.lobbiesMutex.Unlock()
+
+	gs.queueMutex.Lock()
+	snap.Queue = append([]queueEntry(nil), gs.matchmakingQueue...)
+	gs.queueMutex.Unlock()
+
+	gs.sessionsMutex.Lock()
+	for token, sess := range gs.sessions {
+		snap.Sessions = append(snap.Sessions, sessionSnapshot{Token: token, ID: sess.id})
+	}
+	gs.sessionsMutex.Unlock()
+
+	gs.matchesMutex.Lock()
+	running := make([]*Match, 0, len(gs.matches))
+	for _, m := range gs.matches {
+		running = append(running, m)
+	}
+	gs.matchesMutex.Unlock()
+
+	for _, m := range running {
+		if m.series == nil {
+			continue
+		}
+
+		// The series only changes between games, so it's stable while its match runs
+		m.mutex.Lock()
+		if m.finished {
+			m.mutex.Unlock()
+			continue
+		}
+		sr := m.series
+		ms := matchSnapshot{
+			ID:          m.ID,
+			Game:        m.Game,
+			Players:     m.Players,
+			StartedAt:   m.StartedAt,
+			Clocks:      m.clocks,
+			TurnElapsed: now.Sub(m.turnStarted),
+			Replay:      m.replay,
+			Series: seriesSnapshot{
+				ID:        sr.ID,
+				Mode:      sr.Mode,
+				BestOf:    sr.BestOf,
+				Ranked:    sr.Ranked,
+				Players:   sr.Players,
+				Accounts:  sr.Accounts,
+				Wins:      sr.Wins,
+				MatchIDs:  append([]string(nil), sr.MatchIDs...),
+				Bans:      append([]string(nil), sr.Bans...),
+				StartedAt: sr.StartedAt,
+
+				TournamentID:   sr.TournamentID,
+				BracketMatchID: sr.BracketMatchID,
+			},
+		}
+		ms.Replay.Events = append([]ReplayEvent(nil), m.replay.Events...)
+		m.mutex.Unlock()
+
+		snap.Matches = append(snap.Matches, ms)
+	}
+
+	gs.tournamentsMutex.Lock()
+	tournaments := make([]*Tournament, 0, len(gs.tournaments))
+	for _, t := range gs.tournaments {
+		tournaments = append(tournaments, t)
+	}
+	gs.tournamentsMutex.Unlock()
+
+	for _, t := range tournaments {
+		t.mutex.Lock()
+		if t.status != TournamentFinished {
+			snap.Tournaments = append(snap.Tournaments, t.snapshotLocked())
+		}
+		t.mutex.Unlock()
+	}
+
+	return snap
+}
+
+// snapshotLocked captures the tournament for a server snapshot
+// Caller must hold t.mutex
+func (t *Tournament) snapshotLocked() tournamentSnapshot {
+	ts := tournamentSnapshot{
+		ID:          t.ID,
+		Name:        t.Name,
+		Format:      t.Format,
+		Mode:        t.Series.Mode,
+		BestOf:      t.Series.BestOf,
+		Ranked:      t.Series.Ranked,
+		SwissRounds: t.SwissRounds,
+		OrganizerID: t.OrganizerID,
+		MaxPlayers:  t.MaxPlayers,
+		CreatedAt:   t.CreatedAt,
+		Status:      t.status,
+		Registered:  slices.Clone(t.registered),
+		CheckedIn:   make([]int, 0, len(t.checkedIn)),
+		Ready:       make(map[string][]int, len(t.ready)),
+		Notified:    make([]string, 0, len(t.notified)),
+		Entrants:    slices.Clone(t.entrants),
+		Results:     slices.Clone(t.results),
+	}
+	for id := range t.checkedIn {
+		ts.CheckedIn = append(ts.CheckedIn, id)
+	}
+	for id, players := range t.ready {
+		ts.Ready[id] = slices.Clone(players)
+	}
+	for id := range t.notified {
+		ts.Notified = append(ts.Notified, id)
+	}
+	return ts
+}
+
+// saveSnapshot writes the current state to the snapshot store, if there is one
+func (gs *GameServer) saveSnapshot(ctx context.Context) error {
+	if gs.snapshots == nil {
+		return nil
+	}
+
+	snap := gs.takeSnapshot()
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	if err := gs.snapshots.Save(ctx, data); err != nil {
+		return err
+	}
+
+	gs.logf("[DEBUG] Saved snapshot: %d matches, %d queued, %d sessions", len(snap.Matches), len(snap.Queue), len(snap.Sessions))
+	return nil
+}
+
+// snapshotLoop saves a snapshot every snapshotInterval, so a crash loses at most that much
+func (gs *GameServer) snapshotLoop() {
+	ticker := gs.clock.NewTicker(gs.snapshotInterval)
+	defer ticker.Stop()
+
+	for range ticker.C() {
+		ctx, cancel := context.WithTimeout(context.Background(), gs.snapshotInterval)
+		if err := gs.saveSnapshot(ctx); err != nil {
+			gs.logf("[ERROR] Failed to save snapshot: %v", err)
+		}
+		cancel()
+	}
+}
+
+// restoreSnapshot loads the last snapshot and resumes from it, before any client connects
+// Every restored session starts its reconnect window now, so players who come
+// back in time with their session token keep their ID and carry on their match
+func (gs *GameServer) restoreSnapshot(ctx context.Context) {
+	if gs.snapshots == nil {
+		return
+	}
+
+	data, err := gs.snapshots.Load(ctx)
+	if errors.Is(err, snapshot.ErrNotFound) {
+		gs.logf("[SNAPSHOT] No snapshot to restore")
+		return
+	}
+	if err != nil {
+		gs.logf("[ERROR] Failed to load snapshot: %v", err)
+		return
+	}
+
+	var snap serverSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		gs.logf("[ERROR] Failed to decode snapshot: %v", err)
+		return
+	}
+	if snap.Version != snapshotVersion {
+		gs.logf("[WARN] Ignoring snapshot version %d, expected %d", snap.Version, snapshotVersion)
+		return
+	}
+	now := gs.clock.Now()
+	if age := now.Sub(snap.TakenAt); age > gs.snapshotMaxAge {
+		gs.logf("[WARN] Ignoring snapshot taken %v ago", age.Round(time.Second))
+		return
+	}
+
+	// New subscribers must not be given an ID a restored session still holds
+	nextSubscriberIDMu.Lock()
+	nextSubscriberID = max(nextSubscriberID, snap.NextSubscriberID)
+	nextSubscriberIDMu.Unlock()
+
+	gs.lobbiesMutex.Lock()
+	for _, l := range snap.Lobbies {
+		if _, exists := gs.lobbies[l.ID]; !exists {
+			gs.lobbies[l.ID] = &Lobby{ID: l.ID, Name: l.Name, subscribers: make(map[int]*Subscriber)}
+		}
+	}
+	gs.lobbiesMutex.Unlock()
+
+	gs.sessionsMutex.Lock()
+	for _, sess := range snap.Sessions {
+		gs.sessions[sess.Token] = &session{id: sess.ID, disconnectedAt: now}
+	}
+	gs.sessionsMutex.Unlock()
+
+	gs.queueMutex.Lock()
+	gs.matchmakingQueue = append(gs.matchmakingQueue, snap.Queue...)
+	gs.queueMutex.Unlock()
+	if len(snap.Queue) > 0 {
+		go gs.pruneRestoredQueue(snap.Queue)
+	}
+
+	// Tournaments first, so their bracket matches below have a bracket to report to
+	gs.tournamentsMutex.Lock()
+	for _, ts := range snap.Tournaments {
+		t, err := restoreTournament(ts)
+		if err != nil {
+			gs.logf("[ERROR] Failed to restore tournament %s: %v", ts.ID, err)
+			continue
+		}
+		gs.tournaments[t.ID] = t
+	}
+	gs.tournamentsMutex.Unlock()
+
+	restored := 0
+	for _, ms := range snap.Matches {
+		var t *Tournament
+		if id := ms.Series.TournamentID; id != "" {
+			if t = gs.getTournament(id); t == nil {
+				gs.logf("[ERROR] Failed to restore match %s: tournament %s wasn't restored", ms.ID, id)
+				continue
+			}
+		}
+
+		sr, err := gs.restoreMatch(ms, now.Sub(snap.TakenAt))
+		if err != nil {
+			gs.logf("[ERROR] Failed to restore match %s: %v", ms.ID, err)
+			continue
+		}
+		restored++
+
+		if t == nil {
+			go gs.playSeries(sr)
+			continue
+		}
+		// The rebuilt bracket has the match ready, so mark it live again
+		t.mutex.Lock()
+		err = t.bracket.Start(sr.BracketMatchID)
+		t.mutex.Unlock()
+		if err != nil {
+			gs.logf("[WARN] Tournament %s match %s is not ready to resume: %v", t.ID, sr.BracketMatchID, err)
+		}
+		go gs.runBracketSeries(t, sr)
+	}
+
+	gs.logf("[SNAPSHOT] Restored snapshot from %s: %d sessions, %d queued, %d of %d matches, %d tournaments",
+		snap.TakenAt.Format(time.RFC3339), len(snap.Sessions), len(snap.Queue), restored, len(snap.Matches), len(snap.Tournaments))
+}
+
+// restoreTournament rebuilds a tournament from a snapshot
+// Bracket matches that were live without a game in progress go back to ready,
+// so their players ready up and play the series again
+func restoreTournament(ts tournamentSnapshot) (*Tournament, error) {
+	t := &Tournament{
+		ID:          ts.ID,
+		Name:        ts.Name,
+		Format:      ts.Format,
+		Series:      SeriesOptions{Mode: ts.Mode, BestOf: ts.BestOf, Ranked: ts.Ranked},
+		SwissRounds: ts.SwissRounds,
+		OrganizerID: ts.OrganizerID,
+		MaxPlayers:  ts.MaxPlayers,
+		CreatedAt:   ts.CreatedAt,
+		status:      ts.Status,
+		registered:  ts.Registered,
+		checkedIn:   make(map[int]bool),
+		ready:       ts.Ready,
+		seriesIDs:   make(map[string]string),
+		notified:    make(map[string]bool),
+		entrants:    ts.Entrants,
+		results:     ts.Results,
+	}
+	if t.registered == nil {
+		t.registered = make([]int, 0)
+	}
+	if t.ready == nil {
+		t.ready = make(map[string][]int)
+	}
+	for _, id := range ts.CheckedIn {
+		t.checkedIn[id] = true
+	}
+	for _, id := range ts.Notified {
+		t.notified[id] = true
+	}
+
+	if t.status != TournamentRunning {
+		return t, nil
+	}
+	bracket, err := tournament.New(t.Format, t.entrants, t.SwissRounds)
+	if err != nil {
+		return nil, err
+	}
+	for _, res := range t.results {
+		if err := bracket.Report(res.MatchID, res.WinnerID); err != nil {
+			return nil, fmt.Errorf("replaying %s: %w", res.MatchID, err)
+		}
+	}
+	t.bracket = bracket
+	return t, nil
+}
+
+// pruneRestoredQueue waits out the reconnect window, then drops restored queue
+// entries for players who didn't resume their session so they aren't matched
+func (gs *GameServer) pruneRestoredQueue(restored []queueEntry) {
+	<-gs.clock.After(gs.reconnectWindow)
+
+	dropped := 0
+	for _, e := range restored {
+		if gs.GetSubscriber(e.UserID) == nil && gs.leaveQueue(e.UserID) {
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		gs.logf("[SNAPSHOT] Dropped %d restored queue entries that weren't resumed", dropped)
+	}
+}
+
+// restoreMatch rebuilds a match and its series from a snapshot and registers the match
+// Both players start out absent. Time the server was down isn't charged to either clock,
+// and the active player gets a fresh turn
+func (gs *GameServer) restoreMatch(ms matchSnapshot, downtime time.Duration) (*Series, error) {
+	sr := &Series{
+		ID:        ms.Series.ID,
+		Mode:      ms.Series.Mode,
+		BestOf:    ms.Series.BestOf,
+		Ranked:    ms.Series.Ranked,
+		Players:   ms.Series.Players,
+		Accounts:  ms.Series.Accounts,
+		Wins:      ms.Series.Wins,
+		MatchIDs:  ms.Series.MatchIDs,
+		Bans:      ms.Series.Bans,
+		StartedAt: ms.Series.StartedAt.Add(downtime),
+
+		TournamentID:   ms.Series.TournamentID,
+		BracketMatchID: ms.Series.BracketMatchID,
+	}
+
+	// The match's original trace ended with the old process, so it starts a new one
+	ctx, span := tracing.Start(context.Background(), "match", trace.WithAttributes(
+		attribute.String("match.id", ms.ID),
+		attribute.String("match.mode", sr.Mode),
+		attribute.Int("match.game", ms.Game),
+		attribute.IntSlice("match.players", ms.Players[:]),
+		attribute.Bool("match.restored", true),
+	))
+
+	m, err := gs.buildMatch(ctx, ms.ID, sr.Mode, ms.Players, ms.Replay.Seed, ms.Replay.Options, ms.StartedAt.Add(downtime))
+	if err != nil {
+		tracing.End(span, err)
+		return nil, err
+	}
+	for i, event := range ms.Replay.Events {
+		if err := m.engine.Apply(game.Command{PlayerID: event.PlayerID, Action: event.Action}); err != nil {
+			err = fmt.Errorf("replay diverged at event %d: %w", i, err)
+			tracing.End(span, err)
+			return nil, err
+		}
+	}
+	if m.engine.Finished() {
+		err := errors.New("match already finished")
+		tracing.End(span, err)
+		return nil, err
+	}
+
+	now := gs.clock.Now()
+	m.SeriesID = sr.ID
+	m.series = sr
+	m.Game = ms.Game
+	m.Ranked = sr.Ranked
+	m.replay = ms.Replay
+	m.clocks = ms.Clocks
+	if i := m.playerIndex(m.engine.Active()); i >= 0 && gs.timeControl.Base > 0 {
+		m.clocks[i] -= ms.TurnElapsed
+	}
+	m.turnStarted = now
+	m.absentSince = [2]time.Time{now, now}
+	sr.resumed = m
+
+	gs.registerMatch(m)
+	gs.logc(m.logCtx(), "[SNAPSHOT] Restored match %s at event %d", m.ID, len(ms.Replay.Events))
+
+	return sr, nil
+}
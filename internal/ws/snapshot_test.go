@@ -0,0 +1,72 @@
+package ws
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/vindennt/akasha-showdown-engine/internal/tournament"
+)
+
+func TestRestoreTournament(t *testing.T) {
+	entrants := tournament.Seed([]tournament.Entrant{
+		{UserID: 1, Rating: 1800},
+		{UserID: 2, Rating: 1700},
+		{UserID: 3, Rating: 1600},
+		{UserID: 4, Rating: 1500},
+	})
+	bracket, err := tournament.New(tournament.SingleElimination, entrants, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := &Tournament{
+		ID:         "t1",
+		Format:     tournament.SingleElimination,
+		status:     TournamentRunning,
+		registered: []int{1, 2, 3, 4},
+		checkedIn:  map[int]bool{1: true, 2: true, 3: true, 4: true},
+		bracket:    bracket,
+		ready:      map[string][]int{"W1-2": {2}},
+		seriesIDs:  make(map[string]string),
+		notified:   map[string]bool{"W1-1": true, "W1-2": true},
+		entrants:   entrants,
+	}
+	if err := bracket.Report("W1-1", 4); err != nil {
+		t.Fatal(err)
+	}
+	orig.results = append(orig.results, bracketResult{MatchID: "W1-1", WinnerID: 4})
+
+	// Goes through JSON like a saved snapshot does
+	data, err := json.Marshal(orig.snapshotLocked())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ts tournamentSnapshot
+	if err := json.Unmarshal(data, &ts); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := restoreTournament(ts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(restored.bracket.Matches(), orig.bracket.Matches()) {
+		t.Errorf("bracket = %+v, want %+v", restored.bracket.Matches(), orig.bracket.Matches())
+	}
+	if !slices.Equal(restored.ready["W1-2"], []int{2}) || !restored.notified["W1-2"] || len(restored.checkedIn) != 4 {
+		t.Errorf("ready %v, notified %v, checked in %v not carried over", restored.ready, restored.notified, restored.checkedIn)
+	}
+}
+
+func TestRestoreTournamentBadResult(t *testing.T) {
+	ts := tournamentSnapshot{
+		ID:       "t1",
+		Format:   tournament.SingleElimination,
+		Status:   TournamentRunning,
+		Entrants: tournament.Seed([]tournament.Entrant{{UserID: 1}, {UserID: 2}}),
+		Results:  []bracketResult{{MatchID: "W1-1", WinnerID: 3}},
+	}
+	if _, err := restoreTournament(ts); err == nil {
+		t.Error("restoreTournament() with a winner not in the match = nil error, want one")
+	}
+}
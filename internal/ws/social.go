@@ -0,0 +1,487 @@
+package ws
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Friendships, pending friend requests and blocks between Supabase accounts
+// Subscriber IDs change on every connection, so the social graph is only for
+// signed in users. Each relation is kept in memory for lookups on every chat
+// message and written through to Supabase so it survives restarts
+//
+// A block hides the blocked user's lobby chat from the blocker and stops
+// friend requests, direct messages and challenges in either direction
+
+// link adds b to a's set
+func link(m map[string]map[string]bool, a, b string) {
+	if m[a] == nil {
+		m[a] = make(map[string]bool)
+	}
+	m[a][b] = true
+}
+
+// unlink removes b from a's set, reporting whether it was there
+func unlink(m map[string]map[string]bool, a, b string) bool {
+	if !m[a][b] {
+		return false
+	}
+	delete(m[a], b)
+	if len(m[a]) == 0 {
+		delete(m, a)
+	}
+	return true
+}
+
+// sortedAccounts returns a set's accounts in order, never nil so it encodes as []
+func sortedAccounts(set map[string]bool) []string {
+	accounts := make([]string, 0, len(set))
+	for account := range set {
+		accounts = append(accounts, account)
+	}
+	slices.Sort(accounts)
+	return accounts
+}
+
+// hasBlocked reports whether blocker has blocked target
+// Guests have no account, so never block or are blocked
+func (gs *GameServer) hasBlocked(blocker, target string) bool {
+	if blocker == "" || target == "" {
+		return false
+	}
+	gs.socialMutex.Lock()
+	defer gs.socialMutex.Unlock()
+	return gs.blocks[blocker][target]
+}
+
+// blockedEither reports whether either account has blocked the other
+func (gs *GameServer) blockedEither(a, b string) bool {
+	return gs.hasBlocked(a, b) || gs.hasBlocked(b, a)
+}
+
+// accountOf returns the account a subscriber signed in as, empty for guests and offline users
+func (gs *GameServer) accountOf(id int) string {
+	if s := gs.GetSubscriber(id); s != nil {
+		return s.account
+	}
+	return ""
+}
+
+// presenceOf returns a user's presence, offline if they aren't connected
+func (gs *GameServer) presenceOf(id int) PresenceState {
+	if s := gs.GetSubscriber(id); s != nil {
+		return s.Presence()
+	}
+	return PresenceOffline
+}
+
+// accountPresence returns the presence of an account's most recently active connection,
+// offline if it has none
+func (gs *GameServer) accountPresence(account string) PresenceState {
+	gs.globalLobby.mutex.Lock()
+	defer gs.globalLobby.mutex.Unlock()
+
+	var latest *Subscriber
+	for _, s := range gs.globalLobby.subscribers {
+		if s.account == account && (latest == nil || s.LastActive().After(latest.LastActive())) {
+			latest = s
+		}
+	}
+	if latest == nil {
+		return PresenceOffline
+	}
+	return latest.Presence()
+}
+
+// sendFriendEvent tells an account about a change to their friends
+func (gs *GameServer) sendFriendEvent(to string, msgType string, other string) {
+	event := FriendEvent{
+		Type:      msgType,
+		AccountID: other,
+	}
+	if msgType == "FRIEND_ADDED" {
+		event.State = gs.accountPresence(other)
+	}
+	msg, _ := json.Marshal(event)
+	gs.sendToAccount(to, msg)
+}
+
+type socialRequest struct {
+	UserID   int    `json:"user_id"`
+	TargetID string `json:"target_id"` // Account ID
+	Accept   bool   `json:"accept"`    // Friend responses only
+	Unblock  bool   `json:"unblock"`   // Blocks only
+}
+
+// readSocialRequest reads the body shared by the friend and block endpoints
+// and returns it with the caller's account
+// Writes the error response and returns false if the request is invalid
+func (gs *GameServer) readSocialRequest(w http.ResponseWriter, r *http.Request) (socialRequest, string, bool) {
+	var req socialRequest
+
+	if r.Method != "POST" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return req, "", false
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return req, "", false
+	}
+
+	if err := json.Unmarshal(data, &req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return req, "", false
+	}
+
+	s, ok := gs.authorizeAccount(w, r, req.UserID)
+	if !ok {
+		return req, "", false
+	}
+	if uuid.Validate(req.TargetID) != nil {
+		http.Error(w, "target_id must be an account ID", http.StatusBadRequest)
+		return req, "", false
+	}
+	if s.account == req.TargetID {
+		http.Error(w, "Cannot target yourself", http.StatusBadRequest)
+		return req, "", false
+	}
+
+	return req, s.account, true
+}
+
+// handles sending a friend request
+// If the target already sent one to the user, they become friends straight away
+func (gs *GameServer) friendRequestHandler(w http.ResponseWriter, r *http.Request) {
+	req, account, ok := gs.readSocialRequest(w, r)
+	if !ok {
+		return
+	}
+
+	gs.socialMutex.Lock()
+	switch {
+	case gs.blocks[account][req.TargetID] || gs.blocks[req.TargetID][account]:
+		gs.socialMutex.Unlock()
+		http.Error(w, "Cannot send a friend request to this user", http.StatusForbidden)
+		return
+	case gs.friends[account][req.TargetID]:
+		gs.socialMutex.Unlock()
+		http.Error(w, "Already friends", http.StatusConflict)
+		return
+	case gs.friendRequests[req.TargetID][account]:
+		gs.socialMutex.Unlock()
+		http.Error(w, "Friend request already sent", http.StatusConflict)
+		return
+	}
+
+	mutual := gs.friendRequests[account][req.TargetID]
+	if mutual {
+		gs.addFriendsLocked(account, req.TargetID)
+	} else {
+		link(gs.friendRequests, req.TargetID, account)
+		link(gs.sentRequests, account, req.TargetID)
+	}
+	gs.socialMutex.Unlock()
+
+	if mutual {
+		gs.logc(r.Context(), "[SOCIAL] Accounts %s and %s are now friends", account, req.TargetID)
+		gs.goWrite(func() { gs.deleteFriendRequest(req.TargetID, account) })
+		gs.goWrite(func() { gs.storeFriendship(account, req.TargetID) })
+		gs.sendFriendEvent(account, "FRIEND_ADDED", req.TargetID)
+		gs.sendFriendEvent(req.TargetID, "FRIEND_ADDED", account)
+	} else {
+		gs.logc(r.Context(), "[SOCIAL] Account %s sent a friend request to account %s", account, req.TargetID)
+		gs.goWrite(func() { gs.storeFriendRequest(account, req.TargetID) })
+		gs.sendFriendEvent(req.TargetID, "FRIEND_REQUEST", account)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// addFriendsLocked makes two users friends and clears requests between them
+// Caller must hold socialMutex
+func (gs *GameServer) addFriendsLocked(a, b string) {
+	unlink(gs.friendRequests, a, b)
+	unlink(gs.friendRequests, b, a)
+	unlink(gs.sentRequests, a, b)
+	unlink(gs.sentRequests, b, a)
+	link(gs.friends, a, b)
+	link(gs.friends, b, a)
+}
+
+// handles accepting or declining a friend request
+// The requester is only told when the request is accepted
+func (gs *GameServer) friendRespondHandler(w http.ResponseWriter, r *http.Request) {
+	req, account, ok := gs.readSocialRequest(w, r)
+	if !ok {
+		return
+	}
+
+	gs.socialMutex.Lock()
+	if !gs.friendRequests[account][req.TargetID] {
+		gs.socialMutex.Unlock()
+		http.Error(w, "Friend request not found", http.StatusNotFound)
+		return
+	}
+	if req.Accept {
+		gs.addFriendsLocked(account, req.TargetID)
+	} else {
+		unlink(gs.friendRequests, account, req.TargetID)
+		unlink(gs.sentRequests, req.TargetID, account)
+	}
+	gs.socialMutex.Unlock()
+
+	gs.goWrite(func() { gs.deleteFriendRequest(req.TargetID, account) })
+
+	if req.Accept {
+		gs.logc(r.Context(), "[SOCIAL] Accounts %s and %s are now friends", account, req.TargetID)
+		gs.goWrite(func() { gs.storeFriendship(account, req.TargetID) })
+		gs.sendFriendEvent(account, "FRIEND_ADDED", req.TargetID)
+		gs.sendFriendEvent(req.TargetID, "FRIEND_ADDED", account)
+	} else {
+		gs.logc(r.Context(), "[SOCIAL] Account %s declined a friend request from account %s", account, req.TargetID)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handles removing a friend, or cancelling a friend request the user sent
+func (gs *GameServer) friendRemoveHandler(w http.ResponseWriter, r *http.Request) {
+	req, account, ok := gs.readSocialRequest(w, r)
+	if !ok {
+		return
+	}
+
+	gs.socialMutex.Lock()
+	removed := unlink(gs.friends, account, req.TargetID)
+	unlink(gs.friends, req.TargetID, account)
+	cancelled := unlink(gs.sentRequests, account, req.TargetID)
+	unlink(gs.friendRequests, req.TargetID, account)
+	gs.socialMutex.Unlock()
+
+	switch {
+	case removed:
+		gs.logc(r.Context(), "[SOCIAL] Accounts %s and %s are no longer friends", account, req.TargetID)
+		gs.goWrite(func() { gs.deleteFriendship(account, req.TargetID) })
+		gs.sendFriendEvent(account, "FRIEND_REMOVED", req.TargetID)
+		gs.sendFriendEvent(req.TargetID, "FRIEND_REMOVED", account)
+	case cancelled:
+		gs.logc(r.Context(), "[SOCIAL] Account %s cancelled their friend request to account %s", account, req.TargetID)
+		gs.goWrite(func() { gs.deleteFriendRequest(account, req.TargetID) })
+	default:
+		http.Error(w, "Not friends with this user", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handles blocking or unblocking a user
+// Blocking also ends any friendship and pending requests between the two
+func (gs *GameServer) blockHandler(w http.ResponseWriter, r *http.Request) {
+	req, account, ok := gs.readSocialRequest(w, r)
+	if !ok {
+		return
+	}
+
+	gs.socialMutex.Lock()
+	if req.Unblock {
+		if !unlink(gs.blocks, account, req.TargetID) {
+			gs.socialMutex.Unlock()
+			http.Error(w, "User is not blocked", http.StatusNotFound)
+			return
+		}
+		gs.socialMutex.Unlock()
+
+		gs.logc(r.Context(), "[SOCIAL] Account %s unblocked account %s", account, req.TargetID)
+		gs.goWrite(func() { gs.deleteBlock(account, req.TargetID) })
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	link(gs.blocks, account, req.TargetID)
+	wereFriends := unlink(gs.friends, account, req.TargetID)
+	unlink(gs.friends, req.TargetID, account)
+	unlink(gs.friendRequests, account, req.TargetID)
+	unlink(gs.friendRequests, req.TargetID, account)
+	unlink(gs.sentRequests, account, req.TargetID)
+	unlink(gs.sentRequests, req.TargetID, account)
+	gs.socialMutex.Unlock()
+
+	gs.logc(r.Context(), "[SOCIAL] Account %s blocked account %s", account, req.TargetID)
+	gs.goWrite(func() { gs.storeBlock(account, req.TargetID) })
+	gs.goWrite(func() { gs.deleteFriendRequest(account, req.TargetID) })
+	gs.goWrite(func() { gs.deleteFriendRequest(req.TargetID, account) })
+	if wereFriends {
+		gs.goWrite(func() { gs.deleteFriendship(account, req.TargetID) })
+		gs.sendFriendEvent(account, "FRIEND_REMOVED", req.TargetID)
+		gs.sendFriendEvent(req.TargetID, "FRIEND_REMOVED", account)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handles requests for the caller's friends with their presence, pending requests and blocks
+// Query: user_id
+func (gs *GameServer) friendsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil {
+		http.Error(w, "user_id is required", http.StatusBadRequest)
+		return
+	}
+	s, ok := gs.authorizeAccount(w, r, userID)
+	if !ok {
+		return
+	}
+
+	gs.socialMutex.Lock()
+	friends := sortedAccounts(gs.friends[s.account])
+	list := FriendsList{
+		Incoming: sortedAccounts(gs.friendRequests[s.account]),
+		Outgoing: sortedAccounts(gs.sentRequests[s.account]),
+		Blocked:  sortedAccounts(gs.blocks[s.account]),
+	}
+	gs.socialMutex.Unlock()
+
+	// Presence takes the lobby lock, so look it up after releasing socialMutex
+	list.Friends = make([]FriendInfo, 0, len(friends))
+	for _, account := range friends {
+		list.Friends = append(list.Friends, FriendInfo{AccountID: account, State: gs.accountPresence(account)})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// storeFriendship stores both directions of a friendship in the Supabase friendships table
+func (gs *GameServer) storeFriendship(a, b string) {
+	createdAt := gs.clock.Now().UTC().Format(time.RFC3339)
+	records := []map[string]interface{}{
+		{"user_id": a, "friend_id": b, "created_at": createdAt},
+		{"user_id": b, "friend_id": a, "created_at": createdAt},
+	}
+
+	client := gs.dbClient.GetSystemClient()
+	_, _, err := client.From("friendships").Upsert(records, "user_id,friend_id", "", "").Execute()
+	if err != nil {
+		gs.logf("[ERROR] Failed to store friendship between accounts %s and %s: %v", a, b, err)
+	}
+}
+
+// deleteFriendship removes both directions of a friendship
+func (gs *GameServer) deleteFriendship(a, b string) {
+	ids := []string{a, b}
+
+	client := gs.dbClient.GetSystemClient()
+	_, _, err := client.From("friendships").Delete("", "").In("user_id", ids).In("friend_id", ids).Execute()
+	if err != nil {
+		gs.logf("[ERROR] Failed to delete friendship between accounts %s and %s: %v", a, b, err)
+	}
+}
+
+// storeFriendRequest stores a pending request in the Supabase friend_requests table
+func (gs *GameServer) storeFriendRequest(from, to string) {
+	record := map[string]interface{}{
+		"sender_id":    from,
+		"recipient_id": to,
+		"sent_at":      gs.clock.Now().UTC().Format(time.RFC3339),
+	}
+
+	client := gs.dbClient.GetSystemClient()
+	_, _, err := client.From("friend_requests").Upsert(record, "sender_id,recipient_id", "", "").Execute()
+	if err != nil {
+		gs.logf("[ERROR] Failed to store friend request from account %s to account %s: %v", from, to, err)
+	}
+}
+
+func (gs *GameServer) deleteFriendRequest(from, to string) {
+	client := gs.dbClient.GetSystemClient()
+	_, _, err := client.From("friend_requests").Delete("", "").
+		Eq("sender_id", from).
+		Eq("recipient_id", to).
+		Execute()
+	if err != nil {
+		gs.logf("[ERROR] Failed to delete friend request from account %s to account %s: %v", from, to, err)
+	}
+}
+
+// storeBlock stores a block in the Supabase blocks table
+func (gs *GameServer) storeBlock(blocker, blocked string) {
+	record := map[string]interface{}{
+		"blocker_id": blocker,
+		"blocked_id": blocked,
+		"created_at": gs.clock.Now().UTC().Format(time.RFC3339),
+	}
+
+	client := gs.dbClient.GetSystemClient()
+	_, _, err := client.From("blocks").Upsert(record, "blocker_id,blocked_id", "", "").Execute()
+	if err != nil {
+		gs.logf("[ERROR] Failed to store block of account %s by account %s: %v", blocked, blocker, err)
+	}
+}
+
+func (gs *GameServer) deleteBlock(blocker, blocked string) {
+	client := gs.dbClient.GetSystemClient()
+	_, _, err := client.From("blocks").Delete("", "").
+		Eq("blocker_id", blocker).
+		Eq("blocked_id", blocked).
+		Execute()
+	if err != nil {
+		gs.logf("[ERROR] Failed to delete block of account %s by account %s: %v", blocked, blocker, err)
+	}
+}
+
+// loadSocial restores friendships, pending requests and blocks when the server starts
+func (gs *GameServer) loadSocial() {
+	client := gs.dbClient.GetSystemClient()
+
+	var friendships []struct {
+		UserID   string `json:"user_id"`
+		FriendID string `json:"friend_id"`
+	}
+	if _, err := client.From("friendships").Select("user_id,friend_id", "", false).ExecuteTo(&friendships); err != nil {
+		gs.logf("[ERROR] Failed to load friendships: %v", err)
+		return
+	}
+
+	var requests []struct {
+		SenderID    string `json:"sender_id"`
+		RecipientID string `json:"recipient_id"`
+	}
+	if _, err := client.From("friend_requests").Select("sender_id,recipient_id", "", false).ExecuteTo(&requests); err != nil {
+		gs.logf("[ERROR] Failed to load friend requests: %v", err)
+		return
+	}
+
+	var blocks []struct {
+		BlockerID string `json:"blocker_id"`
+		BlockedID string `json:"blocked_id"`
+	}
+	if _, err := client.From("blocks").Select("blocker_id,blocked_id", "", false).ExecuteTo(&blocks); err != nil {
+		gs.logf("[ERROR] Failed to load blocks: %v", err)
+		return
+	}
+
+	// Merged into anything changed since startup
+	gs.socialMutex.Lock()
+	for _, row := range friendships {
+		link(gs.friends, row.UserID, row.FriendID)
+	}
+	for _, row := range requests {
+		link(gs.friendRequests, row.RecipientID, row.SenderID)
+		link(gs.sentRequests, row.SenderID, row.RecipientID)
+	}
+	for _, row := range blocks {
+		link(gs.blocks, row.BlockerID, row.BlockedID)
+	}
+	gs.socialMutex.Unlock()
+
+	gs.logf("[SOCIAL] Loaded %d friendships, %d friend requests and %d blocks", len(friendships)/2, len(requests), len(blocks))
+}
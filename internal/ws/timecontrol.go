@@ -0,0 +1,305 @@
+package ws
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/vindennt/akasha-showdown-engine/internal/game"
+)
+
+// TimeControl is a chess-style match clock. Each player starts with Base,
+// gains Increment after each move, and must move within TurnTimeout
+// A zero Base disables the main clock and a zero TurnTimeout disables turn timeouts
+type TimeControl struct {
+	Base        time.Duration
+	Increment   time.Duration
+	TurnTimeout time.Duration
+}
+
+// Reasons a match ended, sent with MATCH_RESULT and stored in the match record
+const (
+	EndKnockout = "knockout" // Won through normal play
+	EndResign   = "resign"   // A player forfeited
+	EndTimeout  = "timeout"  // A player ran out of main clock time
+	EndAbandon  = "abandon"  // A player stayed disconnected past the reconnect window
+	EndNoShow   = "no_show"  // Both players did, so the match is unranked and neither abandoned
+)
+
+// playerIndex returns 0 or 1 for a player in the match, -1 otherwise
+func (m *Match) playerIndex(id int) int {
+	for i, p := range m.Players {
+		if p == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// applyLocked applies a command, charges the mover's clock, records it for
+// the replay and broadcasts the new state
+// reason is recorded as the end reason if this command finishes the match
+// Caller must hold m.mutex
+func (gs *GameServer) applyLocked(m *Match, cmd game.Command, reason string) error {
+	mover := m.engine.Active()
+	if err := m.engine.Apply(cmd); err != nil {
+		return err
+	}
+
+	m.recordLocked(cmd)
+	gs.chargeClockLocked(m, mover)
+
+	if m.engine.Finished() {
+		m.endReason = reason
+	}
+	gs.broadcastMatchStateLocked(m)
+
+	// Let the clock loop re-arm for the next turn
+	select {
+	case m.moved <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// chargeClockLocked deducts the turn's elapsed time from the mover and adds the increment
+// Caller must hold m.mutex
+func (gs *GameServer) chargeClockLocked(m *Match, mover int) {
+	now := gs.clock.Now()
+	if i := m.playerIndex(mover); i >= 0 && gs.timeControl.Base > 0 {
+		m.clocks[i] -= now.Sub(m.turnStarted)
+		m.clocks[i] += gs.timeControl.Increment
+	}
+	m.turnStarted = now
+}
+
+// clockStateLocked returns the clock as sent to clients
+// Caller must hold m.mutex
+func (gs *GameServer) clockStateLocked(m *Match) *ClockState {
+	now := gs.clock.Now()
+	active := m.engine.Active()
+	elapsed := now.Sub(m.turnStarted)
+
+	state := &ClockState{
+		Active:      active,
+		RemainingMs: make([]int64, len(m.Players)),
+	}
+	for i := range m.Players {
+		remaining := m.clocks[i]
+		if m.Players[i] == active {
+			remaining -= elapsed
+		}
+		state.RemainingMs[i] = max(remaining, 0).Milliseconds()
+	}
+	if gs.timeControl.TurnTimeout > 0 {
+		state.TurnEndsAt = m.turnStarted.Add(gs.timeControl.TurnTimeout).UnixMilli()
+	}
+
+	return state
+}
+
+// runMatchClock enforces time control and reconnect windows until the match ends
+// Re-arms whenever a command is accepted or a player connects or disconnects
+func (gs *GameServer) runMatchClock(m *Match) {
+	for {
+		m.mutex.Lock()
+		if m.finished {
+			m.mutex.Unlock()
+			return
+		}
+		wait, ok := gs.nextDeadlineLocked(m)
+		m.mutex.Unlock()
+
+		// Nothing to enforce; a nil channel waits for the next move instead
+		var deadline <-chan time.Time
+		if ok {
+			deadline = gs.clock.After(wait)
+		}
+
+		select {
+		case <-deadline:
+			m.mutex.Lock()
+			gs.enforceDeadlinesLocked(m)
+			m.mutex.Unlock()
+		case <-m.moved:
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// nextDeadlineLocked returns how long until the next clock, turn or reconnect deadline
+// Returns false if no deadline applies
+// Caller must hold m.mutex
+func (gs *GameServer) nextDeadlineLocked(m *Match) (time.Duration, bool) {
+	now := gs.clock.Now()
+	var next time.Duration
+	found := false
+
+	consider := func(d time.Duration) {
+		if !found || d < next {
+			next = d
+			found = true
+		}
+	}
+
+	for _, since := range m.absentSince {
+		if !since.IsZero() {
+			consider(since.Add(gs.reconnectWindow).Sub(now))
+		}
+	}
+
+	elapsed := now.Sub(m.turnStarted)
+	if i := m.playerIndex(m.engine.Active()); i >= 0 && gs.timeControl.Base > 0 {
+		consider(m.clocks[i] - elapsed)
+	}
+	if gs.timeControl.TurnTimeout > 0 {
+		consider(gs.timeControl.TurnTimeout - elapsed)
+	}
+
+	return max(next, 0), found
+}
+
+// enforceDeadlinesLocked forfeits abandoned or flagged players and auto-plays timed out turns
+// Caller must hold m.mutex
+func (gs *GameServer) enforceDeadlinesLocked(m *Match) {
+	if m.finished {
+		return
+	}
+	now := gs.clock.Now()
+
+	gone := func(since time.Time) bool {
+		return !since.IsZero() && !now.Before(since.Add(gs.reconnectWindow))
+	}
+
+	// Nobody to blame, e.g. a restored match neither player came back to
+	// The engine still needs a winner, so the player to move forfeits
+	if gone(m.absentSince[0]) && gone(m.absentSince[1]) {
+		gs.logc(m.logCtx(), "[MATCH] Neither player returned to match %s, ending it unranked", m.ID)
+		m.Ranked = false
+		gs.forfeitLocked(m, m.engine.Active(), EndNoShow)
+		return
+	}
+
+	for i, since := range m.absentSince {
+		if gone(since) {
+			gs.logc(m.logCtx(), "[MATCH] User %d abandoned match %s", m.Players[i], m.ID)
+			gs.forfeitLocked(m, m.Players[i], EndAbandon)
+			return
+		}
+	}
+
+	active := m.engine.Active()
+	i := m.playerIndex(active)
+	if i < 0 {
+		return
+	}
+	elapsed := now.Sub(m.turnStarted)
+
+	if gs.timeControl.Base > 0 && m.clocks[i]-elapsed <= 0 {
+		gs.logc(m.logCtx(), "[MATCH] User %d ran out of time in match %s", active, m.ID)
+		gs.forfeitLocked(m, active, EndTimeout)
+		return
+	}
+
+	if gs.timeControl.TurnTimeout > 0 && elapsed >= gs.timeControl.TurnTimeout {
+		action := m.engine.TimeoutAction()
+		gs.logc(m.logCtx(), "[MATCH] User %d turn timed out in match %s, playing %s", active, m.ID, action)
+		if err := gs.applyLocked(m, game.Command{PlayerID: active, Action: action}, EndKnockout); err != nil {
+			gs.logc(m.logCtx(), "[ERROR] Timeout action rejected in match %s: %v", m.ID, err)
+		}
+	}
+}
+
+// forfeitLocked ends the match with the given player losing
+// Caller must hold m.mutex
+func (gs *GameServer) forfeitLocked(m *Match, player int, reason string) {
+	if err := gs.applyLocked(m, game.Command{PlayerID: player, Action: game.ActionForfeit}, reason); err != nil {
+		gs.logc(m.logCtx(), "[ERROR] Forfeit rejected in match %s: %v", m.ID, err)
+	}
+}
+
+// playerDisconnected starts the reconnect window in any match the player is in
+func (gs *GameServer) playerDisconnected(id int) {
+	for _, m := range gs.matchesFor(id) {
+		m.mutex.Lock()
+		i := m.playerIndex(id)
+		if m.finished || !m.absentSince[i].IsZero() {
+			m.mutex.Unlock()
+			continue
+		}
+		m.absentSince[i] = gs.clock.Now()
+		reconnectBy := m.absentSince[i].Add(gs.reconnectWindow)
+		gs.broadcastPlayerStatusLocked(m, "PLAYER_DISCONNECTED", id, reconnectBy)
+		m.mutex.Unlock()
+
+		gs.logc(m.logCtx(), "[MATCH] User %d disconnected from match %s, reconnect window %v", id, m.ID, gs.reconnectWindow)
+		gs.rearm(m)
+	}
+}
+
+// playerReconnected ends the reconnect window and resends the current state
+func (gs *GameServer) playerReconnected(id int) {
+	for _, m := range gs.matchesFor(id) {
+		m.mutex.Lock()
+		i := m.playerIndex(id)
+		if m.finished || m.absentSince[i].IsZero() {
+			m.mutex.Unlock()
+			continue
+		}
+		m.absentSince[i] = time.Time{}
+		gs.broadcastPlayerStatusLocked(m, "PLAYER_RECONNECTED", id, time.Time{})
+
+		state := gs.matchStateLocked(m, "MATCH_STATE")
+		msg, _ := json.Marshal(state)
+		gs.sendTo(id, msg)
+		m.mutex.Unlock()
+
+		gs.logc(m.logCtx(), "[MATCH] User %d reconnected to match %s", id, m.ID)
+		gs.setPresence(id, PresenceInMatch)
+		gs.rearm(m)
+	}
+}
+
+// broadcastPlayerStatusLocked tells both players and spectators about a connection change
+// Caller must hold m.mutex
+func (gs *GameServer) broadcastPlayerStatusLocked(m *Match, eventType string, id int, reconnectBy time.Time) {
+	status := PlayerStatus{
+		Type:     eventType,
+		MatchID:  m.ID,
+		PlayerID: id,
+	}
+	if !reconnectBy.IsZero() {
+		status.ReconnectBy = reconnectBy.UnixMilli()
+	}
+	msg, _ := json.Marshal(status)
+
+	for _, p := range m.Players {
+		gs.sendTo(p, msg)
+	}
+	for _, s := range m.spectatorIDsLocked() {
+		gs.sendTo(s, msg)
+	}
+}
+
+// rearm wakes the match clock loop so it picks up a changed deadline
+func (gs *GameServer) rearm(m *Match) {
+	select {
+	case m.moved <- struct{}{}:
+	default:
+	}
+}
+
+// matchesFor returns in-progress matches the subscriber is playing in
+func (gs *GameServer) matchesFor(id int) []*Match {
+	gs.matchesMutex.Lock()
+	defer gs.matchesMutex.Unlock()
+
+	matches := make([]*Match, 0)
+	for _, m := range gs.matches {
+		if m.isPlayer(id) {
+			matches = append(matches, m)
+		}
+	}
+	return matches
+}
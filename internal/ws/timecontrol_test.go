@@ -0,0 +1,200 @@
+package ws
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/vindennt/akasha-showdown-engine/internal/clock"
+	"github.com/vindennt/akasha-showdown-engine/internal/game"
+)
+
+// newClockTestMatch builds a duel between players 1 and 2 on a fake clock
+// Player 1 moves first
+func newClockTestMatch(t *testing.T, tc TimeControl, reconnectWindow time.Duration) (*GameServer, *Match, *clock.Fake) {
+	t.Helper()
+	fc := clock.NewFake(time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC))
+	gs := &GameServer{
+		clock:           fc,
+		logger:          slog.New(slog.NewTextHandler(io.Discard, nil)),
+		globalLobby:     &Lobby{subscribers: make(map[int]*Subscriber)},
+		timeControl:     tc,
+		reconnectWindow: reconnectWindow,
+	}
+	m, err := gs.buildMatch(context.Background(), "test-match", "duel", [2]int{1, 2}, 1, game.Options{}, fc.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gs, m, fc
+}
+
+func TestEnforceDeadlines(t *testing.T) {
+	tests := []struct {
+		name       string
+		tc         TimeControl
+		absent     bool // Player 2 disconnected when the match started
+		advance    time.Duration
+		wantReason string // Empty if the match should still be running
+		wantWinner int
+		wantActive int
+		wantNext   time.Duration // Until the next deadline after enforcing, if still running
+	}{
+		{
+			name:       "main clock not out",
+			tc:         TimeControl{Base: time.Minute},
+			advance:    59 * time.Second,
+			wantActive: 1,
+			wantNext:   time.Second,
+		},
+		{
+			name:       "main clock runs out",
+			tc:         TimeControl{Base: time.Minute},
+			advance:    time.Minute,
+			wantReason: EndTimeout,
+			wantWinner: 2,
+		},
+		{
+			name:       "turn timeout plays for the player",
+			tc:         TimeControl{TurnTimeout: 30 * time.Second},
+			advance:    30 * time.Second,
+			wantActive: 2,
+			wantNext:   30 * time.Second,
+		},
+		{
+			name:       "turn timeout before main clock",
+			tc:         TimeControl{Base: time.Minute, TurnTimeout: 30 * time.Second},
+			advance:    30 * time.Second,
+			wantActive: 2,
+			wantNext:   30 * time.Second,
+		},
+		{
+			name:       "turn timeout not reached",
+			tc:         TimeControl{TurnTimeout: 30 * time.Second},
+			advance:    29 * time.Second,
+			wantActive: 1,
+			wantNext:   time.Second,
+		},
+		{
+			name:       "reconnect window over",
+			absent:     true,
+			advance:    10 * time.Second,
+			wantReason: EndAbandon,
+			wantWinner: 1,
+		},
+		{
+			name:       "reconnect window not over",
+			absent:     true,
+			advance:    9 * time.Second,
+			wantActive: 1,
+			wantNext:   time.Second,
+		},
+		{
+			name:       "abandon beats timeout",
+			tc:         TimeControl{Base: 10 * time.Second},
+			absent:     true,
+			advance:    10 * time.Second,
+			wantReason: EndAbandon,
+			wantWinner: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gs, m, fc := newClockTestMatch(t, tt.tc, 10*time.Second)
+			m.mutex.Lock()
+			defer m.mutex.Unlock()
+			if tt.absent {
+				m.absentSince[1] = fc.Now()
+			}
+
+			fc.Advance(tt.advance)
+			gs.enforceDeadlinesLocked(m)
+
+			if tt.wantReason != "" {
+				if !m.engine.Finished() || m.endReason != tt.wantReason || m.engine.Winner() != tt.wantWinner {
+					t.Errorf("finished %v, reason %q, winner %d, want %q won by %d",
+						m.engine.Finished(), m.endReason, m.engine.Winner(), tt.wantReason, tt.wantWinner)
+				}
+				return
+			}
+
+			if m.engine.Finished() {
+				t.Fatalf("match finished with %q, want it still running", m.endReason)
+			}
+			if got := m.engine.Active(); got != tt.wantActive {
+				t.Errorf("Active() = %d, want %d", got, tt.wantActive)
+			}
+			if next, ok := gs.nextDeadlineLocked(m); !ok || next != tt.wantNext {
+				t.Errorf("nextDeadlineLocked() = %v, %v, want %v", next, ok, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestEnforceDeadlinesNoShow(t *testing.T) {
+	gs, m, fc := newClockTestMatch(t, TimeControl{}, 10*time.Second)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.Ranked = true
+	m.absentSince = [2]time.Time{fc.Now(), fc.Now()}
+
+	fc.Advance(10 * time.Second)
+	gs.enforceDeadlinesLocked(m)
+
+	if !m.engine.Finished() || m.endReason != EndNoShow || m.engine.Winner() != 2 {
+		t.Errorf("finished %v, reason %q, winner %d, want %q won by 2",
+			m.engine.Finished(), m.endReason, m.engine.Winner(), EndNoShow)
+	}
+	if m.Ranked {
+		t.Error("match still ranked after neither player returned")
+	}
+}
+
+func TestNoDeadlines(t *testing.T) {
+	gs, m, fc := newClockTestMatch(t, TimeControl{}, 10*time.Second)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if next, ok := gs.nextDeadlineLocked(m); ok {
+		t.Errorf("nextDeadlineLocked() = %v, want no deadline", next)
+	}
+	fc.Advance(time.Hour)
+	gs.enforceDeadlinesLocked(m)
+	if m.engine.Finished() || m.engine.Active() != 1 {
+		t.Errorf("match changed without time control")
+	}
+}
+
+func TestChargeClock(t *testing.T) {
+	tests := []struct {
+		name    string
+		tc      TimeControl
+		elapsed time.Duration
+		want    time.Duration
+	}{
+		{"charged for the turn", TimeControl{Base: time.Minute}, 10 * time.Second, 50 * time.Second},
+		{"increment added", TimeControl{Base: time.Minute, Increment: 5 * time.Second}, 10 * time.Second, 55 * time.Second},
+		{"increment can exceed base", TimeControl{Base: time.Minute, Increment: 5 * time.Second}, time.Second, 64 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gs, m, fc := newClockTestMatch(t, tt.tc, 10*time.Second)
+			m.mutex.Lock()
+			defer m.mutex.Unlock()
+
+			fc.Advance(tt.elapsed)
+			if err := gs.applyLocked(m, game.Command{PlayerID: 1, Action: game.ActionGuard}, EndKnockout); err != nil {
+				t.Fatal(err)
+			}
+			if m.clocks[0] != tt.want || m.clocks[1] != tt.tc.Base {
+				t.Errorf("clocks = %v, want [%v %v]", m.clocks, tt.want, tt.tc.Base)
+			}
+			if !m.turnStarted.Equal(fc.Now()) {
+				t.Errorf("turnStarted = %v, want the move time %v", m.turnStarted, fc.Now())
+			}
+		})
+	}
+}
@@ -0,0 +1,616 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vindennt/akasha-showdown-engine/internal/auth"
+	"github.com/vindennt/akasha-showdown-engine/internal/game"
+	"github.com/vindennt/akasha-showdown-engine/internal/logging"
+	"github.com/vindennt/akasha-showdown-engine/internal/tournament"
+)
+
+// Tournament lifecycle
+// Players register, the organizer opens check-in, and the organizer starts
+// the tournament with everyone who checked in, seeded by rating
+// Moderators can open check-in and start any tournament
+const (
+	TournamentRegistration = "registration"
+	TournamentCheckIn      = "check_in"
+	TournamentRunning      = "running"
+	TournamentFinished     = "finished"
+)
+
+// Limits on tournament size
+const (
+	defaultTournamentPlayers = 64
+	maxTournamentPlayers     = 256
+)
+
+// Tournament runs a bracket of series through the match engine
+// A bracket match starts once both of its players say they are ready,
+// and the series winner is reported back to advance the bracket
+type Tournament struct {
+	ID          string
+	Name        string
+	Format      string
+	Series      SeriesOptions // Played for every bracket match
+	SwissRounds int           // 0 picks the number of rounds from the entrants
+	OrganizerID int
+	MaxPlayers  int
+	CreatedAt   time.Time
+
+	mutex      sync.Mutex
+	status     string
+	registered []int // In registration order
+	checkedIn  map[int]bool
+	bracket    tournament.Bracket
+	ready      map[string][]int  // Ready players by bracket match ID
+	seriesIDs  map[string]string // Series being played by bracket match ID
+	notified   map[string]bool   // Bracket matches players were told are ready
+
+	// The bracket is rebuilt from these when restoring a snapshot
+	entrants []tournament.Entrant // Seeded field the bracket started with
+	results  []bracketResult      // In the order they were reported
+}
+
+// bracketResult is a bracket match winner as reported to the bracket
+type bracketResult struct {
+	MatchID  string `json:"match_id"`
+	WinnerID int    `json:"winner_id"`
+}
+
+// getTournament returns a tournament by ID, or nil if not found
+func (gs *GameServer) getTournament(id string) *Tournament {
+	gs.tournamentsMutex.Lock()
+	defer gs.tournamentsMutex.Unlock()
+	return gs.tournaments[id]
+}
+
+// infoLocked returns the tournament summary as sent to clients
+// Caller must hold t.mutex
+func (t *Tournament) infoLocked() TournamentInfo {
+	checkedIn := make([]int, 0, len(t.checkedIn))
+	for _, id := range t.registered {
+		if t.checkedIn[id] {
+			checkedIn = append(checkedIn, id)
+		}
+	}
+
+	return TournamentInfo{
+		TournamentID: t.ID,
+		Name:         t.Name,
+		Format:       t.Format,
+		Mode:         t.Series.Mode,
+		BestOf:       t.Series.BestOf,
+		Status:       t.status,
+		OrganizerID:  t.OrganizerID,
+		MaxPlayers:   t.MaxPlayers,
+		Registered:   slices.Clone(t.registered),
+		CheckedIn:    checkedIn,
+		CreatedAt:    t.CreatedAt.Unix(),
+	}
+}
+
+// bracketLocked returns the full bracket as sent to clients
+// Caller must hold t.mutex
+func (t *Tournament) bracketLocked() TournamentBracket {
+	view := TournamentBracket{
+		Type:       "TOURNAMENT_UPDATE",
+		Tournament: t.infoLocked(),
+		Matches:    make([]TournamentMatch, 0),
+		Standings:  make([]tournament.Standing, 0),
+	}
+	if t.bracket == nil {
+		return view
+	}
+
+	for _, m := range t.bracket.Matches() {
+		view.Matches = append(view.Matches, TournamentMatch{
+			Match:    m,
+			SeriesID: t.seriesIDs[m.ID],
+			Ready:    append([]int{}, t.ready[m.ID]...),
+		})
+	}
+	view.Standings = t.bracket.Standings()
+	if t.bracket.Finished() {
+		view.WinnerID = t.bracket.Winner()
+	}
+	return view
+}
+
+// broadcastTournamentLocked sends the bracket to everyone in the global lobby
+// Caller must hold t.mutex
+func (gs *GameServer) broadcastTournamentLocked(t *Tournament) {
+	msg, _ := json.Marshal(t.bracketLocked())
+	gs.publish(msg)
+}
+
+// notifyReadyLocked tells players about bracket matches they can now play
+// Caller must hold t.mutex
+func (gs *GameServer) notifyReadyLocked(t *Tournament) {
+	for _, m := range t.bracket.Matches() {
+		if m.Status != tournament.StatusReady || t.notified[m.ID] {
+			continue
+		}
+		t.notified[m.ID] = true
+
+		ready := TournamentMatchReady{
+			Type:           "TOURNAMENT_MATCH_READY",
+			TournamentID:   t.ID,
+			BracketMatchID: m.ID,
+			Players:        m.Players(),
+		}
+		msg, _ := json.Marshal(ready)
+		for _, id := range ready.Players {
+			gs.sendTo(id, msg)
+		}
+	}
+}
+
+// playBracketMatch plays a bracket match as a series and reports the winner
+func (gs *GameServer) playBracketMatch(t *Tournament, id string, players [2]int) {
+	sr := gs.newSeries(players, t.Series)
+	sr.TournamentID = t.ID
+	sr.BracketMatchID = id
+	gs.runBracketSeries(t, sr)
+}
+
+// runBracketSeries plays a bracket match's series, new or restored from a snapshot,
+// and reports the winner. The bracket match must already be started
+func (gs *GameServer) runBracketSeries(t *Tournament, sr *Series) {
+	id, players := sr.BracketMatchID, sr.Players
+
+	t.mutex.Lock()
+	t.seriesIDs[id] = sr.ID
+	gs.broadcastTournamentLocked(t)
+	t.mutex.Unlock()
+
+	gs.logc(sr.logCtx(), "[TOURNAMENT] %s: %s started, User %d vs User %d", t.ID, id, players[0], players[1])
+
+	err := gs.runSeries(sr)
+
+	gs.clock.Sleep(gs.resultDelay)
+	gs.setPresence(players[0], PresenceOnline)
+	gs.setPresence(players[1], PresenceOnline)
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.seriesIDs, id)
+
+	if err != nil {
+		// Leave the match live so it shows up as stuck rather than silently advancing
+		gs.logc(sr.logCtx(), "[ERROR] Tournament %s match %s failed: %v", t.ID, id, err)
+		return
+	}
+
+	if err := t.bracket.Report(id, sr.WinnerID); err != nil {
+		gs.logc(sr.logCtx(), "[ERROR] Tournament %s could not record %s: %v", t.ID, id, err)
+		return
+	}
+	t.results = append(t.results, bracketResult{MatchID: id, WinnerID: sr.WinnerID})
+	gs.logc(sr.logCtx(), "[TOURNAMENT] %s: %s won by User %d", t.ID, id, sr.WinnerID)
+
+	if t.bracket.Finished() {
+		t.status = TournamentFinished
+		gs.logc(sr.logCtx(), "[TOURNAMENT] %s finished, won by User %d", t.ID, t.bracket.Winner())
+		winner, standings := t.bracket.Winner(), t.bracket.Standings()
+		gs.goWrite(func() { gs.storeTournamentResult(t.ID, t.Name, t.Format, winner, standings) })
+	}
+
+	gs.broadcastTournamentLocked(t)
+	gs.notifyReadyLocked(t)
+}
+
+// readTournamentRequest parses a tournament_id and user_id request body
+// and checks the user is the caller, so organizer checks can trust it
+// Writes the error response and returns false if the request is invalid
+func (gs *GameServer) readTournamentRequest(w http.ResponseWriter, r *http.Request) (*Tournament, int, bool) {
+	if r.Method != "POST" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return nil, 0, false
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return nil, 0, false
+	}
+
+	var req struct {
+		TournamentID string `json:"tournament_id"`
+		UserID       int    `json:"user_id"`
+	}
+
+	if err := json.Unmarshal(data, &req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return nil, 0, false
+	}
+	if _, ok := gs.authorize(w, r, req.UserID); !ok {
+		return nil, 0, false
+	}
+
+	t := gs.getTournament(req.TournamentID)
+	if t == nil {
+		http.Error(w, "Tournament not found", http.StatusNotFound)
+		return nil, 0, false
+	}
+
+	return t, req.UserID, true
+}
+
+// handles creating a tournament. The creator becomes its organizer
+func (gs *GameServer) createTournamentHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var req struct {
+		UserID      int    `json:"user_id"`
+		Name        string `json:"name"`
+		Format      string `json:"format"`
+		Mode        string `json:"mode"`
+		BestOf      int    `json:"best_of"`
+		MaxPlayers  int    `json:"max_players"`
+		SwissRounds int    `json:"swiss_rounds"`
+	}
+
+	if err := json.Unmarshal(data, &req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	r = r.WithContext(logging.With(r.Context(), "user_id", req.UserID))
+
+	if _, ok := gs.authorize(w, r, req.UserID); !ok {
+		return
+	}
+
+	if req.Mode == "" {
+		req.Mode = game.DefaultMode
+	}
+	if req.BestOf == 0 {
+		req.BestOf = 1
+	}
+	if req.MaxPlayers == 0 {
+		req.MaxPlayers = defaultTournamentPlayers
+	}
+
+	switch {
+	case req.Name == "":
+		http.Error(w, "Tournament name is required", http.StatusBadRequest)
+		return
+	case !tournament.ValidFormat(req.Format):
+		http.Error(w, "Unknown tournament format", http.StatusBadRequest)
+		return
+	case !game.ValidMode(req.Mode):
+		http.Error(w, "Unknown game mode", http.StatusBadRequest)
+		return
+	case !validBestOf(req.BestOf):
+		http.Error(w, "best_of must be 1, 3 or 5", http.StatusBadRequest)
+		return
+	case req.MaxPlayers < 2 || req.MaxPlayers > maxTournamentPlayers:
+		http.Error(w, "max_players must be between 2 and 256", http.StatusBadRequest)
+		return
+	case req.SwissRounds < 0:
+		http.Error(w, "swiss_rounds cannot be negative", http.StatusBadRequest)
+		return
+	}
+
+	t := &Tournament{
+		ID:          uuid.New().String(),
+		Name:        req.Name,
+		Format:      req.Format,
+		Series:      SeriesOptions{Mode: req.Mode, BestOf: req.BestOf, Ranked: true},
+		SwissRounds: req.SwissRounds,
+		OrganizerID: req.UserID,
+		MaxPlayers:  req.MaxPlayers,
+		CreatedAt:   gs.clock.Now(),
+		status:      TournamentRegistration,
+		registered:  make([]int, 0),
+		checkedIn:   make(map[int]bool),
+		ready:       make(map[string][]int),
+		seriesIDs:   make(map[string]string),
+		notified:    make(map[string]bool),
+	}
+
+	gs.tournamentsMutex.Lock()
+	gs.tournaments[t.ID] = t
+	gs.tournamentsMutex.Unlock()
+
+	gs.logc(r.Context(), "[TOURNAMENT] User %d created %s tournament %s (%s)", req.UserID, t.Format, t.ID, t.Name)
+
+	t.mutex.Lock()
+	info := t.infoLocked()
+	gs.broadcastTournamentLocked(t)
+	t.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(info)
+}
+
+// handles registering for a tournament
+func (gs *GameServer) registerTournamentHandler(w http.ResponseWriter, r *http.Request) {
+	t, userID, ok := gs.readTournamentRequest(w, r)
+	if !ok {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.status != TournamentRegistration {
+		http.Error(w, "Registration is closed", http.StatusConflict)
+		return
+	}
+	if slices.Contains(t.registered, userID) {
+		http.Error(w, "Already registered", http.StatusConflict)
+		return
+	}
+	if len(t.registered) >= t.MaxPlayers {
+		http.Error(w, "Tournament is full", http.StatusConflict)
+		return
+	}
+
+	t.registered = append(t.registered, userID)
+	gs.logc(r.Context(), "[TOURNAMENT] User %d registered for %s (%d/%d)", userID, t.ID, len(t.registered), t.MaxPlayers)
+	gs.broadcastTournamentLocked(t)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handles leaving a tournament before it starts
+func (gs *GameServer) withdrawTournamentHandler(w http.ResponseWriter, r *http.Request) {
+	t, userID, ok := gs.readTournamentRequest(w, r)
+	if !ok {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.status != TournamentRegistration && t.status != TournamentCheckIn {
+		http.Error(w, "Tournament has already started", http.StatusConflict)
+		return
+	}
+
+	i := slices.Index(t.registered, userID)
+	if i < 0 {
+		http.Error(w, "Not registered", http.StatusNotFound)
+		return
+	}
+
+	t.registered = slices.Delete(t.registered, i, i+1)
+	delete(t.checkedIn, userID)
+	gs.logc(r.Context(), "[TOURNAMENT] User %d withdrew from %s", userID, t.ID)
+	gs.broadcastTournamentLocked(t)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handles the organizer closing registration and opening check-in
+func (gs *GameServer) openCheckInHandler(w http.ResponseWriter, r *http.Request) {
+	t, userID, ok := gs.readTournamentRequest(w, r)
+	if !ok {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if userID != t.OrganizerID && !gs.subscriberHasRole(userID, auth.RoleModerator) {
+		http.Error(w, "Only the organizer can open check-in", http.StatusForbidden)
+		return
+	}
+	if t.status != TournamentRegistration {
+		http.Error(w, "Check-in is already open", http.StatusConflict)
+		return
+	}
+
+	t.status = TournamentCheckIn
+	gs.logc(r.Context(), "[TOURNAMENT] Check-in open for %s with %d registered", t.ID, len(t.registered))
+	gs.broadcastTournamentLocked(t)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handles registered players checking in
+func (gs *GameServer) checkInHandler(w http.ResponseWriter, r *http.Request) {
+	t, userID, ok := gs.readTournamentRequest(w, r)
+	if !ok {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.status != TournamentCheckIn {
+		http.Error(w, "Check-in is not open", http.StatusConflict)
+		return
+	}
+	if !slices.Contains(t.registered, userID) {
+		http.Error(w, "Not registered", http.StatusForbidden)
+		return
+	}
+
+	t.checkedIn[userID] = true
+	gs.logc(r.Context(), "[TOURNAMENT] User %d checked in to %s", userID, t.ID)
+	gs.broadcastTournamentLocked(t)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handles the organizer starting the tournament
+// Players who didn't check in are dropped, and the rest are seeded by rating
+func (gs *GameServer) startTournamentHandler(w http.ResponseWriter, r *http.Request) {
+	t, userID, ok := gs.readTournamentRequest(w, r)
+	if !ok {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if userID != t.OrganizerID && !gs.subscriberHasRole(userID, auth.RoleModerator) {
+		http.Error(w, "Only the organizer can start the tournament", http.StatusForbidden)
+		return
+	}
+	if t.status != TournamentCheckIn {
+		http.Error(w, "Check-in must be open to start", http.StatusConflict)
+		return
+	}
+	if gs.rejectDraining(w) {
+		return
+	}
+
+	entrants := make([]tournament.Entrant, 0, len(t.checkedIn))
+	for _, id := range t.registered {
+		if t.checkedIn[id] {
+			entrants = append(entrants, tournament.Entrant{
+				UserID: id,
+				Rating: gs.rating(t.Series.Mode, gs.accountOf(id)),
+			})
+		}
+	}
+
+	entrants = tournament.Seed(entrants)
+	bracket, err := tournament.New(t.Format, entrants, t.SwissRounds)
+	if errors.Is(err, tournament.ErrTooFewEntrants) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	t.bracket = bracket
+	t.entrants = entrants
+	t.status = TournamentRunning
+	gs.logc(r.Context(), "[TOURNAMENT] %s started with %d players", t.ID, len(entrants))
+
+	gs.broadcastTournamentLocked(t)
+	gs.notifyReadyLocked(t)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handles a player saying they are ready for their next bracket match
+// The match starts once both players are ready
+func (gs *GameServer) tournamentReadyHandler(w http.ResponseWriter, r *http.Request) {
+	t, userID, ok := gs.readTournamentRequest(w, r)
+	if !ok {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.status != TournamentRunning {
+		http.Error(w, "Tournament is not running", http.StatusConflict)
+		return
+	}
+
+	var next *tournament.Match
+	for _, m := range t.bracket.Matches() {
+		players := m.Players()
+		if m.Status == tournament.StatusReady && slices.Contains(players[:], userID) {
+			next = &m
+			break
+		}
+	}
+	if next == nil {
+		http.Error(w, "No bracket match waiting for this player", http.StatusNotFound)
+		return
+	}
+
+	if gs.rejectDraining(w) {
+		return
+	}
+
+	if !slices.Contains(t.ready[next.ID], userID) {
+		t.ready[next.ID] = append(t.ready[next.ID], userID)
+	}
+
+	if len(t.ready[next.ID]) == 2 {
+		if err := t.bracket.Start(next.ID); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		delete(t.ready, next.ID)
+		go gs.playBracketMatch(t, next.ID, next.Players())
+	} else {
+		gs.broadcastTournamentLocked(t)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handles listing tournaments
+func (gs *GameServer) listTournamentsHandler(w http.ResponseWriter, r *http.Request) {
+	gs.tournamentsMutex.Lock()
+	tournaments := make([]TournamentInfo, 0, len(gs.tournaments))
+	for _, t := range gs.tournaments {
+		t.mutex.Lock()
+		tournaments = append(tournaments, t.infoLocked())
+		t.mutex.Unlock()
+	}
+	gs.tournamentsMutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Tournaments []TournamentInfo `json:"tournaments"`
+	}{
+		Tournaments: tournaments,
+	})
+}
+
+// handles fetching a tournament's bracket and standings
+func (gs *GameServer) bracketHandler(w http.ResponseWriter, r *http.Request) {
+	t := gs.getTournament(r.PathValue("id"))
+	if t == nil {
+		http.Error(w, "Tournament not found", http.StatusNotFound)
+		return
+	}
+
+	t.mutex.Lock()
+	view := t.bracketLocked()
+	t.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(view)
+}
+
+// storeTournamentResult stores final standings in the Supabase tournaments table
+func (gs *GameServer) storeTournamentResult(id, name, format string, winnerID int, standings []tournament.Standing) {
+	record := map[string]interface{}{
+		"id":          id,
+		"name":        name,
+		"format":      format,
+		"winner_id":   winnerID,
+		"standings":   standings,
+		"finished_at": gs.clock.Now().UTC().Format(time.RFC3339),
+	}
+
+	client := gs.dbClient.GetSystemClient()
+	_, _, err := client.From("tournaments").Insert(record, false, "", "", "").Execute()
+	if err != nil {
+		gs.logf("[ERROR] Failed to store tournament %s: %v", id, err)
+		return
+	}
+
+	gs.logf("[SUCCESS] Tournament result stored: id=%s, winner=%d", id, winnerID)
+}
@@ -5,34 +5,47 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
-	"log"
+	"log/slog"
+	"math/rand"
 	"net"
 	"net/http"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"golang.org/x/time/rate"
-
 	"github.com/coder/websocket"
+	"github.com/google/uuid"
+	"github.com/vindennt/akasha-showdown-engine/internal/apikey"
+	"github.com/vindennt/akasha-showdown-engine/internal/auth"
+	"github.com/vindennt/akasha-showdown-engine/internal/clock"
+	"github.com/vindennt/akasha-showdown-engine/internal/config"
 	"github.com/vindennt/akasha-showdown-engine/internal/db"
+	"github.com/vindennt/akasha-showdown-engine/internal/logging"
+	"github.com/vindennt/akasha-showdown-engine/internal/metrics"
 	"github.com/vindennt/akasha-showdown-engine/internal/middleware"
+	"github.com/vindennt/akasha-showdown-engine/internal/moderation"
+	"github.com/vindennt/akasha-showdown-engine/internal/origin"
+	"github.com/vindennt/akasha-showdown-engine/internal/snapshot"
 )
 
 type GameServer struct {
-	// Controls the message queue's window size
-	// Messages exceeding the window get dropped
-	subscriberMessageBuffer int
-
-	// Controls the rate limit to a publish endpoint per client
-	// Default: 1 every 100ms, burst capacity of 8
-	publishLimiter *rate.Limiter
-
-	// Sets logger to the default log.Printf
-	// Add a custom logger here
-	logf func(format string, v ...any)
+	// Settings that can change while running: the message queue's window size,
+	// the publish rate limiter, the matchmaking window and the chat filter
+	// The limiter defaults to 1 every 100ms with a burst of 8, see PUBLISH_INTERVAL and PUBLISH_BURST
+	// Swapped as a whole by ApplySettings, see settings.go
+	settingsMutex sync.Mutex // Serializes changes
+	settings      atomic.Pointer[liveSettings]
+
+	// Structured logger, the default slog logger unless replaced
+	// logf logs printf style through it, with the level taken from an [ERROR] or [WARN] prefix
+	logger *slog.Logger
+	logf   func(format string, v ...any)
 
 	// Router for endpoints to corresponding handlers e.g. /chat
+	// Every route is registered behind the routes middleware stack, see handle
 	serveMux *http.ServeMux
+	routes   middleware.Stack
 
 	// TODO: multiple lobby support. create,join,leave,delete lobby UI and endpoints
 	lobbiesMutex sync.Mutex
@@ -41,13 +54,129 @@ type GameServer struct {
 
 	// Matchmaking queue
 	queueMutex       sync.Mutex
-	matchmakingQueue []int // subscriber IDs
+	matchmakingQueue []queueEntry
+
+	// When set, pairs the lowest latency players among the first MatchmakingWindow queued
+	preferLowLatency bool
+
+	// Server pings each client every pingInterval and disconnects
+	// clients that don't pong within pingTimeout. 0 interval disables pings
+	pingInterval time.Duration
+	pingTimeout  time.Duration
+
+	// In-progress matches by match ID
+	matchesMutex sync.Mutex
+	matches      map[string]*Match
+
+	// How long spectators lag behind live match state
+	spectatorDelay time.Duration
+
+	// Recently finished replays by match ID, oldest first in replayOrder
+	// and running replay playbacks by subscriber ID
+	replaysMutex sync.Mutex
+	replays      map[string]*Replay
+	replayOrder  []string
+	playbacks    map[int]*playback
+
+	// Subscribers without a heartbeat or action for presenceIdleTimeout are marked idle
+	// Checked every presenceSweepInterval
+	presenceIdleTimeout   time.Duration
+	presenceSweepInterval time.Duration
+
+	// All timers and timestamps go through clock so tests can fast-forward them
+	clock clock.Clock
+
+	// Match time control, and how long a disconnected player has to reconnect
+	// before forfeiting. Sessions let a reconnecting client keep its subscriber id
+	timeControl     TimeControl
+	reconnectWindow time.Duration
+	sessionsMutex   sync.Mutex
+	sessions        map[string]*session
+
+	// How long players see the result before returning to the lobby
+	resultDelay time.Duration
+
+	// Pending rematch offers by series ID, open for rematchTimeout after a series ends
+	rematchTimeout time.Duration
+	rematchesMutex sync.Mutex
+	rematches      map[string]*rematch
+
+	// Pending direct challenges by challenge ID, open for challengeTimeout
+	challengeTimeout time.Duration
+	challengesMutex  sync.Mutex
+	challenges       map[string]*challenge
+
+	// Elo ratings by mode and user for the current season, and the
+	// leaderboards built from them, kept sorted as results come in
+	ratingsMutex sync.Mutex
+	ratings      map[ratingKey]playerRating
+	boards       map[string]*leaderboard
+	season       Season
+	seasonStart  time.Time
+	seasonLength time.Duration
+
+	// Tournaments by ID
+	tournamentsMutex sync.Mutex
+	tournaments      map[string]*Tournament
+
+	// Every chat message passes through the chat filter in settings before it is stored and sent
+	// History is kept per lobby up to chatHistoryLimit messages and chatRetention old
+	chatMutex        sync.Mutex
+	chatHistory      map[string][]ChatMessage
+	chatHistoryLimit int
+	chatRetention    time.Duration
+	mutes            map[muteKey]time.Time // Muted accounts and guest IPs until when
+
+	// Social graph by account: friends and blocks are sets per account,
+	// friend requests are kept by recipient and by sender
+	socialMutex    sync.Mutex
+	friends        map[string]map[string]bool
+	friendRequests map[string]map[string]bool // Recipient -> senders
+	sentRequests   map[string]map[string]bool // Sender -> recipients
+	blocks         map[string]map[string]bool // Blocker -> blocked
+
+	// Unread direct messages by recipient account, oldest first
+	dmMutex    sync.Mutex
+	pendingDMs map[string][]DirectMessage
+
+	// Browser origins allowed to connect, shared with the CORS middleware
+	origins *origin.Policy
+
+	// Users are authenticated through Supabase, with roles from app metadata
+	// or the user_roles table
+	authClient *auth.Client
+
+	// Bans in force, shared with the auth middleware
+	bans *moderation.Bans
+
+	// API keys trusted backends authenticate with, shared with the auth middleware
+	apiKeys *apikey.Keys
+
+	// Supabase user that owns rows the server writes itself. Empty if not configured
+	servicePrincipalID string
+
+	// Source of per-match seeds and other server randomness
+	// Seeded from config so a whole server run can be reproduced
+	rngMutex sync.Mutex
+	rng      *rand.Rand
+
+	// Set once the server starts draining for shutdown, see shutdown.go
+	// Background database writes are counted so shutdown can wait for them
+	shutdownNotice atomic.Pointer[ServerShutdown]
+	pendingWrites  atomic.Int64
+	reconnectDelay time.Duration // How long clients are told to wait before reconnecting
+
+	// Lobbies, the queue, sessions and matches are saved to snapshots every
+	// snapshotInterval and restored on startup, see snapshot.go. Nil disables snapshots
+	snapshots        snapshot.Store
+	snapshotInterval time.Duration
+	snapshotMaxAge   time.Duration
 
 	dbClient *db.Client
 }
 
 // GameServer Constructor
-func NewGameServer(mux *http.ServeMux, dbClient *db.Client) *GameServer {
+func NewGameServer(mux *http.ServeMux, cfg *config.Config, dbClient *db.Client, origins *origin.Policy, clk clock.Clock) *GameServer {
 	globalLobby := &Lobby{
 		ID:          "global",
 		Name:        "Global Lobby",
@@ -55,31 +184,218 @@ func NewGameServer(mux *http.ServeMux, dbClient *db.Client) *GameServer {
 	}
 
 	gs := &GameServer{
-		subscriberMessageBuffer: 12,
-		publishLimiter:          rate.NewLimiter(rate.Every(time.Millisecond*100), 8),
-		logf:                    log.Printf,
+		logger:                  slog.Default(),
 		serveMux:                mux,
 		lobbies:                 make(map[string]*Lobby),
 		globalLobby:             globalLobby,
-		matchmakingQueue:        make([]int, 0), // First players in should get priority. Might use a queue window later
-		dbClient:                dbClient,
+		matchmakingQueue:        make([]queueEntry, 0), // First players in should get priority
+		preferLowLatency:        cfg.MatchPreferLowLatency,
+		pingInterval:            cfg.WSPingInterval,
+		pingTimeout:             cfg.WSPingTimeout,
+		matches:                 make(map[string]*Match),
+		spectatorDelay:          cfg.SpectatorDelay,
+		replays:                 make(map[string]*Replay),
+		playbacks:               make(map[int]*playback),
+		presenceIdleTimeout:     cfg.PresenceIdleTimeout,
+		presenceSweepInterval:   cfg.PresenceSweepInterval,
+		clock:                   clk,
+		timeControl: TimeControl{
+			Base:        cfg.MatchClockBase,
+			Increment:   cfg.MatchClockIncrement,
+			TurnTimeout: cfg.MatchTurnTimeout,
+		},
+		reconnectWindow: cfg.MatchReconnectWindow,
+		sessions:        make(map[string]*session),
+		resultDelay:     cfg.MatchResultDelay,
+		rematchTimeout:  cfg.MatchRematchTimeout,
+		rematches:       make(map[string]*rematch),
+		ratings:         make(map[ratingKey]playerRating),
+		boards:          make(map[string]*leaderboard),
+		seasonStart:     cfg.SeasonStart,
+		seasonLength:    cfg.SeasonLength,
+		tournaments:     make(map[string]*Tournament),
+
+		challengeTimeout: cfg.ChallengeTimeout,
+		challenges:       make(map[string]*challenge),
+
+		chatHistory:      make(map[string][]ChatMessage),
+		chatHistoryLimit: cfg.ChatHistoryLimit,
+		chatRetention:    cfg.ChatRetention,
+		mutes:            make(map[muteKey]time.Time),
+		friends:          make(map[string]map[string]bool),
+		friendRequests:   make(map[string]map[string]bool),
+		sentRequests:     make(map[string]map[string]bool),
+		blocks:           make(map[string]map[string]bool),
+		pendingDMs:       make(map[string][]DirectMessage),
+		origins:          origins,
+		authClient:       auth.NewClient(cfg),
+		bans:             moderation.NewBans(clk),
+
+		apiKeys:            apikey.NewKeys(clk),
+		servicePrincipalID: cfg.ServicePrincipalID,
+		reconnectDelay:     cfg.ShutdownReconnectDelay,
+		snapshotInterval:   cfg.SnapshotInterval,
+		snapshotMaxAge:     cfg.SnapshotMaxAge,
+
+		dbClient: dbClient,
+	}
+
+	gs.logf = func(format string, v ...any) {
+		logging.Printf(gs.logger, context.Background(), format, v...)
+	}
+	gs.routes = middleware.Stack{
+		Logger:    gs.logger,
+		BodyLimit: cfg.HTTPBodyLimit,
+		Timeout:   cfg.HTTPHandlerTimeout,
+	}
+
+	// A seed of 0 means pick one, which is logged so the run can be repeated
+	seed := cfg.GameSeed
+	if seed == 0 {
+		seed = clk.Now().UnixNano()
+	}
+	gs.rng = rand.New(rand.NewSource(seed))
+	gs.logf("Game server seed: %d", seed)
+
+	if gs.seasonLength <= 0 {
+		gs.logf("[WARN] Invalid season length %v, using 91 days", gs.seasonLength)
+		gs.seasonLength = time.Hour * 24 * 91
+	}
+	gs.storeSettingsLocked(SettingsFrom(cfg))
+	gs.authClient.Bans = gs.bans
+	gs.authClient.Roles = auth.RolesTable(dbClient, cfg.RoleCacheTTL)
+	gs.authClient.Keys = gs.apiKeys
+
+	snapshots, err := snapshot.Open(cfg.SnapshotStore, cfg.SnapshotPath, cfg.SnapshotKey, dbClient)
+	if err != nil {
+		gs.logf("[WARN] %v, snapshots are disabled", err)
 	}
+	gs.snapshots = snapshots
+
+	gs.season = gs.seasonAt(clk.Now())
+	gs.logf("Season %d ends %s", gs.season.Number, gs.season.EndsAt.Format(time.RFC3339))
 
 	// Add global lobby to lobbies map
 	gs.lobbies["global"] = globalLobby
 
 	// Register WebSocket endpoints
-	gs.serveMux.HandleFunc("/ws/subscribe", gs.subscribeHandler)
-	gs.serveMux.HandleFunc("/ws/publish", gs.publishHandler)
+	// Subscriptions stay open as long as the client does, so have no timeout
+	gs.serveMux.Handle("/ws/subscribe", gs.routes.WithTimeout(0).WrapFunc(gs.subscribeHandler))
+	gs.handle("/ws/publish", gs.requireAccess(gs.publishHandler, apikey.ScopePublish, auth.RoleAdmin, auth.RoleService))
+
+	// Chat and lobby endpoints
+	gs.handle("/ws/chat", gs.chatHandler)
+	gs.handle("GET /lobbies/{id}/chat", gs.chatHistoryHandler)
+	gs.handle("/ws/chat/delete", gs.requireAccess(gs.deleteChatHandler, apikey.ScopeModerate, auth.RoleModerator))
+	gs.handle("/ws/chat/mute", gs.requireAccess(gs.muteChatHandler, apikey.ScopeModerate, auth.RoleModerator))
+	gs.handle("/ws/lobby/join", gs.joinLobbyHandler)
+	gs.handle("/ws/queue/join", gs.joinQueueHandler)
+
+	// Presence endpoints
+	gs.handle("/ws/presence/heartbeat", gs.heartbeatHandler)
+	gs.handle("GET /presence", gs.presenceHandler)
+
+	// Match endpoints
+	gs.handle("GET /ws/matches", gs.listMatchesHandler)
+	gs.handle("/ws/match/command", gs.matchCommandHandler)
+	gs.handle("/ws/match/spectate", gs.spectateHandler)
+	gs.handle("/ws/match/spectate/leave", gs.leaveSpectateHandler)
+	gs.handle("/ws/match/rematch", gs.rematchHandler)
+
+	// Direct challenge endpoints
+	gs.handle("/ws/challenge/send", gs.sendChallengeHandler)
+	gs.handle("/ws/challenge/respond", gs.respondChallengeHandler)
+	gs.handle("/ws/challenge/cancel", gs.cancelChallengeHandler)
+
+	// Replay endpoints
+	gs.handle("GET /matches/{id}/replay", gs.replayHandler)
+	gs.handle("/ws/replay/play", gs.playReplayHandler)
+	gs.handle("/ws/replay/stop", gs.stopReplayHandler)
+
+	// Tournament endpoints
+	gs.handle("GET /tournaments", gs.listTournamentsHandler)
+	gs.handle("GET /tournaments/{id}/bracket", gs.bracketHandler)
+	gs.handle("/ws/tournament/create", gs.createTournamentHandler)
+	gs.handle("/ws/tournament/register", gs.registerTournamentHandler)
+	gs.handle("/ws/tournament/withdraw", gs.withdrawTournamentHandler)
+	gs.handle("/ws/tournament/checkin/open", gs.openCheckInHandler)
+	gs.handle("/ws/tournament/checkin", gs.checkInHandler)
+	gs.handle("/ws/tournament/start", gs.startTournamentHandler)
+	gs.handle("/ws/tournament/ready", gs.tournamentReadyHandler)
+
+	// Friend and direct message endpoints
+	gs.handle("GET /friends", gs.friendsHandler)
+	gs.handle("/ws/friends/request", gs.friendRequestHandler)
+	gs.handle("/ws/friends/respond", gs.friendRespondHandler)
+	gs.handle("/ws/friends/remove", gs.friendRemoveHandler)
+	gs.handle("/ws/friends/block", gs.blockHandler)
+	gs.handle("GET /dm", gs.directMessagesHandler)
+	gs.handle("GET /dm/unread", gs.unreadDirectMessagesHandler)
+	gs.handle("/ws/dm/send", gs.sendDirectMessageHandler)
+	gs.handle("/ws/dm/read", gs.readDirectMessagesHandler)
+
+	// Admin moderation endpoints
+	gs.handle("GET /admin/bans", gs.requireAccess(gs.listBansHandler, apikey.ScopeModerate, auth.RoleModerator))
+	gs.handle("GET /admin/audit", gs.requireAccess(gs.auditLogHandler, apikey.ScopeAudit, auth.RoleAdmin))
+	gs.handle("/admin/ban", gs.requireAccess(gs.banHandler, apikey.ScopeModerate, auth.RoleModerator))
+	gs.handle("/admin/unban", gs.requireAccess(gs.unbanHandler, apikey.ScopeModerate, auth.RoleModerator))
+	gs.handle("/admin/kick", gs.requireAccess(gs.kickHandler, apikey.ScopeModerate, auth.RoleModerator))
+
+	// API key endpoints, for admins only. Keys can't manage other keys
+	gs.handle("GET /admin/keys", gs.requireRole(gs.listAPIKeysHandler, auth.RoleAdmin))
+	gs.handle("/admin/keys/create", gs.requireRole(gs.createAPIKeyHandler, auth.RoleAdmin))
+	gs.handle("/admin/keys/rotate", gs.requireRole(gs.rotateAPIKeyHandler, auth.RoleAdmin))
+	gs.handle("/admin/keys/revoke", gs.requireRole(gs.revokeAPIKeyHandler, auth.RoleAdmin))
+
+	// Runtime settings endpoints, for admins only
+	gs.handle("GET /admin/settings", gs.requireRole(gs.settingsHandler, auth.RoleAdmin))
+	gs.handle("/admin/settings/update", gs.requireRole(gs.updateSettingsHandler, auth.RoleAdmin))
+
+	// Leaderboard and season endpoints
+	gs.handle("GET /leaderboard", gs.leaderboardHandler)
+	gs.handle("GET /leaderboard/around", gs.leaderboardAroundHandler)
+	gs.handle("GET /seasons/current", gs.seasonHandler)
+	gs.handle("GET /players/{id}/seasons", gs.playerSeasonsHandler)
+
+	gs.registerMetrics()
+
+	// Restore before anyone can connect, so returning players find their matches
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	gs.restoreSnapshot(ctx)
+	cancel()
+	if gs.snapshots != nil && gs.snapshotInterval > 0 {
+		go gs.snapshotLoop()
+	}
 
-	// Chat and lobby endpoints with CORS support
-	gs.serveMux.HandleFunc("/ws/chat", middleware.CORS(gs.chatHandler))
-	gs.serveMux.HandleFunc("/ws/lobby/join", middleware.CORS(gs.joinLobbyHandler))
-	gs.serveMux.HandleFunc("/ws/queue/join", middleware.CORS(gs.joinQueueHandler))
+	go gs.presenceLoop()
+	go gs.loadRatings()
+	go gs.seasonLoop()
+	go gs.loadChatHistory()
+	go gs.chatLoop()
+	go gs.loadSocial()
+	go gs.loadPendingDirectMessages()
+	go gs.loadBans()
+	go gs.loadAPIKeys()
 
 	return gs
 }
 
+// handle registers a route behind the routes middleware stack
+func (gs *GameServer) handle(pattern string, handler http.HandlerFunc) {
+	gs.serveMux.Handle(pattern, gs.routes.WrapFunc(handler))
+}
+
+// logc logs like logf, adding the attributes carried by ctx, e.g. the request ID
+func (gs *GameServer) logc(ctx context.Context, format string, v ...any) {
+	logging.Printf(gs.logger, ctx, format, v...)
+}
+
+// AuthClient returns the auth client this server uses, so other routes
+// enforce the same bans and roles
+func (gs *GameServer) AuthClient() *auth.Client {
+	return gs.authClient
+}
+
 // Implement http.Handler interface so it can be an http server handler
 // Delegates requests to the appropriate handler
 func (gs *GameServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -89,11 +405,22 @@ func (gs *GameServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 // Publish message to all subscribers in global lobby
 func (gs *GameServer) publish(msg []byte) {
-	gs.globalLobby.mutex.Lock()
-	defer gs.globalLobby.mutex.Unlock()
+	start := time.Now()
+	defer func() {
+		metrics.PublishDuration.WithLabelValues("global").Observe(time.Since(start).Seconds())
+	}()
 
 	// Blocks until the rate limiter allows publishing (indefintely with background context)
-	gs.publishLimiter.Wait(context.Background())
+	// Waits before taking the lobby lock so a backlog doesn't hold up joins and leaves
+	gs.settings.Load().publishLimiter.Wait(context.Background())
+
+	gs.deliver(msg)
+}
+
+// deliver sends a message to all subscribers in the global lobby without rate limiting
+func (gs *GameServer) deliver(msg []byte) {
+	gs.globalLobby.mutex.Lock()
+	defer gs.globalLobby.mutex.Unlock()
 
 	// For each subscriber: send message on their channel
 	// If the subscriber cannot immediately receive the message,
@@ -102,6 +429,7 @@ func (gs *GameServer) publish(msg []byte) {
 		select {
 		case s.messc <- msg:
 		default:
+			metrics.MessagesDropped.WithLabelValues("subscriber_full").Inc()
 			go s.closeSlow()
 		}
 	}
@@ -113,9 +441,8 @@ func (gs *GameServer) publishHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
 		return
 	}
-	// Receive request and and limit body size to 8KB. Adjust as needed.
-	body := http.MaxBytesReader(w, r.Body, 8192)
-	msg, err := io.ReadAll(body)
+	// Receive request, the body size is limited by the route stack
+	msg, err := io.ReadAll(r.Body)
 	if err != nil {
 		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
 		return
@@ -126,6 +453,40 @@ func (gs *GameServer) publishHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusAccepted)
 }
 
+// Sends a message to a single subscriber in the global lobby
+// Drops the message if the subscriber is not connected
+func (gs *GameServer) sendTo(id int, msg []byte) {
+	s := gs.GetSubscriber(id)
+	if s == nil {
+		return
+	}
+
+	select {
+	case s.messc <- msg:
+	default:
+		metrics.MessagesDropped.WithLabelValues("subscriber_full").Inc()
+		go s.closeSlow()
+	}
+}
+
+// sendToAccount sends a message to every connection signed in as an account
+func (gs *GameServer) sendToAccount(account string, msg []byte) {
+	gs.globalLobby.mutex.Lock()
+	defer gs.globalLobby.mutex.Unlock()
+
+	for _, s := range gs.globalLobby.subscribers {
+		if s.account != account {
+			continue
+		}
+		select {
+		case s.messc <- msg:
+		default:
+			metrics.MessagesDropped.WithLabelValues("subscriber_full").Inc()
+			go s.closeSlow()
+		}
+	}
+}
+
 // Add single subscriber to global lobby
 func (gs *GameServer) addSubscriber(s *Subscriber) {
 	gs.globalLobby.mutex.Lock()
@@ -170,20 +531,28 @@ func writeTimeout(ctx context.Context, timeout time.Duration, conn *websocket.Co
 // to incoming messages
 // Handles errors and whether client or server canceled connection already
 func (gs *GameServer) subscribeHandler(w http.ResponseWriter, r *http.Request) {
+	// Every connection gets its own ID, so a resumed subscriber's connections can be told apart
+	r = r.WithContext(logging.With(r.Context(), "conn_id", uuid.New().String()))
+
 	err := gs.subscribe(w, r)
 	// Check if context is canceled already by server or client
 	if errors.Is(err, context.Canceled) {
-		gs.logf("Subscription canceled: %v", err)
+		gs.logc(r.Context(), "Subscription canceled: %v", err)
+		return
+	}
+
+	if errors.Is(err, errBanned) {
+		gs.logc(r.Context(), "[MODERATION] Refused connection from banned client %s", r.RemoteAddr)
 		return
 	}
 
 	if websocket.CloseStatus(err) == websocket.StatusNormalClosure || websocket.CloseStatus(err) == websocket.StatusGoingAway {
-		gs.logf("WebSocket connection closed: %v", err)
+		gs.logc(r.Context(), "WebSocket connection closed: %v", err)
 		return
 	}
 
 	if err != nil {
-		gs.logf("Failed to subscribe: %v", err)
+		gs.logc(r.Context(), "Failed to subscribe: %v", err)
 		return
 	}
 }
@@ -197,9 +566,10 @@ func (gs *GameServer) getSubscribers() []Peer {
 
 	for _, s := range gs.globalLobby.subscribers {
 		peers = append(peers, Peer{
-			Type:  "PEER_JOIN",
-			ID:    s.ID(),
-			State: "Joined", // TODO: default
+			Type:      "PEER_JOIN",
+			ID:        s.ID(),
+			AccountID: s.account,
+			State:     s.Presence(),
 		})
 	}
 
@@ -217,8 +587,7 @@ func (gs *GameServer) subscribe(w http.ResponseWriter, r *http.Request) error {
 	var conn *websocket.Conn
 	var closed bool
 
-	// Initialize subscriber with a unique id
-	s := NewSubscriber(make(chan []byte, gs.subscriberMessageBuffer), func() {
+	closeWith := func(code websocket.StatusCode, reason string) {
 		// Using mutex ensures wrong sub isnt set to closed
 		mutex.Lock()
 		defer mutex.Unlock()
@@ -226,17 +595,74 @@ func (gs *GameServer) subscribe(w http.ResponseWriter, r *http.Request) error {
 		closed = true
 
 		if conn != nil {
-			conn.Close(websocket.StatusPolicyViolation, "Connection is too slow to keep up with messages")
+			conn.Close(code, reason)
+		}
+	}
+	closeSlow := func() {
+		metrics.SlowClosed.Inc()
+		closeWith(websocket.StatusPolicyViolation, "Connection is too slow to keep up with messages")
+	}
+
+	// Banned IPs are refused before anything is allocated for them
+	ip := moderation.ClientIP(r)
+	if ban, banned := gs.bans.Check(moderation.KindIP, ip); banned {
+		http.Error(w, ban.Message(), http.StatusForbidden)
+		return errBanned
+	}
+
+	// Connections can authenticate for roles beyond player. Browsers can't set
+	// headers on WebSocket requests, so the access token comes in the query
+	account, roles := "", guestRoles
+	if token := r.URL.Query().Get("token"); token != "" {
+		user, err := gs.authClient.Authenticate(r.Context(), token)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return err
+		}
+		if ban, banned := gs.bans.Check(moderation.KindAccount, user.ID); banned {
+			http.Error(w, ban.Message(), http.StatusForbidden)
+			return errBanned
 		}
-	})
+		account, roles = user.ID, user.Roles
+	}
+
+	// Resume the id of a dropped connection if the client has a valid session,
+	// otherwise initialize subscriber with a unique id and a new session
+	var s *Subscriber
+	messc := make(chan []byte, gs.settings.Load().MessageBuffer)
+	sessionToken := r.URL.Query().Get("session")
+	id, resumed := gs.resumeSession(sessionToken)
+	if resumed {
+		if ban, banned := gs.bans.Check(moderation.KindUser, strconv.Itoa(id)); banned {
+			gs.revokeSessions(id)
+			http.Error(w, ban.Message(), http.StatusForbidden)
+			return errBanned
+		}
+		s = resumeSubscriber(id, messc, gs.clock, closeSlow)
+	} else {
+		s = NewSubscriber(messc, gs.clock, closeSlow)
+		sessionToken = gs.createSession(s.ID())
+	}
+	s.kick = func(reason string) { closeWith(websocket.StatusPolicyViolation, reason) }
+	s.goAway = func(reason string) { closeWith(websocket.StatusGoingAway, reason) }
+	s.ctx = logging.With(context.WithoutCancel(r.Context()), "user_id", s.ID())
+	if account != "" {
+		s.ctx = logging.With(s.ctx, "account_id", account)
+	}
+	s.ip = ip
+	s.account = account
+	s.roles = roles
+	gs.logc(s.ctx, "Subscriber connected (resumed: %t)", resumed)
+	defer gs.closeSession(sessionToken)
 
 	// Deferred leave handling
 	defer func() {
 		// Handle leaving
 		peerLeave := Peer{
-			Type: "PEER_LEAVE",
-			ID:   s.ID(),
-			State: "Left",
+			Type:      "PEER_LEAVE",
+			ID:        s.ID(),
+			AccountID: s.account,
+			State:     PresenceOffline,
 		}
 
 		pl, _ := json.Marshal(peerLeave) // Turn into []byte
@@ -246,6 +672,12 @@ func (gs *GameServer) subscribe(w http.ResponseWriter, r *http.Request) error {
 	// Adding and removing subscribers each handle mutex on their own, so we don't need to lock here
 	gs.addSubscriber(s)
 	defer gs.removeSubscriber(s) // Ensure subscriber is removed when function ends
+	defer gs.leaveSpectating(s.ID())
+	defer gs.playerDisconnected(s.ID())
+
+	if resumed {
+		gs.playerReconnected(s.ID())
+	}
 
 	// TODO: consider refactoring this to handler?
 	// Broadcast lobby join event
@@ -269,10 +701,9 @@ func (gs *GameServer) subscribe(w http.ResponseWriter, r *http.Request) error {
 	}()
 
 	// Websocket options
-	// TODO: Do not allow insecure skip verify, 
+	// Browsers may only connect from origins the origin policy allows, same as HTTP routes
 	opts := websocket.AcceptOptions{
-		// OriginPatterns: []string{"localhost:5173"},
-		InsecureSkipVerify: true,
+		OriginPatterns: gs.origins.WebSocketPatterns(),
 	}
 
 	// Accept WebSocket connection with options applied
@@ -295,15 +726,21 @@ func (gs *GameServer) subscribe(w http.ResponseWriter, r *http.Request) error {
 	defer conn.CloseNow() // Ensures connection is closed when function ends
 
 	// Send welcome message with assigned id as JSON so clients can decode it
+	// Clients reconnect with the session token to keep their id
 	welcome := struct {
 		Type string  `json:"type"`
 		ID   int     `json:"id"`
 		Peers []Peer `json:"peers"`
-
+		SessionToken string `json:"session_token"`
+		Resumed      bool   `json:"resumed"`
+		Roles        []string `json:"roles"`
 	}{
 		Type: "WELCOME",
 		ID: s.ID(),
 		Peers: gs.getSubscribers(), 
+		SessionToken: sessionToken,
+		Resumed:      resumed,
+		Roles:        s.roles,
 	}
 	
 	wj, wjerr := json.Marshal(welcome)
@@ -316,25 +753,41 @@ func (gs *GameServer) subscribe(w http.ResponseWriter, r *http.Request) error {
 			_ = writeTimeout(context.Background(), time.Second*5, conn, wj)
 		}
 	} else {
-		gs.logf("failed to marshal welcome JSON: %v", wjerr)
+		gs.logc(s.ctx, "failed to marshal welcome JSON: %v", wjerr)
 	}
 
 	// Add this new subscriber
 	// Broadcast peerJoin to existing subscribers except the new one
-	// Set a default start state 
+	// New subscribers start online
 	peerJoin := Peer{
-		Type: "PEER_JOIN",
-		ID:   s.ID(),
-		State: "Joined", // Default start state
+		Type:      "PEER_JOIN",
+		ID:        s.ID(),
+		AccountID: s.account,
+		State:     PresenceOnline,
 	}
 
 	pj, _ := json.Marshal(peerJoin) // Turn into []byte
 	gs.publish(pj)
 
+	// Direct messages sent while this user was offline
+	if s.account != "" {
+		gs.deliverPendingDMs(s)
+	}
+
+	// Clients connecting while the server drains, like players returning to
+	// finish a match, still need to know it's going away
+	if notice := gs.shutdownNotice.Load(); notice != nil {
+		msg, _ := json.Marshal(notice)
+		gs.sendTo(s.ID(), msg)
+	}
+
 	// Init Context that is canceled when WebSocket's read connection is closed
 	// Ensures the loop below stops when client stops reading
 	ctx := conn.CloseRead(context.Background()) // TODO: Disable this tio enable client to send messasges back (currently is read only)
 
+	// CloseRead keeps reading in the background, so pongs are processed
+	go gs.keepalive(ctx, conn, s)
+
 	// While loop
 	// Listens for messages arriving, with timeout
 	// Listens for cancellation of the context (closed connection)
@@ -350,4 +803,41 @@ func (gs *GameServer) subscribe(w http.ResponseWriter, r *http.Request) error {
 				return ctx.Err()
 		}
 	}
-}
\ No newline at end of file
+}
+
+// keepalive pings the client every pingInterval and records the round trip time
+// If no pong arrives within pingTimeout, the connection is dropped,
+// which cancels ctx and ends the subscription
+func (gs *GameServer) keepalive(ctx context.Context, conn *websocket.Conn, s *Subscriber) {
+	if gs.pingInterval <= 0 {
+		return
+	}
+
+	ticker := gs.clock.NewTicker(gs.pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			pingCtx, cancel := context.WithTimeout(ctx, gs.pingTimeout)
+			start := gs.clock.Now()
+			err := conn.Ping(pingCtx)
+			cancel()
+
+			if err != nil {
+				// Subscription already ended
+				if ctx.Err() != nil {
+					return
+				}
+				// Half-open connections never answer, so skip the close handshake
+				gs.logc(s.ctx, "[PING] Subscriber %d did not respond to ping, disconnecting: %v", s.ID(), err)
+				conn.CloseNow()
+				return
+			}
+
+			s.setLatency(gs.clock.Since(start))
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -39,8 +39,11 @@ echo "   ✓ Match should be triggered"
 echo ""
 
 # Wait for match to complete and result to be stored
-echo "3. Waiting for match result to be stored..."
-sleep 2
+# Neither player is connected, so the match ends by abandon once the
+# reconnect window (MATCH_RECONNECT_WINDOW, default 30s) runs out
+RECONNECT_WAIT=${RECONNECT_WAIT:-32}
+echo "3. Waiting ${RECONNECT_WAIT}s for match result to be stored..."
+sleep "$RECONNECT_WAIT"
 echo "   ✓ Wait complete"
 echo ""
 
@@ -50,7 +53,7 @@ echo "✓ TEST COMPLETE"
 echo "══════════════════════════════════════════════"
 echo ""
 echo "Check server logs for:"
-echo "  - Match result message (e.g., 'User 500 wins against User 600')"
+echo "  - Match result message (e.g., 'User 600 wins against User 500 (abandon)')"
 echo "  - Success message (e.g., '[SUCCESS] Match result stored: title=match_result...')"
 echo ""
 echo "If you see both messages in the server logs, the test PASSED!"